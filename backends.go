@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/ds2-lab/infinibench/bench"
+)
+
+// runBackends runs the identical workload against every backend, and prints the backends side by side.
+func runBackends(ctx context.Context, opts *Options) error {
+	backends, err := bench.ParseBackends(opts.Backends)
+	if err != nil {
+		fmt.Fprintf(opts.Stderr, "%s\n", err)
+		return err
+	}
+	comparison := &bench.Comparison{Backends: backends}
+
+	benchOpts := opts.Options
+	benchOpts.Progress = newProgress(opts, fmt.Sprintf("key_%d ~ key_%d", opts.Keymin, opts.Keymax))
+	ret, err := comparison.Run(ctx, &benchOpts, func(backend *bench.BackendResult) {
+		if backend.Result != nil {
+			fmt.Fprintf(opts.Stdout, "\r%s: %.2f requests per second, p99 %.3f milliseconds, %.2f%% failed\n",
+				backend.Name, backend.Result.Throughput, backend.Result.Latency().P99, backend.Result.ErrorRate())
+			for _, warning := range backend.Result.Warnings {
+				fmt.Fprintf(opts.Stderr, "%s: %s\n", backend.Name, warning)
+			}
+		}
+		if backend.Error != "" {
+			fmt.Fprintf(opts.Stderr, "%s: %s\n", backend.Name, backend.Error)
+		}
+	})
+	if ret == nil {
+		fmt.Fprintf(opts.Stderr, "%s\n", err)
+		return err
+	}
+
+	fmt.Fprintf(opts.Stdout, "\nSeed: %d\n\n", ret.Seed)
+	if opts.TableFile != "" {
+		err := writeFile(opts.TableFile, func(w io.Writer) error { return ret.WriteTable(w, opts.TableFormat) })
+		if err != nil {
+			fmt.Fprintf(opts.Stderr, "Failed to write backends table: %v\n", err)
+		}
+	} else if err := ret.WriteTable(opts.Stdout, opts.TableFormat); err != nil {
+		fmt.Fprintf(opts.Stderr, "Failed to write backends table: %v\n", err)
+	}
+	if opts.JSONFile != "" {
+		if err := writeFile(opts.JSONFile, ret.WriteJSON); err != nil {
+			fmt.Fprintf(opts.Stderr, "Failed to write JSON result: %v\n", err)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(opts.Stderr, "%s\n", err)
+	}
+	return err
+}
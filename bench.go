@@ -24,336 +24,310 @@ package main
 // SOFTWARE.
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
-	"math"
-	"math/rand"
 	"os"
+	"os/signal"
+	"sort"
 	"strconv"
 	"strings"
-	"sync/atomic"
 	"time"
 
 	"github.com/ScottMansfield/nanolog"
 	infinistore "github.com/ds2-lab/infinistore/client"
-	"github.com/go-redis/redis/v8"
 
 	//"github.com/pkg/profile"
 
+	"github.com/ds2-lab/infinibench/bench"
 	"github.com/ds2-lab/infinibench/benchclient"
+	"github.com/ds2-lab/infinibench/histogram"
 	"github.com/dustin/go-humanize"
 )
 
-const (
-	CLIENT_INFINICACHE = "infinistore"
-	CLIENT_REDIS       = "redis"
-	CLIENT_S3          = "s3"
-	CLIENT_ELASTICACHE = "elasticache"
-	CLIENT_FSX         = "fsx"
-	CLIENT_EFS         = "efs"
-)
-
-// Options represents various options used by the Bench() function.
+// Options represents the options of the command. Options of the benchmark are embedded.
 type Options struct {
-	AddrList       string
-	Bucket         string
-	Requests       int
-	Clients        int
-	Pipeline       int
-	Keymin         int
-	Keymax         int
-	Objsz          int
-	Datashard      int
-	Parityshard    int
-	ECmaxgoroutine int
-	Op             int
+	bench.Options
 	Quiet          bool
 	CSV            bool
 	Stdout         io.Writer
 	Stderr         io.Writer
 	Printlog       bool
 	File           string
-	Interval       int64
-	ClientLib      string
-	ClientBase     string
+	HistFile       string
+	JSONFile       string
+	SeriesFile     string
+	SeriesFormat   string
+	SeriesInterval time.Duration
+	ScenarioFile   string
+	Sweep          string
+	SweepMode      string
+	TableFormat    string
+	TableFile      string
+	Backends       string
+	Coordinator    string
+	Workers        int
+	Worker         string
+	WorkerName     string
+	Ramp           string
+	RampStart      float64
+	RampStep       float64
+	RampFactor     float64
+	RampMax        float64
+	RampRefine     int
+	SLO            time.Duration
+	SLOPercentile  float64
+	SLOErrors      float64
 }
 
-// DefaultsOptions are the default options used by the Bench() function.
+// DefaultsOptions are the default options of the command. Options of the benchmark default to bench.DefaultOptions.
 var DefaultOptions = &Options{
-	AddrList:       "127.0.0.1:6378",
-	Bucket:         "",
-	Requests:       15,
-	Clients:        1,
-	Pipeline:       1,
-	Keymin:         0,
-	Keymax:         99,
-	Objsz:          10485760 * 4,
-	Datashard:      4,
-	Parityshard:    2,
-	ECmaxgoroutine: 32,
-	Op:             0, // 0: SET; 1: GET
 	Quiet:          false,
 	CSV:            false,
 	Stdout:         os.Stdout,
 	Stderr:         os.Stderr,
 	Printlog:       true,
 	File:           "test.txt",
-	Interval:       0,
-	ClientLib:      CLIENT_INFINICACHE,
-	ClientBase:     "",
+	HistFile:       "",
+	JSONFile:       "",
+	SeriesFile:     "",
+	SeriesFormat:   bench.SERIES_CSV,
+	SeriesInterval: time.Second,
+	ScenarioFile:   "",
+	Sweep:          "",
+	SweepMode:      bench.SWEEP_PRODUCT,
+	TableFormat:    bench.TABLE_MARKDOWN,
+	TableFile:      "",
+	Backends:       "",
+	Coordinator:    "",
+	Workers:        1,
+	Worker:         "",
+	WorkerName:     "",
+	Ramp:           "",
+	RampStart:      1,
+	RampStep:       0,
+	RampFactor:     2,
+	RampMax:        0,
+	RampRefine:     3,
+	SLO:            0,
+	SLOPercentile:  99,
+	SLOErrors:      1,
 }
 
-func getRandomRange(min int, max int) int {
-	var rn int
-	rand.Seed(time.Now().UnixNano())
-	rn = rand.Intn(max-min+1) + min
-	return rn
-}
-
-func genKey(keymin int, keymax int, op int, i int) string {
-	var ret string
-	if op == 0 { // SET
-		keyIdx := keymin + i%(keymax-keymin+1)
-		ret = strings.Join([]string{"key_", strconv.Itoa(keyIdx)}, "")
-	} else { // GET
-		rn := getRandomRange(keymin, keymax)
-		ret = strings.Join([]string{"key_", strconv.Itoa(rn)}, "")
-	}
-	log.Println("generated key: ", ret, "len: ", len(ret))
-	return ret
-}
-
-// Bench performs a benchmark on the server at the specified address.
-//func Bench(
-//	name string,
-//	addr string,
-//	opts *Options,
-//	prep func(conn net.Conn) bool,
-//	fill func(buf []byte) []byte,
-//) {
-func Bench(
-	opts *Options,
-) {
-	if !opts.Printlog {
-		log.SetOutput(ioutil.Discard)
-	}
+// Bench runs the benchmark with the options, and prints the result to opts.Stdout.
+// Errors are printed to opts.Stderr and returned.
+func Bench(ctx context.Context, opts *Options) error {
 	if opts.Stderr == nil {
 		opts.Stderr = ioutil.Discard
 	}
 	if opts.Stdout == nil {
 		opts.Stdout = ioutil.Discard
 	}
-	var totalPayload uint64
-	var count uint64
-	var duration int64
-	//rpc := opts.Requests / opts.Clients
-	//rpcex := opts.Requests % opts.Clients
-	rpc := opts.Requests
-	var tstop int64
-	remaining := int64(opts.Clients)
-	errs := make([]error, opts.Clients)
-	durs := make([][]time.Duration, opts.Clients)
-	clis := make([]benchclient.Client, opts.Clients)
-
-	// create all clients
-	for i := 0; i < opts.Clients; i++ {
-		crequests := rpc
-		durs[i] = make([]time.Duration, crequests)
-		for j := 0; j < len(durs[i]); j++ {
-			durs[i][j] = -1
+	if opts.Worker != "" {
+		return runWorker(ctx, opts)
+	} else if opts.Coordinator != "" {
+		return runCoordinator(ctx, opts)
+	} else if opts.ScenarioFile != "" {
+		return runScenario(ctx, opts)
+	} else if opts.Sweep != "" {
+		return runSweep(ctx, opts)
+	} else if opts.Ramp != "" {
+		return runRamp(ctx, opts)
+	} else if opts.Backends != "" {
+		return runBackends(ctx, opts)
+	}
+
+	benchOpts := opts.Options
+	benchOpts.Progress = newProgress(opts, fmt.Sprintf("key_%d ~ key_%d", opts.Keymin, opts.Keymax))
+	ret, err := bench.Run(ctx, &benchOpts)
+	if ret == nil {
+		fmt.Fprintf(opts.Stderr, "%s\n", err)
+		return err
+	}
+	printSummary(opts, ret)
+
+	if opts.HistFile != "" {
+		if err := writeFile(opts.HistFile, ret.ExportHistograms); err != nil {
+			fmt.Fprintf(opts.Stderr, "Failed to export histograms: %v\n", err)
 		}
-		//conn, err := net.Dial("tcp", addr)
-
-		var cli benchclient.Client
-		switch opts.ClientLib {
-		case CLIENT_REDIS:
-			cli = benchclient.NewRedisWithBackend(redis.NewClient(&redis.Options{
-				Addr:       opts.AddrList,
-				Password:   "", // no password set
-				DB:         0,  // use default DB
-				PoolSize:   1,  // use 1 connection per concurrency.
-				MaxRetries: 0,
-			}))
-		case CLIENT_S3:
-			bucket := opts.ClientBase
-			if bucket == "" {
-				bucket = opts.Bucket
-			}
-			cli = benchclient.NewS3(bucket)
-		case CLIENT_ELASTICACHE:
-			cli = benchclient.NewRedisClusterByAddresses(strings.Split(opts.AddrList, ","), 0)
-		case CLIENT_EFS:
-			fallthrough
-		case CLIENT_FSX:
-			cli = benchclient.NewFile(opts.ClientLib, opts.ClientBase)
-		default:
-			addrArr := strings.Split(opts.AddrList, ",")
-			log.Println("number of hosts: ", len(addrArr))
-			ic := infinistore.NewClient(opts.Datashard, opts.Parityshard, opts.ECmaxgoroutine)
-			ic.Dial(addrArr)
-			cli = ic
+	}
+	if opts.JSONFile != "" {
+		if err := writeFile(opts.JSONFile, ret.WriteJSON); err != nil {
+			fmt.Fprintf(opts.Stderr, "Failed to write JSON result: %v\n", err)
 		}
-		defer cli.Close()
-		clis[i] = cli
-	}
-
-	tstart := time.Now()
-	for i := 0; i < opts.Clients; i++ {
-		crequests := rpc
-		//if i == opts.Clients-1 {
-		//	crequests += rpcex
-		//}
-		//val := make([]byte, 10485760)
-		val := make([]byte, opts.Objsz)
-		rand.Read(val)
-
-		go func(cli benchclient.Client, cid, crequests int) {
-			defer func() {
-				atomic.AddInt64(&remaining, -1)
-			}()
-			/*if conn == nil {
-			if cli == nil {
-				return
-			}*/
-			err := func() error {
-				//var buf []byte
-				//rd := bufio.NewReader(conn)
-				for i := 0; i < crequests; i += opts.Pipeline {
-					n := opts.Pipeline
-					if i+n > crequests {
-						n = crequests - i
-					}
-					key := genKey(opts.Keymin, opts.Keymax, opts.Op, i*opts.Clients+cid)
-					/*
-						buf = buf[:0]
-						for i := 0; i < n; i++ {
-							buf = fill(buf)
-						}
-						atomic.AddUint64(&totalPayload, uint64(len(buf)))
-					*/
-					start := time.Now()
-					if opts.Op == 0 {
-						atomic.AddUint64(&totalPayload, uint64(len(val)))
-						cli.EcSet(key, val)
-					} else {
-						_, reader, _ := cli.EcGet(key)
-						if reader != nil {
-							atomic.AddUint64(&totalPayload, uint64(reader.Len()))
-							reader.Close() // By closing the reader, we save memory.
-						}
-					}
-					/*if err != nil {
-						return err
-					}
-					if err := readResp(rd, n, opts); err != nil {
-						return err
-					}*/
-					stop := time.Since(start)
-					for j := 0; j < n; j++ {
-						durs[cid][i+j] = stop / time.Duration(n)
-					}
-					atomic.AddInt64(&duration, int64(stop))
-					atomic.AddUint64(&count, uint64(n))
-					atomic.StoreInt64(&tstop, int64(time.Since(tstart)))
-					if opts.Interval != 0 {
-						time.Sleep(time.Duration(opts.Interval) * time.Millisecond)
-					}
-				}
-				return nil
-			}()
-			if err != nil {
-				errs[cid] = err
-			}
-			//}(conns[i], i, crequests)
-		}(clis[i], i, crequests)
-	}
-	var die bool
-	for {
-		remaining := int(atomic.LoadInt64(&remaining))   // active clients
-		count := int(atomic.LoadUint64(&count))          // completed requests
-		real := time.Duration(atomic.LoadInt64(&tstop))  // real duration
-		totalPayload := atomic.LoadUint64(&totalPayload) // size of all bytes sent
-		more := remaining > 0
-		var realrps float64
-		if real > 0 {
-			realrps = float64(count) / (float64(real) / float64(time.Second))
+	}
+	if opts.SeriesFile != "" && opts.SeriesInterval > 0 {
+		if err := bench.WriteSeries(opts.SeriesFile, opts.SeriesFormat, ret.Series(opts.SeriesInterval)); err != nil {
+			fmt.Fprintf(opts.Stderr, "Failed to write time series: %v\n", err)
 		}
-		if !opts.CSV {
-			//fmt.Fprintf(opts.Stdout, "\r%s: %.2f", name, realrps)
-			fmt.Fprintf(opts.Stdout, "\r%.2f", realrps)
-			if more {
-				fmt.Fprintf(opts.Stdout, "\r")
-			} else if opts.Quiet {
-				fmt.Fprintf(opts.Stdout, " requests per second\n")
-			} else {
-				//fmt.Fprintf(opts.Stdout, "\r====== %s ======\n", name)
-				fmt.Fprintf(opts.Stdout, "  %d requests completed in %.2f seconds\n", count, float64(real)/float64(time.Second))
-				fmt.Fprintf(opts.Stdout, "  %d parallel clients\n", opts.Clients)
-				fmt.Fprintf(opts.Stdout, "  %s bytes per second\n", humanize.Bytes(uint64(float64(totalPayload)/(float64(real)/float64(time.Second)))))
-				fmt.Fprintf(opts.Stdout, "  keep alive: 1\n")
-				fmt.Fprintf(opts.Stdout, "\n")
-				var limit time.Duration
-				var lastper float64
-				for {
-					limit += time.Millisecond
-					var hits, count int
-					for i := 0; i < len(durs); i++ {
-						for j := 0; j < len(durs[i]); j++ {
-							dur := durs[i][j]
-							if dur == -1 {
-								continue
-							}
-							if dur < limit {
-								hits++
-							}
-							count++
-						}
-					}
-					per := float64(hits) / float64(count)
-					if math.Floor(per*10000) == math.Floor(lastper*10000) {
-						continue
-					}
-					lastper = per
-					fmt.Fprintf(opts.Stdout, "%.2f%% <= %d milliseconds\n", per*100, (limit-time.Millisecond)/time.Millisecond)
-					if per == 1.0 {
-						break
-					}
-				}
-				fmt.Fprintf(opts.Stdout, "%.2f requests per second\n\n", realrps)
-			}
+	}
+	if err != nil {
+		fmt.Fprintf(opts.Stderr, "%s\n", err)
+	}
+	return err
+}
+
+// newProgress returns the progress function that prints the throughput of the running benchmark.
+func newProgress(opts *Options, keyRange string) func(*bench.Progress) {
+	return func(progress *bench.Progress) {
+		if progress.Phase == bench.PHASE_LOAD {
+			fmt.Fprintf(opts.Stdout, "Loading %s...\n", keyRange)
+			return
+		} else if opts.CSV {
+			return
 		}
-		if !more {
-			if opts.CSV {
-				//fmt.Fprintf(opts.Stdout, "\"%s\",\"%.2f\"\n", name, realrps)
-				fmt.Fprintf(opts.Stdout, "\"%.2f\"\n", realrps)
-			}
-			for _, err := range errs {
-				if err != nil {
-					fmt.Fprintf(opts.Stderr, "%s\n", err)
-					die = true
-					if count == 0 {
-						break
-					}
+		fmt.Fprintf(opts.Stdout, "\r%.2f", progress.Throughput)
+		if opts.Rate > 0 {
+			fmt.Fprintf(opts.Stdout, " (backlog %d)  ", progress.Backlog)
+		}
+		fmt.Fprintf(opts.Stdout, "\r")
+	}
+}
+
+// printSummary prints the warnings and the result of a run in the format of the options.
+func printSummary(opts *Options, ret *bench.Result) {
+	for _, warning := range ret.Warnings {
+		fmt.Fprintf(opts.Stderr, "%s\n", warning)
+	}
+
+	if opts.CSV {
+		fmt.Fprintf(opts.Stdout, "\"%.2f\"", ret.Throughput)
+		if ret.Options.Op == bench.OP_MIXED {
+			for op := range bench.OpNames {
+				var throughput float64
+				if opRet := ret.Op(op); opRet != nil {
+					throughput = opRet.Throughput
 				}
+				fmt.Fprintf(opts.Stdout, ",\"%.2f\"", throughput)
 			}
-			break
 		}
-		time.Sleep(time.Second / 5)
+		fmt.Fprintf(opts.Stdout, "\n")
+	} else if opts.Quiet {
+		fmt.Fprintf(opts.Stdout, "\r%.2f requests per second\n", ret.Throughput)
+	} else {
+		printResult(opts.Stdout, ret)
 	}
+}
 
-	// close clients
-	/*
-		for i := 0; i < len(conns); i++ {
-			if conns[i] != nil {
-				conns[i].Close()
-			}
-		}*/
-	if die {
-		os.Exit(1)
+// printResult prints the summary of the result and the results of each operation.
+func printResult(w io.Writer, ret *bench.Result) {
+	opts := ret.Options
+	fmt.Fprintf(w, "\r%.2f", ret.Throughput)
+	fmt.Fprintf(w, "  %d requests completed in %.2f seconds\n", ret.Requests, ret.Duration)
+	if failed := ret.NotFound + ret.Failed; failed > 0 {
+		fmt.Fprintf(w, "  %d requests not found or failed\n", failed)
+	}
+	if ret.Timeouts > 0 && opts.Timeout > 0 {
+		fmt.Fprintf(w, "  %d requests timed out after %v\n", ret.Timeouts, opts.Timeout)
+	} else if ret.Timeouts > 0 {
+		fmt.Fprintf(w, "  %d requests timed out after %v per attempt\n", ret.Timeouts, opts.AttemptTimeout)
+	}
+	if opts.Attempts > 1 {
+		fmt.Fprintf(w, "  %d retries, up to %d attempts per request\n", ret.Retries, opts.Attempts)
 	}
+	if len(ret.Faults) > 0 {
+		faults := make([]string, 0, len(ret.Faults))
+		for fault, n := range ret.Faults {
+			faults = append(faults, fmt.Sprintf("%s %d", fault, n))
+		}
+		sort.Strings(faults)
+		fmt.Fprintf(w, "  injected faults: %s\n", strings.Join(faults, ", "))
+	}
+	fmt.Fprintf(w, "  %d parallel clients\n", opts.Clients)
+	fmt.Fprintf(w, "  %s bytes per second\n", humanize.Bytes(uint64(ret.BytesPerSecond)))
+	fmt.Fprintf(w, "  keep alive: 1\n")
+	fmt.Fprintf(w, "  seed: %d\n", ret.Seed)
+	if opts.Verify {
+		fmt.Fprintf(w, "  verify: %d GETs verified\n", ret.Verified)
+	}
+	if opts.Warmup > 0 || opts.Cooldown > 0 {
+		fmt.Fprintf(w, "  excluded %v warmup and %v cooldown\n", opts.Warmup, opts.Cooldown)
+	}
+	if ret.OpenLoop != nil {
+		fmt.Fprintf(w, "  open loop: %s arrivals at %.2f requests per second\n", ret.OpenLoop.Arrival, ret.OpenLoop.Rate)
+		fmt.Fprintf(w, "  max backlog: %d requests\n", ret.OpenLoop.MaxBacklog)
+		fmt.Fprintf(w, "  %d requests sent late, max delay %v\n", ret.OpenLoop.Late, time.Duration(ret.OpenLoop.MaxDelay*float64(time.Millisecond)))
+	}
+	fmt.Fprintf(w, "\n")
+	for op, name := range bench.OpNames {
+		opRet := ret.Op(op)
+		if opRet == nil {
+			continue
+		}
+		fmt.Fprintf(w, "====== %s ======\n", name)
+		fmt.Fprintf(w, "  %d requests completed\n", opRet.Requests)
+		printFailures(w, opRet)
+		fmt.Fprintf(w, "  %s bytes per second\n", humanize.Bytes(uint64(opRet.BytesPerSecond)))
+		fmt.Fprintf(w, "\n")
+		if opRet.Requests > 0 {
+			printLatency(w, opRet.Histogram)
+		}
+		fmt.Fprintf(w, "%.2f requests per second\n\n", opRet.Throughput)
+		if len(opRet.Sizes) > 0 {
+			printSizeBuckets(w, opRet, name)
+		}
+	}
+	fmt.Fprintf(w, "%.2f requests per second\n\n", ret.Throughput)
+}
+
+// printLatency prints the latency percentiles of the histogram.
+func printLatency(w io.Writer, hist *histogram.Histogram) {
+	latency := bench.Summarize(hist)
+	fmt.Fprintf(w, "  min %.3f, mean %.3f, stddev %.3f, max %.3f milliseconds\n", latency.Min, latency.Mean, latency.StdDev, latency.Max)
+	for _, p := range histogram.Percentiles {
+		fmt.Fprintf(w, "%.2f%% <= %.3f milliseconds\n", p, bench.ToMillis(hist.Percentile(p)))
+	}
+	fmt.Fprintf(w, "100.00%% <= %.3f milliseconds\n", latency.Max)
+}
+
+// printFailures prints the not-found and failed requests of the operation with their latencies.
+func printFailures(w io.Writer, ret *bench.OpResult) {
+	if ret.NotFoundHistogram != nil {
+		latency := bench.Summarize(ret.NotFoundHistogram)
+		fmt.Fprintf(w, "  %d requests not found, p50 %.3f, p99 %.3f, max %.3f milliseconds\n", latency.Count, latency.P50, latency.P99, latency.Max)
+	}
+	if ret.FailedHistogram != nil {
+		latency := bench.Summarize(ret.FailedHistogram)
+		fmt.Fprintf(w, "  %d requests failed, p50 %.3f, p99 %.3f, max %.3f milliseconds\n", latency.Count, latency.P50, latency.P99, latency.Max)
+		errs := make([]string, 0, len(ret.Errors))
+		for err := range ret.Errors {
+			errs = append(errs, err)
+		}
+		sort.Strings(errs)
+		for _, err := range errs {
+			fmt.Fprintf(w, "    %d %s\n", ret.Errors[err], err)
+		}
+	}
+	if ret.Timeouts > 0 {
+		fmt.Fprintf(w, "  %d requests timed out\n", ret.Timeouts)
+	}
+	if ret.RetryHistogram != nil {
+		latency := bench.Summarize(ret.RetryHistogram)
+		fmt.Fprintf(w, "  %d retries of %d requests, p50 %.3f, p99 %.3f, max %.3f milliseconds before the last attempt\n", ret.Retries, latency.Count, latency.P50, latency.P99, latency.Max)
+	}
+}
+
+// printSizeBuckets prints the results of the operation by size bucket.
+func printSizeBuckets(w io.Writer, ret *bench.OpResult, name string) {
+	for _, size := range ret.Sizes {
+		fmt.Fprintf(w, "  %s %s: %d requests, %.2f requests per second, p50 %.3f, p99 %.3f, max %.3f milliseconds\n",
+			name, size.Bucket, size.Latency.Count, size.Throughput, size.Latency.P50, size.Latency.P99, size.Latency.Max)
+	}
+	fmt.Fprintf(w, "\n")
+}
+
+// writeFile creates the file and writes to it with the write function.
+func writeFile(path string, write func(io.Writer) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return write(file)
 }
 
 // AppendCommand will append a Redis command to the byte slice and
@@ -404,25 +378,80 @@ func main() {
 	var printInfo bool
 	flag.BoolVar(&printInfo, "h", false, "help info?")
 
-	options := DefaultOptions
+	options := &Options{}
+	*options = *DefaultOptions
+	options.Options = *bench.DefaultOptions
 
 	flag.IntVar(&options.Requests, "n", 10, "Number of requests.")
 	flag.IntVar(&options.Clients, "c", 1, "Number of clients.")
 	flag.IntVar(&options.Keymin, "keymin", 1, "Start postfix of generated keys. Generated key will be in the form of key_[keymin] ~ key_[keymax].")
 	flag.IntVar(&options.Keymax, "keymax", 10, "End postfix of generated keys.")
-	flag.IntVar(&options.Objsz, "sz", 128, "Object size in bytes.")
-	flag.IntVar(&options.Op, "op", 0, "Operation flag: 0 - SET (load the data store); 1 - GET.")
-	flag.StringVar(&options.ClientLib, "cli", CLIENT_INFINICACHE, "Client library, support \"infinistore\", \"redis\", \"s3\", \"elasticache\", \"fsx\", and \"efs.\"")
+	flag.StringVar(&options.KeyDist, "keydist", bench.KEYDIST_UNIFORM, "Key distribution of GETs, and SETs in the mixed workload, support \"uniform\", \"sequential\", \"zipfian\", \"hotspot\", and \"latest.\" SETs of op 0 are always sequential.")
+	flag.Float64Var(&options.ZipfTheta, "zipf", 0.99, "Skew of the zipfian and latest key distributions.")
+	flag.Float64Var(&options.HotKeys, "hotkeys", 20, "Percentage of hot keys in the hotspot key distribution.")
+	flag.Float64Var(&options.HotOps, "hotops", 80, "Percentage of requests accessing hot keys in the hotspot key distribution.")
+	flag.IntVar(&options.Objsz, "sz", 128, "Object size in bytes. The median size if szdist is \"lognormal.\"")
+	flag.StringVar(&options.SizeDist, "szdist", bench.SZDIST_FIXED, "Object size distribution, support \"fixed\", \"uniform\", \"lognormal\", and \"empirical.\"")
+	flag.IntVar(&options.SizeMin, "szmin", 1, "Min object size in bytes. Ignore if szdist is not \"uniform\" or \"lognormal.\"")
+	flag.IntVar(&options.SizeMax, "szmax", 0, "Max object size in bytes. Caps sizes in the histogram if szdist is \"empirical.\"")
+	flag.Float64Var(&options.SizeSigma, "szsigma", 1, "Shape of the log-normal size distribution. Ignore if szdist is not \"lognormal.\"")
+	flag.StringVar(&options.SizeHist, "szhist", "", "Size histogram file generated by simulator/sizehist. Ignore if szdist is not \"empirical.\"")
+	flag.IntVar(&options.Op, "op", 0, "Operation flag: 0 - SET (load the data store); 1 - GET; 2 - MIXED (GET/SET mixed by -read).")
+	flag.IntVar(&options.ReadPercent, "read", 50, "Percentage of GETs in the mixed workload. Ignore if op is not 2.")
+	flag.BoolVar(&options.Load, "load", false, "Load the key range with SETs before running the benchmark.")
+	flag.StringVar(&options.ClientLib, "cli", bench.CLIENT_INFINICACHE, "Client library, support \"infinistore\", \"redis\", \"s3\", \"elasticache\", \"fsx\", and \"efs.\"")
 	flag.StringVar(&options.AddrList, "addrlist", "127.0.0.1:6378", "Server addresses.")
 	flag.IntVar(&options.Datashard, "d", 4, "Number of data shards for RS erasure coding. Ignore if cli is not \"infinistore.\"")
 	flag.IntVar(&options.Parityshard, "p", 2, "Number of parity shards for RS erasure coding. Ignore if cli is not \"infinistore.\"")
 	flag.IntVar(&options.ECmaxgoroutine, "g", 32, "Max number of goroutines for RS erasure coding. Ignore if cli is not \"infinistore.\"")
 	flag.StringVar(&options.Bucket, "bucket", "", "S3 bucket name. Ignore if cli is not \"s3.\"")
-	flag.StringVar(&options.ClientBase, "cli-base", "", "Base path for file based client.")
-	flag.IntVar(&options.Pipeline, "pipeline", 1, "Number of pipelined requests")
+	flag.StringVar(&options.ClientBase, "cli-base", "", "Base path for file based client, the working directory if empty.")
+	flag.DurationVar(&options.Timeout, "timeout", 0, "Deadline of each request, e.g. \"500ms\", or of each pipeline of requests. Requests that exceed the deadline are canceled and reported as timeouts. 0 for no deadline.")
+	flag.IntVar(&options.Attempts, "attempts", 1, "Max attempts of each request including retries, 1 for no retry. -timeout covers all attempts and backoffs.")
+	flag.DurationVar(&options.Backoff, "backoff", 10*time.Millisecond, "Backoff before the first retry, multiplied by -backoff-factor per retry.")
+	flag.DurationVar(&options.MaxBackoff, "backoff-max", time.Second, "Max backoff between retries, 0 for no cap.")
+	flag.Float64Var(&options.BackoffFactor, "backoff-factor", 2, "Multiplier of the backoff per retry.")
+	flag.Float64Var(&options.Jitter, "jitter", 0.5, "Fraction of each backoff randomized, from 0 for no jitter to 1 for full jitter.")
+	flag.StringVar(&options.RetryOn, "retry-on", "error,timeout", "Results to retry, support \"error\", \"timeout\", and \"notfound.\"")
+	flag.DurationVar(&options.AttemptTimeout, "attempt-timeout", 0, "Deadline of each attempt, e.g. \"100ms.\" Attempts that exceed the deadline are canceled and retried if timeouts are retried. 0 for no deadline other than -timeout. InfiniStore requests can not be canceled, so the next attempt waits for the abandoned one.")
+	flag.StringVar(&options.Faults, "faults", "", "Faults injected into requests after loading, separated by \";\" in the form of \"[op.]kind[:arg...]=rate[%][@from..to],\" e.g. \"error=30%@5m..10m;get.latency:exp:20ms=100.\" Kinds are \"latency\", \"error\", \"notfound\", \"stall\", \"truncate\", and \"corrupt.\"")
+	flag.StringVar(&options.DSN, "dsn", "", "DSN of the backend, e.g. \"redis://127.0.0.1:6379/0?pool=4\" or \"s3://bucket?region=us-west-2.\" Overrides -cli, -addrlist, -bucket, -cli-base, -d, -p, and -g. See the README for schemes.")
+	flag.IntVar(&options.Pipeline, "pipeline", 1, "Number of pipelined requests. Ignore if the client does not support batching, e.g. \"infinistore.\"")
 	flag.BoolVar(&options.Printlog, "log", true, "Print debugging log.")
 	flag.StringVar(&options.File, "file", "", "Print result to file.")
+	flag.StringVar(&options.ScenarioFile, "scenario", "", "Run phases in the scenario file in JSON or YAML. Other options are used as defaults of phases.")
+	flag.StringVar(&options.Sweep, "sweep", "", "Options to sweep in the form of \"name=v1,v2;name=from..to[:step|*factor]\", e.g. \"objsz=1024..1048576*4;clients=1,4,16.\" Names are fields of bench.Options in any case.")
+	flag.StringVar(&options.SweepMode, "sweep-mode", bench.SWEEP_PRODUCT, "Combine swept values, support \"product\" (all combinations) and \"zip\" (the i-th values together).")
+	flag.StringVar(&options.Backends, "backends", "", "Run the identical workload against backends in turn and compare them side by side. Backends are in the form of \"[name:]cli[=target];...\", e.g. \"redis=127.0.0.1:6379;efs=/mnt/efs\", or of \"[name=]dsn;...\". The target is the server addresses, the S3 bucket, or the base path of file clients.")
+	flag.StringVar(&options.Coordinator, "coordinator", "", "Listen on the address, e.g. \":7100\", for -workers workers, and run the workload on all workers from a synchronized start. The key range is partitioned among workers, and the target rate is shared.")
+	flag.IntVar(&options.Workers, "workers", 1, "Number of workers to wait for. Ignore if -coordinator is not set.")
+	flag.StringVar(&options.Worker, "worker", "", "Connect to the coordinator at the address and run the workload it assigns. Options of the workload are ignored.")
+	flag.StringVar(&options.WorkerName, "worker-name", "", "Name of the worker in results, defaults to host/pid.")
+	flag.StringVar(&options.TableFormat, "table-format", bench.TABLE_MARKDOWN, "Format of the sweep or backends table, support \"csv\", \"json\", and \"md.\"")
+	flag.StringVar(&options.TableFile, "table-out", "", "Write the sweep or backends table to the file instead of stdout.")
+	flag.StringVar(&options.Ramp, "ramp", "", "Step up the load until the latency or the error rate breaks the SLO, and report the knee. Support \"clients\" and \"rate\" (open-loop).")
+	flag.Float64Var(&options.RampStart, "ramp-start", 1, "Load of the first step of the ramp.")
+	flag.Float64Var(&options.RampStep, "ramp-step", 0, "Increment of the load per step of the ramp. The load is multiplied by -ramp-factor if 0.")
+	flag.Float64Var(&options.RampFactor, "ramp-factor", 2, "Multiplier of the load per step of the ramp. Ignore if -ramp-step is set.")
+	flag.Float64Var(&options.RampMax, "ramp-max", 0, "Max load of the ramp. The ramp stops after 20 steps if 0.")
+	flag.IntVar(&options.RampRefine, "ramp-refine", 3, "Number of steps to bisect between the last good load and the first bad load.")
+	flag.DurationVar(&options.SLO, "slo", 0, "Latency objective of the ramp, e.g. \"10ms.\"")
+	flag.Float64Var(&options.SLOPercentile, "slo-percentile", 99, "Percentile of the latency objective.")
+	flag.Float64Var(&options.SLOErrors, "slo-errors", 1, "Max percentage of failed requests of the ramp. Not-found requests are not counted.")
+	flag.StringVar(&options.JSONFile, "json", "", "Write the full result, including options, environment, counters and latency histograms, to the file in JSON format.")
+	flag.StringVar(&options.HistFile, "hist", "", "Export latency histograms to the file in csv format.")
+	flag.StringVar(&options.SeriesFile, "series", "", "Write the time series of throughput, errors and latency percentiles of the whole run to the file.")
+	flag.StringVar(&options.SeriesFormat, "series-format", bench.SERIES_CSV, "Format of the time series, support \"csv\" and \"jsonl.\"")
+	flag.DurationVar(&options.SeriesInterval, "series-interval", time.Second, "Interval of rows in the time series.")
 	flag.Int64Var(&options.Interval, "i", 0, "Interval for every req (ms)")
+	flag.BoolVar(&options.Verify, "verify", false, "Embed the key, version and checksum in each object and validate every GET. Mismatches are reported as failed requests.")
+	flag.IntVar(&options.MaxErrors, "maxerr", 0, "Abort the benchmark if more than the number of requests failed. 0 for unlimited. Not-found requests are not counted.")
+	flag.DurationVar(&options.Duration, "duration", 0, "Run for the duration, e.g. \"5m\", instead of -n requests per client.")
+	flag.DurationVar(&options.Warmup, "warmup", 0, "Exclude requests in the warmup window at the start of the run from the results.")
+	flag.DurationVar(&options.Cooldown, "cooldown", 0, "Exclude requests in the cooldown window at the end of the run from the results.")
+	flag.Float64Var(&options.Rate, "rate", 0, "Target aggregate request rate in requests per second. Set to enable the open-loop mode, in which -i and -pipeline are ignored.")
+	flag.StringVar(&options.Arrival, "arrival", bench.ARRIVAL_CONSTANT, "Arrival of requests in the open-loop mode, support \"constant\" and \"poisson.\"")
+	flag.Int64Var(&options.Seed, "seed", 0, "Seed of keys, sizes, operations and arrivals. Runs with the same seed send the same requests. 0 for a random seed.")
 
 	flag.Parse()
 
@@ -444,17 +473,28 @@ func main() {
 		}
 	}
 
+	if !options.Printlog {
+		log.SetOutput(ioutil.Discard)
+	}
+
+	// Stop the benchmark on interrupt and print the result of completed requests.
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
 	fmt.Println("Starting test...")
-	Bench(options)
+	err := Bench(ctx, options)
 
 	if options.File != "" {
 		if err := nanolog.Flush(); err != nil {
 			fmt.Printf("Failed to collect data: %v\n", err)
 		}
 	}
+	if err != nil {
+		os.Exit(1)
+	}
 }
 
-//logCreate create the nanoLog
+// logCreate create the nanoLog
 func logCreate(opts *Options) {
 	// Set up nanoLog writer
 	path := opts.File + "_" + strconv.Itoa(opts.Op) + "_bench.clog"
@@ -466,4 +506,7 @@ func logCreate(opts *Options) {
 	if err != nil {
 		panic(err)
 	}
+	// Log all requests, including requests in the warmup and cooldown windows.
+	benchclient.SetLogger(nanolog.Log)
+	infinistore.SetLogger(nanolog.Log)
 }
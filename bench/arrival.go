@@ -0,0 +1,51 @@
+package bench
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+const (
+	ARRIVAL_CONSTANT = "constant"
+	ARRIVAL_POISSON  = "poisson"
+)
+
+var (
+	ErrInvalidRate = errors.New("target rate must be positive")
+)
+
+// Schedule holds the intended send times of requests in the open-loop mode, relative to the start of the benchmark.
+type Schedule []time.Duration
+
+// NewSchedule generates the intended send times of n requests at the target aggregate rate in requests per second.
+func NewSchedule(arrival string, rate float64, n int, seed int64) (Schedule, error) {
+	if rate <= 0 {
+		return nil, ErrInvalidRate
+	}
+
+	schedule := make(Schedule, n)
+	switch arrival {
+	case "", ARRIVAL_CONSTANT:
+		for i := range schedule {
+			schedule[i] = time.Duration(float64(i) / rate * float64(time.Second))
+		}
+	case ARRIVAL_POISSON:
+		rnd := rand.New(rand.NewSource(seed))
+		var next float64
+		for i := range schedule {
+			schedule[i] = time.Duration(next * float64(time.Second))
+			next += rnd.ExpFloat64() / rate
+		}
+	default:
+		return nil, fmt.Errorf("unsupported arrival: %s", arrival)
+	}
+	return schedule, nil
+}
+
+// Due returns the number of requests that should have been sent by the elapsed time.
+func (s Schedule) Due(elapsed time.Duration) int {
+	return sort.Search(len(s), func(i int) bool { return s[i] > elapsed })
+}
@@ -0,0 +1,95 @@
+package bench
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewSchedule(t *testing.T) {
+	schedule, err := NewSchedule(ARRIVAL_CONSTANT, 4, 5, 1)
+	expect := Schedule{0, 250 * time.Millisecond, 500 * time.Millisecond, 750 * time.Millisecond, time.Second}
+	if err != nil || !reflect.DeepEqual(schedule, expect) {
+		t.Fatalf("expect %v, got %v, %v", expect, schedule, err)
+	}
+	if schedule, _ := NewSchedule("", 4, 5, 1); !reflect.DeepEqual(schedule, expect) {
+		t.Fatalf("expect the constant arrival by default, got %v", schedule)
+	}
+
+	// Gaps of the Poisson arrival are exponential with the mean of 1/rate.
+	const rate, n = 1000, 100000
+	schedule, err = NewSchedule(ARRIVAL_POISSON, rate, n, 1)
+	if err != nil {
+		t.Fatal(err)
+	} else if schedule[0] != 0 {
+		t.Fatalf("expect the first request at 0, got %v", schedule[0])
+	}
+	var sum, sumsq float64
+	for i := 1; i < n; i++ {
+		gap := (schedule[i] - schedule[i-1]).Seconds()
+		if gap < 0 {
+			t.Fatalf("request %d is scheduled before the last request", i)
+		}
+		sum += gap
+		sumsq += gap * gap
+	}
+	mean := sum / (n - 1)
+	stddev := math.Sqrt(sumsq/(n-1) - mean*mean)
+	if math.Abs(mean*rate-1) > 0.02 || math.Abs(stddev*rate-1) > 0.02 {
+		t.Fatalf("expect gaps of the mean and the stddev of 1ms, got %v and %v", mean, stddev)
+	}
+	if again, _ := NewSchedule(ARRIVAL_POISSON, rate, n, 1); !reflect.DeepEqual(again, schedule) {
+		t.Fatal("expect the same schedule of the same seed")
+	} else if other, _ := NewSchedule(ARRIVAL_POISSON, rate, n, 2); reflect.DeepEqual(other, schedule) {
+		t.Fatal("expect different schedules of different seeds")
+	}
+
+	if _, err := NewSchedule(ARRIVAL_CONSTANT, 0, 1, 1); err != ErrInvalidRate {
+		t.Fatalf("expect %v, got %v", ErrInvalidRate, err)
+	} else if _, err := NewSchedule("burst", 1, 1, 1); err == nil {
+		t.Fatal("expect an error of the unsupported arrival")
+	}
+}
+
+func TestScheduleDue(t *testing.T) {
+	schedule, _ := NewSchedule(ARRIVAL_CONSTANT, 10, 5, 1)
+	for _, c := range []struct {
+		elapsed time.Duration
+		due     int
+	}{
+		{0, 1},
+		{99 * time.Millisecond, 1},
+		{100 * time.Millisecond, 2},
+		{250 * time.Millisecond, 3},
+		{time.Hour, 5},
+	} {
+		if due := schedule.Due(c.elapsed); due != c.due {
+			t.Errorf("%v: expect %d due, got %d", c.elapsed, c.due, due)
+		}
+	}
+}
+
+func TestRunOpenLoop(t *testing.T) {
+	opts := testOptions()
+	opts.Rate, opts.Arrival, opts.Requests = 500, ARRIVAL_CONSTANT, 100
+	start := time.Now()
+	ret, err := Run(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 200 requests at 500 per second take 400ms.
+	if elapsed := time.Since(start); elapsed < 398*time.Millisecond {
+		t.Fatalf("expect the schedule to take 400ms, got %v", elapsed)
+	} else if ret.Requests != 200 || ret.OpenLoop == nil || ret.OpenLoop.Rate != 500 || ret.OpenLoop.Arrival != ARRIVAL_CONSTANT {
+		t.Fatalf("unexpected result of %d requests, open loop %+v", ret.Requests, ret.OpenLoop)
+	} else if ret.Throughput > 550 {
+		t.Fatalf("expect the throughput of about 500, got %.2f", ret.Throughput)
+	}
+
+	opts.Rate, opts.Arrival = 500, "burst"
+	if _, err := Run(context.Background(), opts); err == nil {
+		t.Fatal("expect an error of the unsupported arrival")
+	}
+}
@@ -0,0 +1,344 @@
+package bench
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ds2-lab/infinibench/benchclient"
+)
+
+var (
+	ErrInvalidBackend = errors.New("invalid backend")
+)
+
+// Backend is a storage backend to compare.
+type Backend struct {
+	Name      string // Unique name in the comparison, defaults to the client library.
+	ClientLib string
+	Target    string // Server addresses, the S3 bucket, or the base path of file clients. Defaults to the base options if empty.
+	DSN       string // DSN of the backend, overrides ClientLib and Target if set. ClientLib is the scheme of the DSN.
+}
+
+// Comparison runs an identical workload against backends in turn. All backends share the seed, so every client
+// sends the same keys, sizes and operations in the same order on every backend.
+type Comparison struct {
+	Backends []*Backend
+}
+
+// BackendResult is the result of a backend.
+type BackendResult struct {
+	Name      string  `json:"name"`
+	ClientLib string  `json:"clientlib"`
+	Target    string  `json:"target,omitempty"`
+	DSN       string  `json:"dsn,omitempty"` // Passwords are redacted.
+	Result    *Result `json:"result,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// ComparisonResult is the result of a comparison.
+type ComparisonResult struct {
+	Seed     int64            `json:"seed"`
+	Backends []*BackendResult `json:"backends"`
+}
+
+// BackendRow summarizes a backend in the table. Latencies are of successful requests of all operations in milliseconds.
+type BackendRow struct {
+	Backend        string            `json:"backend"`
+	Requests       uint64            `json:"requests"`
+	Throughput     float64           `json:"throughput"`
+	BytesPerSecond float64           `json:"bytes_per_second"`
+	NotFound       uint64            `json:"not_found"`
+	Failed         uint64            `json:"failed"`
+	Timeouts       uint64            `json:"timeouts"`
+	Retries        uint64            `json:"retries"`
+	ErrorRate      float64           `json:"error_rate"`
+	P50            float64           `json:"p50"`
+	P90            float64           `json:"p90"`
+	P99            float64           `json:"p99"`
+	P999           float64           `json:"p99.9"`
+	Max            float64           `json:"max"`
+	Errors         map[string]uint64 `json:"errors,omitempty"` // Failed requests of all operations by error.
+	Error          string            `json:"error,omitempty"`
+}
+
+var clientLibs = []string{CLIENT_INFINICACHE, CLIENT_REDIS, CLIENT_S3, CLIENT_ELASTICACHE, CLIENT_FSX, CLIENT_EFS}
+
+// ParseBackends parses backends in the form of "[name:]cli[=target];...", e.g. "redis=10.0.0.1:6379;efs=/mnt/efs;s3=bucket",
+// or of "[name=]dsn;...", e.g. "local=redis://127.0.0.1:6379;minio=s3://bucket?endpoint=http://127.0.0.1:9000".
+// Names are required to tell apart backends of the same client library or scheme.
+func ParseBackends(spec string) ([]*Backend, error) {
+	var backends []*Backend
+	names := make(map[string]bool)
+	for _, field := range strings.Split(spec, ";") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		backend := &Backend{}
+		kv := strings.SplitN(field, "=", 2)
+		if strings.Contains(kv[0], "://") {
+			backend.DSN = field
+		} else if len(kv) == 2 && strings.Contains(kv[1], "://") {
+			backend.Name, backend.DSN = strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		} else {
+			if len(kv) == 2 {
+				backend.Target = strings.TrimSpace(kv[1])
+			}
+			backend.ClientLib = strings.TrimSpace(kv[0])
+			if i := strings.Index(backend.ClientLib, ":"); i >= 0 {
+				backend.Name, backend.ClientLib = strings.TrimSpace(backend.ClientLib[:i]), strings.TrimSpace(backend.ClientLib[i+1:])
+			}
+		}
+		if backend.DSN != "" {
+			u, err := url.Parse(backend.DSN)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidBackend, err)
+			}
+			backend.ClientLib = u.Scheme
+		}
+		if backend.Name == "" {
+			backend.Name = backend.ClientLib
+		}
+		if err := backend.validate(); err != nil {
+			return nil, err
+		} else if names[backend.Name] {
+			return nil, fmt.Errorf("%w: duplicate name %s, name backends as \"name:cli=target\"", ErrInvalidBackend, backend.Name)
+		}
+		names[backend.Name] = true
+		backends = append(backends, backend)
+	}
+	if len(backends) == 0 {
+		return nil, fmt.Errorf("%w: no backend to compare", ErrInvalidBackend)
+	}
+	return backends, nil
+}
+
+func (b *Backend) validate() error {
+	if b.DSN != "" {
+		if _, err := benchclient.NewConstructor(b.DSN); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidBackend, err)
+		}
+		return nil
+	}
+	for _, lib := range clientLibs {
+		if b.ClientLib == lib {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: unsupported client library %s", ErrInvalidBackend, b.ClientLib)
+}
+
+// apply applies the DSN, or the client library and the target of the backend to the options.
+func (b *Backend) apply(opts *Options) {
+	opts.DSN = b.DSN
+	if b.DSN != "" {
+		return
+	}
+	opts.ClientLib = b.ClientLib
+	if b.Target == "" {
+		return
+	}
+	switch b.ClientLib {
+	case CLIENT_S3, CLIENT_FSX, CLIENT_EFS:
+		opts.ClientBase = b.Target
+	default:
+		opts.AddrList = b.Target
+	}
+}
+
+// redact hides the password in the DSN.
+func redact(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			return u.Redacted()
+		}
+	}
+	return dsn
+}
+
+// redactArg hides passwords in DSNs in the argument, e.g. "-dsn=dsn" or "name=dsn;name=dsn".
+func redactArg(arg string) string {
+	fields := strings.Split(arg, ";")
+	for i, field := range fields {
+		if j := strings.Index(field, "://"); j >= 0 {
+			start := strings.LastIndex(field[:j], "=") + 1
+			fields[i] = field[:start] + redact(field[start:])
+		}
+	}
+	return strings.Join(fields, ";")
+}
+
+// Run runs the base options against every backend in order. Each backend creates its own clients.
+// If the base options have no seed, a random seed is shared by all backends.
+// The report function, if set, is called on the completion of each backend. A failed backend does not
+// stop the comparison, but the comparison stops if the context is done.
+func (c *Comparison) Run(ctx context.Context, base *Options, report func(*BackendResult)) (*ComparisonResult, error) {
+	if len(c.Backends) == 0 {
+		return nil, fmt.Errorf("%w: no backend to compare", ErrInvalidBackend)
+	}
+	for _, backend := range c.Backends {
+		if err := backend.validate(); err != nil {
+			return nil, err
+		}
+	}
+	ret := &ComparisonResult{Seed: base.Seed}
+	if ret.Seed == 0 {
+		ret.Seed = time.Now().UnixNano()
+	}
+
+	for _, backend := range c.Backends {
+		opts := *base
+		opts.Seed = ret.Seed
+		backend.apply(&opts)
+		backendRet := &BackendResult{Name: backend.Name, ClientLib: backend.ClientLib, Target: backend.Target}
+		if backend.DSN != "" {
+			backendRet.DSN = redact(backend.DSN)
+		}
+		var err error
+		backendRet.Result, err = Run(ctx, &opts)
+		if err != nil {
+			backendRet.Error = err.Error()
+		}
+		ret.Backends = append(ret.Backends, backendRet)
+		if report != nil {
+			report(backendRet)
+		}
+		if ctx.Err() != nil {
+			return ret, ctx.Err()
+		}
+	}
+	return ret, nil
+}
+
+// Rows summarizes backends in the order of running.
+func (r *ComparisonResult) Rows() []*BackendRow {
+	rows := make([]*BackendRow, len(r.Backends))
+	for i, backend := range r.Backends {
+		row := &BackendRow{Backend: backend.Name, Error: backend.Error}
+		if ret := backend.Result; ret != nil {
+			latency := ret.Latency()
+			row.Requests, row.Throughput, row.BytesPerSecond = ret.Requests, ret.Throughput, ret.BytesPerSecond
+			row.NotFound, row.Failed, row.Timeouts, row.ErrorRate = ret.NotFound, ret.Failed, ret.Timeouts, ret.ErrorRate()
+			row.Retries = ret.Retries
+			row.P50, row.P90, row.P99, row.P999, row.Max = latency.P50, latency.P90, latency.P99, latency.P999, latency.Max
+			for _, op := range ret.Ops {
+				for err, n := range op.Errors {
+					if row.Errors == nil {
+						row.Errors = make(map[string]uint64)
+					}
+					row.Errors[err] += n
+				}
+			}
+		}
+		rows[i] = row
+	}
+	return rows
+}
+
+// WriteTable writes backends side by side, one column per backend and one row per metric, in csv or markdown format.
+// Metrics of each operation follow the metrics of all operations. In JSON format, one object per backend is written.
+func (r *ComparisonResult) WriteTable(w io.Writer, format string) error {
+	rows := r.Rows()
+	if format == TABLE_JSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(rows)
+	}
+
+	header := make([]string, 0, len(rows)+1)
+	header = append(header, "metric")
+	for _, row := range rows {
+		header = append(header, row.Backend)
+	}
+	var lines [][]string
+	metric := func(name string, value func(i int) string) {
+		line := make([]string, 0, len(header))
+		line = append(line, name)
+		for i := range rows {
+			line = append(line, value(i))
+		}
+		lines = append(lines, line)
+	}
+	formatFloat := func(f float64, prec int) string { return strconv.FormatFloat(f, 'f', prec, 64) }
+
+	metric("requests", func(i int) string { return strconv.FormatUint(rows[i].Requests, 10) })
+	metric("throughput", func(i int) string { return formatFloat(rows[i].Throughput, 2) })
+	metric("bytes_per_second", func(i int) string { return formatFloat(rows[i].BytesPerSecond, 0) })
+	metric("p50", func(i int) string { return formatFloat(rows[i].P50, 3) })
+	metric("p90", func(i int) string { return formatFloat(rows[i].P90, 3) })
+	metric("p99", func(i int) string { return formatFloat(rows[i].P99, 3) })
+	metric("p99.9", func(i int) string { return formatFloat(rows[i].P999, 3) })
+	metric("max", func(i int) string { return formatFloat(rows[i].Max, 3) })
+	metric("not_found", func(i int) string { return strconv.FormatUint(rows[i].NotFound, 10) })
+	metric("failed", func(i int) string { return strconv.FormatUint(rows[i].Failed, 10) })
+	metric("timeouts", func(i int) string { return strconv.FormatUint(rows[i].Timeouts, 10) })
+	metric("retries", func(i int) string { return strconv.FormatUint(rows[i].Retries, 10) })
+	metric("error_rate", func(i int) string { return formatFloat(rows[i].ErrorRate, 2) })
+	for _, name := range OpNames {
+		op := func(i int) *OpResult {
+			if ret := r.Backends[i].Result; ret != nil && ret.Ops[name] != nil {
+				return ret.Ops[name]
+			}
+			return &OpResult{}
+		}
+		sent := false
+		for i := range rows {
+			sent = sent || op(i).Latency.Count+op(i).NotFound+op(i).Failed+op(i).Timeouts > 0
+		}
+		if !sent {
+			continue
+		}
+		metric(name+" throughput", func(i int) string { return formatFloat(op(i).Throughput, 2) })
+		metric(name+" p50", func(i int) string { return formatFloat(op(i).Latency.P50, 3) })
+		metric(name+" p99", func(i int) string { return formatFloat(op(i).Latency.P99, 3) })
+		metric(name+" failed", func(i int) string { return strconv.FormatUint(op(i).Failed, 10) })
+	}
+	metric("errors", func(i int) string { return formatErrors(rows[i].Errors) })
+	metric("error", func(i int) string { return rows[i].Error })
+
+	switch format {
+	case "", TABLE_CSV:
+		writer := csv.NewWriter(w)
+		writer.Write(header)
+		writer.WriteAll(lines)
+		return writer.Error()
+	case TABLE_MARKDOWN:
+		return writeMarkdown(w, header, lines)
+	default:
+		return fmt.Errorf("unsupported table format: %s", format)
+	}
+}
+
+// formatErrors formats failed requests by error in descending order of counts, e.g. "3 timeout; 1 EOF".
+func formatErrors(errs map[string]uint64) string {
+	names := make([]string, 0, len(errs))
+	for err := range errs {
+		names = append(names, err)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if errs[names[i]] != errs[names[j]] {
+			return errs[names[i]] > errs[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	for i, err := range names {
+		names[i] = fmt.Sprintf("%d %s", errs[err], err)
+	}
+	return strings.Join(names, "; ")
+}
+
+// WriteJSON writes the result, including results of all backends, in JSON format.
+func (r *ComparisonResult) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
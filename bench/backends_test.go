@@ -0,0 +1,130 @@
+package bench
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseBackends(t *testing.T) {
+	backends, err := ParseBackends(" redis=10.0.0.1:6379; fast : efs = /mnt/efs;s3;" +
+		"local=redis://:secret@127.0.0.1:6379;dummy://?ns=compare;minio=s3://bucket?endpoint=http://127.0.0.1:9000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []*Backend{
+		{Name: "redis", ClientLib: CLIENT_REDIS, Target: "10.0.0.1:6379"},
+		{Name: "fast", ClientLib: CLIENT_EFS, Target: "/mnt/efs"},
+		{Name: "s3", ClientLib: CLIENT_S3},
+		{Name: "local", ClientLib: "redis", DSN: "redis://:secret@127.0.0.1:6379"},
+		{Name: "dummy", ClientLib: "dummy", DSN: "dummy://?ns=compare"},
+		{Name: "minio", ClientLib: "s3", DSN: "s3://bucket?endpoint=http://127.0.0.1:9000"},
+	}
+	if !reflect.DeepEqual(backends, expect) {
+		for i := range backends {
+			t.Logf("%+v", backends[i])
+		}
+		t.Fatal("unexpected backends")
+	}
+
+	for _, spec := range []string{"", " ; ", "memcached=127.0.0.1:11211", "redis;redis", "redis=a;redis=b",
+		"dummy://;dummy://", "nothing://", "bad=dummy://?type=nothing", "redis://%zz"} {
+		if _, err := ParseBackends(spec); !errors.Is(err, ErrInvalidBackend) {
+			t.Errorf("%q: expect %v, got %v", spec, ErrInvalidBackend, err)
+		}
+	}
+}
+
+func TestBackendApply(t *testing.T) {
+	for _, c := range []struct {
+		backend                        *Backend
+		clientLib, addrList, base, dsn string
+	}{
+		{&Backend{ClientLib: CLIENT_REDIS, Target: "10.0.0.1:6379"}, CLIENT_REDIS, "10.0.0.1:6379", "", ""},
+		{&Backend{ClientLib: CLIENT_EFS, Target: "/mnt/efs"}, CLIENT_EFS, DefaultOptions.AddrList, "/mnt/efs", ""},
+		{&Backend{ClientLib: CLIENT_S3}, CLIENT_S3, DefaultOptions.AddrList, "", ""},
+		{&Backend{ClientLib: "dummy", DSN: "dummy://"}, DefaultOptions.ClientLib, DefaultOptions.AddrList, "", "dummy://"},
+	} {
+		opts := *DefaultOptions
+		c.backend.apply(&opts)
+		if opts.ClientLib != c.clientLib || opts.AddrList != c.addrList || opts.ClientBase != c.base || opts.DSN != c.dsn {
+			t.Errorf("%+v: unexpected options %s, %s, %s, %s", c.backend, opts.ClientLib, opts.AddrList, opts.ClientBase, opts.DSN)
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	for _, c := range []struct{ arg, expect string }{
+		{"-c=4", "-c=4"},
+		{"redis://127.0.0.1:6379", "redis://127.0.0.1:6379"},
+		{"redis://user@127.0.0.1:6379", "redis://user@127.0.0.1:6379"},
+		{"-dsn=redis://:secret@127.0.0.1:6379/1", "-dsn=redis://:xxxxx@127.0.0.1:6379/1"},
+		{"a=redis://u:p@h:6379;b=dummy://;c=redis=h", "a=redis://u:xxxxx@h:6379;b=dummy://;c=redis=h"},
+	} {
+		if arg := redactArg(c.arg); arg != c.expect {
+			t.Errorf("%s: expect %s, got %s", c.arg, c.expect, arg)
+		}
+	}
+}
+
+func TestComparisonRun(t *testing.T) {
+	backends, err := ParseBackends("a=disttest://;b=disttest://?ns=compare")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := testOptions()
+	opts.Op, opts.ReadPercent = OP_MIXED, 50
+	recorder.Lock()
+	runs := len(recorder.runs)
+	recorder.Unlock()
+
+	var reported []string
+	ret, err := (&Comparison{Backends: backends}).Run(context.Background(), opts, func(backend *BackendResult) {
+		reported = append(reported, backend.Name)
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if ret.Seed == 0 || !reflect.DeepEqual(reported, []string{"a", "b"}) {
+		t.Fatalf("unexpected comparison of seed %d of backends %v", ret.Seed, reported)
+	}
+	for _, backend := range ret.Backends {
+		if backend.Error != "" || backend.Result == nil || backend.Result.Seed != ret.Seed {
+			t.Fatalf("backend %s: unexpected result %+v", backend.Name, backend)
+		}
+	}
+
+	// Backends receive the same keys. Validating DSNs records no keys.
+	var keys []map[string]bool
+	recorder.Lock()
+	for _, run := range recorder.runs[runs:] {
+		if len(run) > 0 {
+			keys = append(keys, run)
+		}
+	}
+	recorder.Unlock()
+	if len(keys) != 2 || !reflect.DeepEqual(keys[0], keys[1]) {
+		t.Fatalf("expect backends to receive the same keys, got %v", keys)
+	}
+
+	var buf bytes.Buffer
+	if err := ret.WriteTable(&buf, TABLE_CSV); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(buf.String(), "\n")
+	if lines[0] != "metric,a,b" || !strings.HasPrefix(lines[1], "requests,") {
+		t.Fatalf("unexpected table\n%s", buf.String())
+	}
+
+	if _, err := (&Comparison{}).Run(context.Background(), opts, nil); !errors.Is(err, ErrInvalidBackend) {
+		t.Fatalf("expect %v, got %v", ErrInvalidBackend, err)
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	if s := formatErrors(map[string]uint64{"EOF": 1, "timeout": 3, "reset": 1}); s != "3 timeout; 1 EOF; 1 reset" {
+		t.Fatalf("unexpected errors %s", s)
+	}
+}
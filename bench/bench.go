@@ -0,0 +1,964 @@
+// Package bench implements the workload engine of infinibench.
+//
+// Run drives concurrent clients against a storage backend according to the options, and returns
+// a Result that can be printed, exported, or compared with other runs.
+package bench
+
+// MIT License
+//
+// Copyright (c) 2023 DS2 Lab @ UVA
+// Copyright (c) 2017 Josh Baker (https://github.com/tidwall/redbench)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	infinistore "github.com/ds2-lab/infinistore/client"
+	"github.com/dustin/go-humanize"
+
+	"github.com/ds2-lab/infinibench/benchclient"
+	"github.com/ds2-lab/infinibench/histogram"
+)
+
+const (
+	CLIENT_INFINICACHE = "infinistore"
+	CLIENT_REDIS       = "redis"
+	CLIENT_S3          = "s3"
+	CLIENT_ELASTICACHE = "elasticache"
+	CLIENT_FSX         = "fsx"
+	CLIENT_EFS         = "efs"
+)
+
+const (
+	OP_SET   = 0
+	OP_GET   = 1
+	OP_MIXED = 2
+)
+
+const (
+	PHASE_LOAD = "load"
+	PHASE_RUN  = "run"
+)
+
+// OpNames are the names of operations indexed by OP_SET and OP_GET.
+var OpNames = []string{"SET", "GET"}
+
+var (
+	ErrErrorBudgetExceeded = errors.New("error budget exceeded")
+	ErrInvalidClients      = errors.New("number of clients must be at least 1, check -c")
+	ErrNoBucket            = errors.New("no S3 bucket, check -bucket")
+)
+
+// Random streams derived from the seed of a run. Each client draws from its own stream of each kind,
+// so runs with the same seed send the same requests in the same order per client.
+const (
+	seedKeys = iota
+	seedOps
+	seedLoad
+	seedData
+	seedFaults
+)
+
+// subSeed returns the seed of the stream of the client.
+func subSeed(seed int64, stream int, cid int) int64 {
+	return seed + int64(stream)<<32 + int64(cid)
+}
+
+// Options represents various options used by the Run() function.
+type Options struct {
+	AddrList       string
+	Bucket         string
+	Requests       int
+	Clients        int
+	Pipeline       int
+	Keymin         int
+	Keymax         int
+	KeyDist        string
+	ZipfTheta      float64
+	HotKeys        float64
+	HotOps         float64
+	Objsz          int
+	SizeDist       string
+	SizeMin        int
+	SizeMax        int
+	SizeSigma      float64
+	SizeHist       string
+	Datashard      int
+	Parityshard    int
+	ECmaxgoroutine int
+	Op             int
+	ReadPercent    int
+	Load           bool
+	MaxErrors      int
+	Verify         bool
+	Interval       int64
+	Duration       time.Duration
+	Warmup         time.Duration
+	Cooldown       time.Duration
+	Rate           float64
+	Arrival        string
+	Seed           int64         // Seed of keys, sizes, operations and arrivals, 0 for a random seed.
+	Timeout        time.Duration // Deadline of each request, or each pipeline of requests, 0 for no deadline.
+	Attempts       int           // Max attempts of each request including retries, 1 for no retry. The timeout covers all attempts.
+	Backoff        time.Duration // Backoff before the first retry.
+	MaxBackoff     time.Duration // Cap of backoffs, 0 for no cap.
+	BackoffFactor  float64       // Growth of backoffs per retry.
+	Jitter         float64       // Fraction of each backoff randomized in [0, 1].
+	RetryOn        string        // Results to retry, e.g. "error,timeout,notfound." See benchclient.ParseRetryOn.
+	AttemptTimeout time.Duration // Deadline of each attempt, 0 for no deadline other than Timeout.
+	Faults         string        // Faults injected into requests after loading, see benchclient.ParseFaults.
+	ClientLib      string
+	ClientBase     string
+	DSN            string // DSN of the backend, see benchclient.NewConstructor. Overrides ClientLib, AddrList, Bucket and ClientBase if set.
+
+	// Progress, if set, is called about 5 times per second while the benchmark is running.
+	Progress func(*Progress) `json:"-"`
+}
+
+// DefaultsOptions are the default options used by the Run() function.
+var DefaultOptions = &Options{
+	AddrList:       "127.0.0.1:6378",
+	Bucket:         "",
+	Requests:       15,
+	Clients:        1,
+	Pipeline:       1,
+	Keymin:         0,
+	Keymax:         99,
+	KeyDist:        KEYDIST_UNIFORM,
+	ZipfTheta:      0.99,
+	HotKeys:        20,
+	HotOps:         80,
+	Objsz:          10485760 * 4,
+	SizeDist:       SZDIST_FIXED,
+	SizeMin:        1,
+	SizeMax:        0,
+	SizeSigma:      1,
+	SizeHist:       "",
+	Datashard:      4,
+	Parityshard:    2,
+	ECmaxgoroutine: 32,
+	Op:             OP_SET, // 0: SET; 1: GET; 2: MIXED
+	ReadPercent:    50,
+	Load:           false,
+	MaxErrors:      0,
+	Verify:         false,
+	Interval:       0,
+	Duration:       0,
+	Warmup:         0,
+	Cooldown:       0,
+	Rate:           0,
+	Arrival:        ARRIVAL_CONSTANT,
+	Seed:           0,
+	Timeout:        0,
+	Attempts:       1,
+	Backoff:        10 * time.Millisecond,
+	MaxBackoff:     time.Second,
+	BackoffFactor:  2,
+	Jitter:         0.5,
+	RetryOn:        "error,timeout",
+	AttemptTimeout: 0,
+	Faults:         "",
+	ClientLib:      CLIENT_INFINICACHE,
+	ClientBase:     "",
+	DSN:            "",
+}
+
+// Progress reports the progress of a running benchmark.
+type Progress struct {
+	Phase      string        // PHASE_LOAD or PHASE_RUN.
+	Elapsed    time.Duration // Since the start of the run to the last completed request.
+	Requests   uint64        // Number of successful requests.
+	Bytes      uint64
+	Throughput float64 // Successful requests per second.
+	Clients    int     // Number of active clients.
+	Backlog    int     // Number of requests due but not sent yet in the open-loop mode.
+}
+
+// opStats collects the results of one type of operation.
+// Latencies of successful requests, not-found requests and failed requests are collected separately.
+// Requests timed out are counted apart from failed requests. Retries are counted for requests of all results.
+type opStats struct {
+	count        uint64 // Number of successful requests.
+	totalPayload uint64
+	latency      *histogram.Histogram
+	sizes        map[int]*histogram.Histogram // Latencies by size bucket.
+	notFound     *histogram.Histogram
+	failed       *histogram.Histogram
+	timeouts     uint64
+	retries      uint64
+	retried      *histogram.Histogram // Time spent on failed attempts and backoffs of retried requests.
+	errors       map[string]uint64    // Failed requests by error.
+}
+
+func newOpStats() []opStats {
+	stats := make([]opStats, len(OpNames))
+	for op := range stats {
+		stats[op].latency = histogram.New()
+		stats[op].sizes = make(map[int]*histogram.Histogram)
+		stats[op].notFound = histogram.New()
+		stats[op].failed = histogram.New()
+		stats[op].retried = histogram.New()
+		stats[op].errors = make(map[string]uint64)
+	}
+	return stats
+}
+
+func (s *opStats) add(r *result) {
+	if r.retries > 0 {
+		s.retries += uint64(r.retries)
+		s.retried.Record(int64(r.retryDur))
+	}
+	switch benchclient.ResultFromError(r.err) {
+	case benchclient.ResultNotFound:
+		s.notFound.Record(int64(r.dur))
+		return
+	case benchclient.ResultError:
+		s.failed.Record(int64(r.dur))
+		s.errors[errorType(r.err)]++
+		return
+	case benchclient.ResultTimeout:
+		s.timeouts++
+		return
+	}
+
+	s.count++
+	s.totalPayload += uint64(r.size)
+	s.latency.Record(int64(r.dur))
+	bucket := sizeBucket(r.size)
+	if s.sizes[bucket] == nil {
+		s.sizes[bucket] = histogram.New()
+	}
+	s.sizes[bucket].Record(int64(r.dur))
+}
+
+func (s *opStats) merge(o *opStats) {
+	s.count += o.count
+	s.totalPayload += o.totalPayload
+	s.latency.Merge(o.latency)
+	s.notFound.Merge(o.notFound)
+	s.failed.Merge(o.failed)
+	s.timeouts += o.timeouts
+	s.retries += o.retries
+	s.retried.Merge(o.retried)
+	for err, count := range o.errors {
+		s.errors[err] += count
+	}
+	for bucket, hist := range o.sizes {
+		if s.sizes[bucket] == nil {
+			s.sizes[bucket] = histogram.New()
+		}
+		s.sizes[bucket].Merge(hist)
+	}
+}
+
+// result is the result of one request.
+type result struct {
+	start time.Duration // Since the start of the benchmark.
+	end   time.Duration // Since the start of the benchmark.
+	dur   time.Duration
+	op    int
+	size  int
+	err   error
+
+	retries  int           // Attempts after the first one.
+	retryDur time.Duration // Time spent before the last attempt.
+}
+
+// measure collects the results in the measurement window [from, to], which excludes the warmup and cooldown windows.
+// Results are collected per client and per operation, and then merged.
+func measure(results [][]result, from time.Duration, to time.Duration) []opStats {
+	stats := newOpStats()
+	for i := 0; i < len(results); i++ {
+		client := newOpStats()
+		for j := 0; j < len(results[i]); j++ {
+			r := &results[i][j]
+			if r.start < from || r.end > to {
+				continue
+			}
+			client[r.op].add(r)
+		}
+		for op := range stats {
+			stats[op].merge(&client[op])
+		}
+	}
+	return stats
+}
+
+// errorType returns the type of the error for the error breakdown, which is the root cause of the error.
+func errorType(err error) string {
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code()
+	}
+	for cause := errors.Unwrap(err); cause != nil; cause = errors.Unwrap(err) {
+		err = cause
+	}
+	return err.Error()
+}
+
+// batch holds the requests sent together by a client. Requests in a batch are of the same operation.
+type batch struct {
+	offs     []int
+	keys     []string
+	vals     [][]byte
+	versions []uint64
+	readers  []infinistore.ReadAllCloser
+	errs     []error
+	attempts []int       // Attempts of each request, observed by clients with retries.
+	last     []time.Time // Start of the last attempt of each request.
+	sent     time.Time
+	cur      int // Index of the request sent alone.
+}
+
+func newBatch(size int) *batch {
+	return &batch{
+		offs:     make([]int, size),
+		keys:     make([]string, size),
+		vals:     make([][]byte, size),
+		versions: make([]uint64, size),
+		readers:  make([]infinistore.ReadAllCloser, size),
+		errs:     make([]error, size),
+		attempts: make([]int, size),
+		last:     make([]time.Time, size),
+	}
+}
+
+func (b *batch) reset(n int) {
+	b.offs, b.keys, b.vals, b.versions = b.offs[:n], b.keys[:n], b.vals[:n], b.versions[:n]
+	b.readers, b.errs, b.attempts, b.last = b.readers[:n], b.errs[:n], b.attempts[:n], b.last[:n]
+	for i := 0; i < n; i++ {
+		b.readers[i], b.errs[i], b.attempts[i] = nil, nil, 0
+	}
+}
+
+// observe records the attempt of a request in the batch.
+func (b *batch) observe(attempt *benchclient.Attempt) {
+	if i := b.cur + attempt.Index; i < len(b.attempts) {
+		b.attempts[i], b.last[i] = attempt.Attempt, attempt.Start
+	}
+}
+
+// retries returns the number of retries of the request and the time spent before its last attempt.
+func (b *batch) retries(i int) (int, time.Duration) {
+	if b.attempts[i] <= 1 {
+		return 0, 0
+	}
+	return b.attempts[i] - 1, b.last[i].Sub(b.sent)
+}
+
+// send sends the requests within the timeout. Requests will be pipelined if there are more than one.
+func (b *batch) send(cli benchclient.ContextClient, op int, timeout time.Duration) {
+	ctx, cancel := requestContext(timeout)
+	defer cancel()
+
+	b.sent, b.cur = time.Now(), 0
+	if bc, ok := cli.(benchclient.ContextBatchClient); ok && len(b.keys) > 1 {
+		if op == OP_SET {
+			_, errs := bc.EcMSetContext(ctx, b.keys, b.vals)
+			copy(b.errs, errs)
+		} else {
+			_, readers, errs := bc.EcMGetContext(ctx, b.keys)
+			copy(b.readers, readers)
+			copy(b.errs, errs)
+		}
+		return
+	} else if bc, ok := cli.(benchclient.BatchClient); ok && len(b.keys) > 1 {
+		if op == OP_SET {
+			_, errs := bc.EcMSet(b.keys, b.vals)
+			copy(b.errs, errs)
+		} else {
+			_, readers, errs := bc.EcMGet(b.keys)
+			copy(b.readers, readers)
+			copy(b.errs, errs)
+		}
+		return
+	}
+
+	for i, key := range b.keys {
+		b.cur = i
+		if op == OP_SET {
+			_, b.errs[i] = cli.EcSetContext(ctx, key, b.vals[i])
+		} else {
+			_, b.readers[i], b.errs[i] = cli.EcGetContext(ctx, key)
+		}
+	}
+}
+
+// requestContext returns the context of requests, which is done after the timeout if set.
+func requestContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(context.Background(), timeout)
+	}
+	return context.Background(), func() {}
+}
+
+// ClientDSN returns the DSN of the backend in the options. Without a DSN, it is built from the client library,
+// the server addresses, the bucket and the base path, which is the working directory if empty.
+func (opts *Options) ClientDSN() string {
+	if opts.DSN != "" {
+		return opts.DSN
+	}
+	switch opts.ClientLib {
+	case CLIENT_REDIS:
+		// Use 1 connection per concurrency.
+		return (&url.URL{Scheme: "redis", Host: opts.AddrList, Path: "/0", RawQuery: "pool=1"}).String()
+	case CLIENT_S3:
+		bucket := opts.ClientBase
+		if bucket == "" {
+			bucket = opts.Bucket
+		}
+		return (&url.URL{Scheme: "s3", Host: bucket}).String()
+	case CLIENT_ELASTICACHE:
+		return (&url.URL{Scheme: "rediscluster", Host: opts.AddrList}).String()
+	case CLIENT_EFS, CLIENT_FSX:
+		base := opts.ClientBase
+		if base == "" {
+			base = "."
+		}
+		return (&url.URL{Scheme: opts.ClientLib, Path: base}).String()
+	default:
+		query := url.Values{}
+		query.Set("d", strconv.Itoa(opts.Datashard))
+		query.Set("p", strconv.Itoa(opts.Parityshard))
+		query.Set("g", strconv.Itoa(opts.ECmaxgoroutine))
+		return (&url.URL{Scheme: "infinistore", Host: opts.AddrList, RawQuery: query.Encode()}).String()
+	}
+}
+
+// Validate returns an error if the options can not run.
+func (opts *Options) Validate() error {
+	if opts.Clients < 1 {
+		return ErrInvalidClients
+	} else if opts.DSN == "" && opts.ClientLib == CLIENT_S3 && opts.Bucket == "" && opts.ClientBase == "" {
+		return ErrNoBucket
+	}
+	return nil
+}
+
+// redacted returns a copy of the options with the password in the DSN hidden, which is kept in results.
+func (opts *Options) redacted() *Options {
+	ret := *opts
+	ret.DSN = redact(opts.DSN)
+	return &ret
+}
+
+// clientName returns the name of the backend in the options for messages.
+func (opts *Options) clientName() string {
+	if opts.DSN == "" {
+		return opts.ClientLib
+	}
+	if u, err := url.Parse(opts.DSN); err == nil {
+		return u.Scheme
+	}
+	return opts.DSN
+}
+
+// RetryPolicy returns the retry policy in the options, or nil if requests are not retried.
+func (opts *Options) RetryPolicy() (*benchclient.RetryPolicy, error) {
+	if opts.Attempts <= 1 {
+		return nil, nil
+	}
+	retryOn, err := benchclient.ParseRetryOn(opts.RetryOn)
+	if err != nil {
+		return nil, err
+	}
+	policy := &benchclient.RetryPolicy{
+		MaxAttempts:    opts.Attempts,
+		Backoff:        opts.Backoff,
+		MaxBackoff:     opts.MaxBackoff,
+		Multiplier:     opts.BackoffFactor,
+		Jitter:         opts.Jitter,
+		RetryOn:        retryOn,
+		AttemptTimeout: opts.AttemptTimeout,
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// NewClient creates a client of the backend in the options.
+func NewClient(opts *Options) (benchclient.Client, error) {
+	return benchclient.Open(opts.ClientDSN())
+}
+
+// load fills the key range with SETs before measuring. Keys are partitioned among clients.
+// In verify mode, the verifier builds payloads.
+func load(opts *Options, seed int64, space *KeySpace, sizes *SizeDistribution, verifier *Verifier, clis []benchclient.ContextClient, vals [][]byte) {
+	var wg sync.WaitGroup
+	for i := 0; i < len(clis); i++ {
+		wg.Add(1)
+		go func(cli benchclient.ContextClient, cid int) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(subSeed(seed, seedLoad, cid)))
+			for k := opts.Keymin + cid; k <= opts.Keymax; k += len(clis) {
+				key := space.Key(k)
+				data, version := vals[cid][:sizes.Next(rnd)], uint64(0)
+				if verifier != nil {
+					data, version = verifier.Encode(data, k-space.Min, key)
+				}
+				ctx, cancel := requestContext(opts.Timeout)
+				_, err := cli.EcSetContext(ctx, key, data)
+				cancel()
+				if err != nil {
+					log.Printf("failed to load %s: %v", key, err)
+				}
+				if verifier != nil && err != nil {
+					verifier.Fail(k-space.Min, version)
+					// The request may be abandoned but still reading the buffer, see benchclient.WithContext.
+					vals[cid] = append([]byte(nil), vals[cid]...)
+				} else if verifier != nil {
+					verifier.Ack(k-space.Min, version)
+				}
+			}
+		}(clis[i], i)
+	}
+	wg.Wait()
+}
+
+// Cleanup deletes the key range of the options. Keys are partitioned among clients.
+// It returns the number of keys deleted, keys not found are not counted.
+func Cleanup(ctx context.Context, opts *Options) (int, error) {
+	space, err := NewKeySpace(opts)
+	if err != nil {
+		return 0, err
+	}
+	clients := opts.Clients
+	if clients < 1 {
+		clients = 1
+	}
+
+	construct, err := benchclient.NewConstructor(opts.ClientDSN())
+	if err != nil {
+		return 0, err
+	}
+
+	var deleted int64
+	var wg sync.WaitGroup
+	errs := make([]error, clients)
+	for i := 0; i < clients; i++ {
+		cli := construct()
+		defer cli.Close()
+		deleter, ok := cli.(benchclient.Deleter)
+		if !ok {
+			return 0, fmt.Errorf("cleanup: %w by the %s client", benchclient.ErrNotSupported, opts.clientName())
+		}
+
+		wg.Add(1)
+		go func(cid int) {
+			defer wg.Done()
+			for k := opts.Keymin + cid; k <= opts.Keymax && ctx.Err() == nil; k += clients {
+				key := space.Key(k)
+				switch err := deleter.Delete(key); err {
+				case nil:
+					atomic.AddInt64(&deleted, 1)
+				case infinistore.ErrNotFound:
+				default:
+					errs[cid] = fmt.Errorf("cleanup %s: %w", key, err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return int(deleted), err
+	}
+	for _, err := range errs {
+		if err != nil {
+			return int(deleted), err
+		}
+	}
+	return int(deleted), nil
+}
+
+// sleep waits for the duration unless the context is done.
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// Run performs a benchmark with the options and returns the result of the measurement window.
+// The benchmark stops early if the context is done or the error budget is exceeded, in which case
+// the result of completed requests is returned with the error.
+func Run(ctx context.Context, opts *Options) (*Result, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	tbegin := time.Now()
+	seed := opts.Seed
+	if seed == 0 {
+		seed = tbegin.UnixNano()
+	}
+	space, err := NewKeySpace(opts)
+	if err != nil {
+		return nil, err
+	}
+	sizes, err := NewSizeDistribution(opts)
+	if err != nil {
+		return nil, err
+	}
+	construct, err := benchclient.NewConstructor(opts.ClientDSN())
+	if err != nil {
+		return nil, err
+	}
+	policy, err := opts.RetryPolicy()
+	if err != nil {
+		return nil, err
+	}
+	faults, err := benchclient.ParseFaults(opts.Faults)
+	if err != nil {
+		return nil, err
+	}
+	var injector *benchclient.FaultInjector
+	if len(faults) > 0 {
+		injector = benchclient.NewFaultInjector(faults, subSeed(seed, seedFaults, 0))
+	}
+	//rpc := opts.Requests / opts.Clients
+	//rpcex := opts.Requests % opts.Clients
+	rpc := opts.Requests
+	// In the open-loop mode, clients take requests from the schedule and latencies are measured from the intended send time.
+	var schedule Schedule
+	if opts.Rate > 0 {
+		total := rpc * opts.Clients
+		if opts.Duration > 0 {
+			total = int(opts.Rate * opts.Duration.Seconds())
+		}
+		schedule, err = NewSchedule(opts.Arrival, opts.Rate, total, seed)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// In verify mode, payloads carry the key, version and checksum, and every GET is validated.
+	var verifier *Verifier
+	var verified, unverified uint64
+	maxsz := sizes.Max()
+	if opts.Verify {
+		verifier = NewVerifier(space)
+		for _, off := range []int{0, space.Len() - 1} {
+			if overhead := PayloadOverhead(space.KeyAt(off)); maxsz < overhead {
+				maxsz = overhead
+			}
+		}
+	}
+	var warnings []string
+	if sizes.capped > 0 {
+		warnings = append(warnings, fmt.Sprintf("Sizes up to %s in the histogram are capped at %s, set -szmax to raise the cap.",
+			humanize.IBytes(uint64(sizes.capped)), humanize.IBytes(uint64(sizes.Max()))))
+	}
+	if buffers := uint64(maxsz) * uint64(opts.Clients); buffers > BUFFERS_WARNING {
+		warnings = append(warnings, fmt.Sprintf("%d clients hold %s of buffers of objects up to %s, cap sizes with -szmax.",
+			opts.Clients, humanize.IBytes(buffers), humanize.IBytes(uint64(maxsz))))
+	}
+	var totalPayload uint64
+	var count uint64
+	var dispatched, started int64
+	var failures uint64
+	var aborted int32
+	var late uint64
+	var maxDelay int64
+	var maxBacklog int
+	var tstop int64
+	remaining := int64(opts.Clients)
+	errs := make([]error, opts.Clients)
+	results := make([][]result, opts.Clients)
+	clis := make([]benchclient.ContextClient, opts.Clients)
+	batches := make([]*batch, opts.Clients) // Batches in flight, to which attempts are reported.
+	vals := make([][]byte, opts.Clients)
+
+	// create all clients
+	for i := 0; i < opts.Clients; i++ {
+		results[i] = make([]result, 0, rpc)
+		cli := benchclient.WithContext(construct())
+		if injector != nil {
+			// Retries see injected faults.
+			cli = benchclient.WithFaults(cli, injector, i)
+		}
+		if policy != nil {
+			cid := i
+			cli = benchclient.WithRetry(cli, policy, func(attempt *benchclient.Attempt) {
+				// Attempts are reported in the goroutine of the client, and batches are not set while loading.
+				if b := batches[cid]; b != nil {
+					b.observe(attempt)
+				}
+			})
+		}
+		defer cli.Close()
+		clis[i] = cli
+
+		vals[i] = make([]byte, maxsz)
+		rand.New(rand.NewSource(subSeed(seed, seedData, i))).Read(vals[i])
+	}
+
+	// Requests are pipelined by clients that support batching only.
+	pipeline := opts.Pipeline
+	if _, ok := clis[0].(benchclient.BatchClient); pipeline > 1 && !ok {
+		warnings = append(warnings, fmt.Sprintf("Pipelining is not supported by the %s client, send requests one by one.", opts.clientName()))
+		pipeline = 1
+	} else if pipeline < 1 {
+		pipeline = 1
+	}
+
+	// load the key range if required
+	if opts.Load {
+		if opts.Progress != nil {
+			opts.Progress(&Progress{Phase: PHASE_LOAD, Clients: opts.Clients})
+		}
+		load(opts, seed, space, sizes, verifier, clis, vals)
+	}
+
+	tstart := time.Now()
+	if injector != nil {
+		injector.Start()
+	}
+	for i := 0; i < opts.Clients; i++ {
+		crequests := rpc
+		go func(cli benchclient.ContextClient, cid, crequests int, val []byte, keys *KeyGenerator) {
+			defer func() {
+				atomic.AddInt64(&remaining, -1)
+			}()
+			rnd := rand.New(rand.NewSource(subSeed(seed, seedOps, cid)))
+			size := sizes.Max()
+			reqs := newBatch(pipeline)
+			batches[cid] = reqs
+			// Requests in a batch share the buffer, unless payloads are built in verify mode.
+			bufs := make([][]byte, pipeline)
+			for j := range bufs {
+				bufs[j] = val
+				if j > 0 && verifier != nil {
+					bufs[j] = make([]byte, len(val))
+					rnd.Read(bufs[j])
+				}
+			}
+			errs[cid] = func() error {
+				for i := 0; schedule != nil || opts.Duration > 0 || i < crequests; i += pipeline {
+					n := pipeline
+					var intended time.Time
+					if atomic.LoadInt32(&aborted) != 0 {
+						break
+					}
+					if schedule == nil {
+						if opts.Duration > 0 {
+							// Time-bounded run.
+							if time.Since(tstart) >= opts.Duration {
+								break
+							}
+						} else if i+n > crequests {
+							n = crequests - i
+						}
+					} else {
+						// Take the next request from the schedule and wait for its send time.
+						seq := int(atomic.AddInt64(&dispatched, 1) - 1)
+						if seq >= len(schedule) {
+							break
+						}
+						n = 1
+						intended = tstart.Add(schedule[seq])
+						if wait := time.Until(intended); wait > 0 {
+							sleep(ctx, wait)
+							if ctx.Err() != nil {
+								break
+							}
+						} else if delay := int64(-wait); delay > int64(time.Millisecond) {
+							atomic.AddUint64(&late, 1)
+							for max := atomic.LoadInt64(&maxDelay); delay > max && !atomic.CompareAndSwapInt64(&maxDelay, max, delay); max = atomic.LoadInt64(&maxDelay) {
+							}
+						}
+						atomic.AddInt64(&started, 1)
+					}
+					op := opts.Op
+					if op == OP_MIXED {
+						op = OP_SET
+						if rnd.Intn(100) < opts.ReadPercent {
+							op = OP_GET
+						}
+					}
+					reqs.reset(n)
+					for j := 0; j < n; j++ {
+						reqs.offs[j] = keys.NextOffset(op, opts.Op == OP_MIXED)
+						reqs.keys[j] = space.KeyAt(reqs.offs[j])
+						if op == OP_SET {
+							size = sizes.Next(rnd)
+							reqs.vals[j] = bufs[j][:size]
+							if verifier != nil {
+								reqs.vals[j], reqs.versions[j] = verifier.Encode(reqs.vals[j], reqs.offs[j], reqs.keys[j])
+							}
+						} else if verifier != nil {
+							reqs.versions[j] = verifier.Acked(reqs.offs[j])
+						}
+					}
+					start := time.Now()
+					if !intended.IsZero() {
+						start = intended
+					}
+					reqs.send(cli, op, opts.Timeout)
+					stop := time.Since(start)
+					end := time.Since(tstart)
+					for last := atomic.LoadInt64(&tstop); int64(end) > last && !atomic.CompareAndSwapInt64(&tstop, last, int64(end)); last = atomic.LoadInt64(&tstop) {
+					}
+					var exceeded bool // The error budget is exceeded by the batch.
+					var budgetErr error
+					for j := 0; j < n; j++ {
+						err := reqs.errs[j]
+						var payload uint64
+						if op == OP_SET {
+							payload = uint64(len(reqs.vals[j]))
+							if verifier != nil && err != nil {
+								verifier.Fail(reqs.offs[j], reqs.versions[j])
+								// The request may be abandoned but still reading the buffer, see benchclient.WithContext.
+								bufs[j] = append([]byte(nil), bufs[j]...)
+							} else if verifier != nil {
+								verifier.Ack(reqs.offs[j], reqs.versions[j])
+							}
+						} else if reader := reqs.readers[j]; reader != nil {
+							payload = uint64(reader.Len())
+							if verifier != nil {
+								var data []byte
+								if data, err = reader.ReadAll(); errors.Is(err, benchclient.ErrNotSupported) {
+									// Readers of backends like dummy carry no data.
+									err = nil
+									atomic.AddUint64(&unverified, 1)
+								} else if err == nil {
+									if err = verifier.Verify(data, reqs.keys[j], reqs.versions[j]); err == nil {
+										atomic.AddUint64(&verified, 1)
+									}
+								}
+							}
+							reader.Close() // By closing the reader, we save memory.
+						}
+						// Requests sent together share the latency of the batch.
+						r := result{start: start.Sub(tstart), end: end, dur: stop, op: op, size: int(payload), err: err}
+						r.retries, r.retryDur = reqs.retries(j)
+						results[cid] = append(results[cid], r)
+						if result := benchclient.ResultFromError(err); result == benchclient.ResultError || result == benchclient.ResultTimeout {
+							// Abort all clients if the error budget is exceeded, after results of the batch are recorded.
+							if failures := atomic.AddUint64(&failures, 1); opts.MaxErrors > 0 && failures > uint64(opts.MaxErrors) && !exceeded {
+								exceeded = true
+								if atomic.CompareAndSwapInt32(&aborted, 0, 1) {
+									budgetErr = fmt.Errorf("%w: %d requests failed, last error: %v", ErrErrorBudgetExceeded, failures, err)
+								}
+							}
+						} else if err == nil {
+							atomic.AddUint64(&totalPayload, payload)
+							atomic.AddUint64(&count, 1)
+						}
+					}
+					if exceeded {
+						return budgetErr
+					}
+					if opts.Interval != 0 && schedule == nil {
+						sleep(ctx, time.Duration(opts.Interval)*time.Millisecond)
+					}
+				}
+				return nil
+			}()
+		}(clis[i], i, crequests, vals[i], space.NewGenerator(i, opts.Clients, subSeed(seed, seedKeys, i)))
+	}
+
+	ticker := time.NewTicker(time.Second / 5)
+	defer ticker.Stop()
+	done := ctx.Done()
+	for active := atomic.LoadInt64(&remaining); active > 0; active = atomic.LoadInt64(&remaining) {
+		select {
+		case <-done:
+			// Stop clients and wait for requests in flight.
+			atomic.StoreInt32(&aborted, 1)
+			done = nil
+		case <-ticker.C:
+		}
+		var backlog int
+		if schedule != nil {
+			backlog = schedule.Due(time.Since(tstart)) - int(atomic.LoadInt64(&started))
+			if backlog > maxBacklog {
+				maxBacklog = backlog
+			}
+		}
+		if opts.Progress != nil {
+			progress := &Progress{
+				Phase:    PHASE_RUN,
+				Elapsed:  time.Duration(atomic.LoadInt64(&tstop)),
+				Requests: atomic.LoadUint64(&count),
+				Bytes:    atomic.LoadUint64(&totalPayload),
+				Clients:  int(active),
+				Backlog:  backlog,
+			}
+			if progress.Elapsed > 0 {
+				progress.Throughput = float64(progress.Requests) / progress.Elapsed.Seconds()
+			}
+			opts.Progress(progress)
+		}
+	}
+
+	// Summarize the measurement window.
+	real := time.Duration(atomic.LoadInt64(&tstop))
+	from, to := opts.Warmup, real-opts.Cooldown
+	last := to
+	if opts.Cooldown == 0 {
+		// Without a cooldown, requests are measured to the end.
+		last = time.Duration(math.MaxInt64)
+	}
+	ret := newResult(opts, measure(results, from, last), to-from, tbegin, sizes.Dist != SZDIST_FIXED)
+	ret.Seed = seed
+	ret.Verified = atomic.LoadUint64(&verified)
+	ret.Pipeline = pipeline
+	if n := atomic.LoadUint64(&unverified); n > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d GETs are not verified, the %s client returns no data.", n, opts.clientName()))
+	}
+	ret.Warnings = warnings
+	if schedule != nil {
+		ret.OpenLoop = &OpenLoopResult{
+			Arrival:    opts.Arrival,
+			Rate:       opts.Rate,
+			MaxBacklog: maxBacklog,
+			Late:       atomic.LoadUint64(&late),
+			MaxDelay:   ToMillis(atomic.LoadInt64(&maxDelay)),
+		}
+	}
+	if injector != nil {
+		ret.Faults = injector.Counts()
+	}
+	ret.results = results
+	ret.elapsed = real
+
+	if err := ctx.Err(); err != nil {
+		return ret, err
+	}
+	for _, err := range errs {
+		if err != nil {
+			return ret, err
+		}
+	}
+	return ret, nil
+}
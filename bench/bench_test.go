@@ -0,0 +1,250 @@
+package bench
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ds2-lab/infinibench/benchclient"
+)
+
+func TestRunSharesDummyStorage(t *testing.T) {
+	opts := testOptions()
+	opts.DSN = "dummy://?ns=TestRunSharesDummyStorage"
+	if _, err := Run(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+
+	// GETs of the next run find objects set by the last run.
+	opts.Op = OP_GET
+	ret, err := Run(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	} else if ret.Requests == 0 {
+		t.Fatal("no request completed")
+	} else if ret.NotFound != 0 {
+		t.Fatalf("%d of %d GETs are not found", ret.NotFound, ret.Requests)
+	}
+}
+
+func TestRunWithoutClients(t *testing.T) {
+	for _, clients := range []int{0, -1} {
+		opts := testOptions()
+		opts.DSN = "dummy://"
+		opts.Clients = clients
+		opts.Pipeline = 4
+		if _, err := Run(context.Background(), opts); !errors.Is(err, ErrInvalidClients) {
+			t.Fatalf("%d clients: expect %v, got %v", clients, ErrInvalidClients, err)
+		}
+	}
+}
+
+func TestClientDSN(t *testing.T) {
+	cases := []struct {
+		lib, base, bucket string
+		dsn               string
+	}{
+		{CLIENT_EFS, "", "", "efs://."},
+		{CLIENT_EFS, "/mnt/efs", "", "efs:///mnt/efs"},
+		{CLIENT_FSX, "data/fsx", "", "fsx://data/fsx"},
+		{CLIENT_S3, "", "bucket", "s3://bucket"},
+		{CLIENT_S3, "base", "bucket", "s3://base"},
+	}
+	for _, c := range cases {
+		opts := testOptions()
+		opts.DSN, opts.ClientLib, opts.ClientBase, opts.Bucket = "", c.lib, c.base, c.bucket
+		if err := opts.Validate(); err != nil {
+			t.Fatalf("%s of %q: %v", c.lib, c.base, err)
+		} else if dsn := opts.ClientDSN(); dsn != c.dsn {
+			t.Fatalf("%s of %q: expect %s, got %s", c.lib, c.base, c.dsn, dsn)
+		} else if _, err := benchclient.NewConstructor(dsn); err != nil {
+			t.Fatalf("%s of %q: %v", c.lib, c.base, err)
+		}
+	}
+
+	opts := testOptions()
+	opts.DSN, opts.ClientLib = "", CLIENT_S3
+	if err := opts.Validate(); !errors.Is(err, ErrNoBucket) {
+		t.Fatalf("expect %v, got %v", ErrNoBucket, err)
+	}
+}
+
+func TestRunMixed(t *testing.T) {
+	for _, percent := range []int{0, 30, 100} {
+		opts := testOptions()
+		opts.DSN = "dummy://?ns=TestRunMixed"
+		opts.Op, opts.ReadPercent, opts.Load, opts.Seed = OP_MIXED, percent, true, 1
+		opts.Requests = 500
+		ret, err := Run(context.Background(), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var gets, sets uint64
+		if op := ret.Ops["GET"]; op != nil {
+			gets = op.Requests
+		}
+		if op := ret.Ops["SET"]; op != nil {
+			sets = op.Requests
+		}
+		if ret.NotFound != 0 || ret.Failed != 0 || gets+sets != 1000 {
+			t.Fatalf("%d%% reads: expect 1000 requests to succeed, got %d GETs, %d SETs, %d not found and %d failed",
+				percent, gets, sets, ret.NotFound, ret.Failed)
+		} else if share := float64(gets) / 10; math.Abs(share-float64(percent)) > 5 {
+			t.Fatalf("%d%% reads: got %.1f%% GETs", percent, share)
+		}
+	}
+}
+
+func TestRunDuration(t *testing.T) {
+	opts := testOptions()
+	opts.Duration, opts.Warmup, opts.Cooldown = 400*time.Millisecond, 100*time.Millisecond, 100*time.Millisecond
+	opts.Interval = 1
+	ret, err := Run(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Requests of the warmup and cooldown windows are not measured.
+	var all uint64
+	for _, row := range ret.Series(100 * time.Millisecond) {
+		all += row.Requests
+	}
+	if ret.Duration < 0.15 || ret.Duration > 0.3 {
+		t.Fatalf("expect the measurement window of about 200ms, got %.3fs", ret.Duration)
+	} else if ret.Requests == 0 || ret.Requests >= all*3/4 {
+		t.Fatalf("expect about half of %d requests to be measured, got %d", all, ret.Requests)
+	} else if math.Abs(ret.Throughput-float64(ret.Requests)/ret.Duration) > 1e-6 {
+		t.Fatalf("expect the throughput of the measurement window, got %.2f", ret.Throughput)
+	}
+
+	// Runs are bounded by the duration instead of the number of requests.
+	opts = testOptions()
+	opts.Duration, opts.Requests = 200*time.Millisecond, 1
+	start := time.Now()
+	if ret, err := Run(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	} else if elapsed := time.Since(start); elapsed < opts.Duration || ret.Requests <= 2 {
+		t.Fatalf("expect requests for %v, got %d requests in %v", opts.Duration, ret.Requests, elapsed)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	// GETs of objects not set are not found, which are not failures.
+	opts := testOptions()
+	opts.DSN = "dummy://?ns=TestRunErrors"
+	opts.Op = OP_GET
+	ret, err := Run(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	} else if ret.Requests != 0 || ret.NotFound != 100 || ret.Failed != 0 || ret.ErrorRate() != 0 {
+		t.Fatalf("expect 100 GETs not found, got %d succeeded, %d not found and %d failed", ret.Requests, ret.NotFound, ret.Failed)
+	} else if ret.Ops["GET"].NotFoundHistogram.Total != 100 {
+		t.Fatalf("expect latencies of GETs not found, got %d", ret.Ops["GET"].NotFoundHistogram.Total)
+	}
+
+	// Failed requests are counted by error, with latencies apart from successful requests.
+	opts = testOptions()
+	opts.Faults, opts.Seed = "error=50%", 1
+	ret, err = Run(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := ret.Ops["SET"]
+	var errs uint64
+	for _, n := range set.Errors {
+		errs += n
+	}
+	if ret.Failed < 30 || ret.Failed > 70 || ret.Requests+ret.Failed != 100 || errs != ret.Failed {
+		t.Fatalf("expect about 50 of 100 SETs to fail, got %d succeeded and %d failed by errors %v", ret.Requests, ret.Failed, set.Errors)
+	} else if set.FailedHistogram.Total != ret.Failed || set.Histogram.Total != ret.Requests {
+		t.Fatalf("expect latencies of %d failed and %d succeeded SETs, got %d and %d",
+			ret.Failed, ret.Requests, set.FailedHistogram.Total, set.Histogram.Total)
+	} else if math.Abs(ret.ErrorRate()-float64(ret.Failed)) > 1e-9 {
+		t.Fatalf("expect the error rate of %d%%, got %.2f%%", ret.Failed, ret.ErrorRate())
+	}
+
+	// Runs stop once failures exceed the error budget.
+	opts.Faults, opts.MaxErrors = "error=100%", 5
+	opts.Requests = 1000
+	ret, err = Run(context.Background(), opts)
+	if !errors.Is(err, ErrErrorBudgetExceeded) {
+		t.Fatalf("expect %v, got %v", ErrErrorBudgetExceeded, err)
+	} else if ret == nil || ret.Failed <= 5 || ret.Failed >= 2000 {
+		t.Fatalf("expect the run to stop after 5 failures, got %+v", ret)
+	}
+}
+
+func TestRunPipeline(t *testing.T) {
+	opts := testOptions()
+	opts.DSN = "dummy://?ns=TestRunPipeline&overhead=1ms"
+	opts.Pipeline = 4
+	ret, err := Run(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	} else if ret.Pipeline != 4 || ret.Requests != 100 || len(ret.Warnings) != 0 {
+		t.Fatalf("expect 100 requests pipelined by 4, got %d requests pipelined by %d, warnings %v", ret.Requests, ret.Pipeline, ret.Warnings)
+	}
+	// Requests of a batch are sent together, each taking about the overhead.
+	if latency := ret.Latency(); latency.Min < 1 || latency.Max > 10 {
+		t.Fatalf("expect latencies of batches of about 1ms, got %+v", latency)
+	}
+
+	// Clients without batching send requests one by one.
+	opts.DSN = "disttest://"
+	ret, err = Run(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	} else if ret.Pipeline != 1 || ret.Requests != 100 || len(ret.Warnings) != 1 || !strings.Contains(ret.Warnings[0], "Pipelining is not supported") {
+		t.Fatalf("expect 100 requests sent one by one, got %d requests pipelined by %d, warnings %v", ret.Requests, ret.Pipeline, ret.Warnings)
+	}
+}
+
+func TestRunLibrary(t *testing.T) {
+	opts := testOptions()
+	opts.Seed = 42
+	var phases []string
+	var last *Progress
+	opts.Progress = func(progress *Progress) {
+		if len(phases) == 0 || phases[len(phases)-1] != progress.Phase {
+			phases = append(phases, progress.Phase)
+		}
+		last = progress
+	}
+	ret, err := Run(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := ret.Ops["SET"]
+	if ret.Seed != 42 || ret.Options.Clients != 2 || ret.Environment.GoVersion == "" || ret.Environment.End.Before(ret.Environment.Start) {
+		t.Fatalf("unexpected result of seed %d, options %+v and environment %+v", ret.Seed, ret.Options, ret.Environment)
+	} else if ret.Requests != 100 || set.Requests != 100 || ret.Bytes != 100*128 || set.Latency.Count != 100 {
+		t.Fatalf("expect 100 SETs of 128 bytes, got %d requests of %d bytes", ret.Requests, ret.Bytes)
+	} else if math.Abs(ret.Throughput-float64(ret.Requests)/ret.Duration) > 1e-6 || ret.Latency() != set.Latency {
+		t.Fatalf("unexpected throughput %.2f and latency %+v", ret.Throughput, ret.Latency())
+	} else if len(phases) != 1 || phases[0] != PHASE_RUN || last.Requests != 100 {
+		t.Fatalf("expect the progress of the run, got phases %v and the last progress %+v", phases, last)
+	}
+
+	// Passwords of DSNs are not kept in results.
+	opts = testOptions()
+	opts.DSN = "disttest://:secret@localhost"
+	if ret, err := Run(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	} else if ret.Options.DSN != "disttest://:xxxxx@localhost" || opts.DSN != "disttest://:secret@localhost" {
+		t.Fatalf("expect the DSN to be redacted in the result only, got %s", ret.Options.DSN)
+	}
+
+	// Canceled runs return results so far.
+	opts = testOptions()
+	opts.Duration, opts.Interval = time.Hour, 1
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	ret, err = Run(ctx, opts)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect %v, got %v", context.DeadlineExceeded, err)
+	} else if ret == nil || ret.Requests == 0 {
+		t.Fatalf("expect the result of the canceled run, got %+v", ret)
+	}
+}
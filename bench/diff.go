@@ -0,0 +1,325 @@
+package bench
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/ds2-lab/infinibench/histogram"
+)
+
+const (
+	RESULT_BENCH    = "bench"
+	RESULT_PLAYBACK = "playback"
+)
+
+const (
+	VERDICT_OK        = "ok"
+	VERDICT_IMPROVED  = "improved"
+	VERDICT_NOISE     = "not significant"
+	VERDICT_REGRESSED = "regressed"
+)
+
+var (
+	ErrInvalidThreshold = errors.New("invalid threshold")
+	ErrUnknownResult    = errors.New("unknown result file")
+)
+
+// DefaultThresholds are the max changes of metrics in the worse direction before a regression is reported.
+// Changes of ratios are in percentage points, and changes of other metrics are relative in percent.
+var DefaultThresholds = map[string]float64{
+	"throughput":        5,
+	"p50":               10,
+	"p99":               10,
+	"error_rate":        1,
+	"hit_ratio":         1,
+	"chunk_hit_ratio":   1,
+	"memory_per_lambda": 10,
+}
+
+// Delta is the change of a metric from the old result to the new result.
+type Delta struct {
+	Metric      string   `json:"metric"`
+	Old         float64  `json:"old"`
+	New         float64  `json:"new"`
+	Change      float64  `json:"change"`              // Relative change in percent, or difference in percentage points for ratios.
+	Threshold   *float64 `json:"threshold,omitempty"` // Max change in the worse direction, nil if the metric is not gated.
+	Significant bool     `json:"significant"`         // Whether latency histograms differ significantly, true for metrics without histograms.
+	Verdict     string   `json:"verdict"`
+
+	higherBetter bool
+	points       bool
+	tested       bool
+}
+
+// HistogramTest is the result of statistical tests on the latency histograms of an operation.
+type HistogramTest struct {
+	Op           string  `json:"op"`             // Name of the operation, or "ALL" for all operations.
+	KS           float64 `json:"ks"`             // Max distance between the cumulative distributions.
+	KSP          float64 `json:"ks_p"`           // P-value of the Kolmogorov-Smirnov test.
+	Slower       float64 `json:"slower"`         // Probability that a new latency is greater than an old one.
+	MannWhitneyP float64 `json:"mann_whitney_p"` // P-value of the Mann-Whitney U test.
+}
+
+// Diff is the comparison of two results of the same kind.
+type Diff struct {
+	Kind      string           `json:"kind"` // RESULT_BENCH or RESULT_PLAYBACK.
+	Alpha     float64          `json:"alpha"`
+	Deltas    []*Delta         `json:"deltas"`
+	Tests     []*HistogramTest `json:"tests,omitempty"`
+	Regressed []string         `json:"regressed"` // Metrics regressed beyond thresholds.
+}
+
+// ParseThresholds parses thresholds in the form of "metric=value;..." over the defaults. Metrics are names in the
+// diff table in any case, e.g. "p99" or "GET p99". A threshold of a metric without the operation applies to all
+// operations, and "none" removes the threshold.
+func ParseThresholds(spec string) (map[string]float64, error) {
+	thresholds := make(map[string]float64, len(DefaultThresholds))
+	for metric, threshold := range DefaultThresholds {
+		thresholds[metric] = threshold
+	}
+	for _, field := range strings.Split(spec, ";") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidThreshold, field)
+		}
+		metric, value := strings.ToLower(strings.TrimSpace(kv[0])), strings.TrimSpace(kv[1])
+		if value == "none" {
+			delete(thresholds, metric)
+			continue
+		}
+		threshold, err := strconv.ParseFloat(value, 64)
+		if err != nil || threshold < 0 {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidThreshold, field)
+		}
+		thresholds[metric] = threshold
+	}
+	return thresholds, nil
+}
+
+// ReadResult reads a result file written by infinibench -json or playback -json. It returns the kind of the result,
+// and either the benchmark result or the playback summary. The merged result is read from the result of a distributed run.
+func ReadResult(path string) (string, *Result, *PlaybackResult, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return "", nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if _, ok := fields["workers"]; ok && fields["result"] != nil {
+		data = fields["result"]
+		fields = map[string]json.RawMessage{"ops": nil}
+	}
+	if _, ok := fields["ops"]; ok {
+		var ret Result
+		if err := json.Unmarshal(data, &ret); err != nil {
+			return "", nil, nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return RESULT_BENCH, &ret, nil, nil
+	} else if _, ok := fields["hit_ratio"]; ok {
+		var ret PlaybackResult
+		if err := json.Unmarshal(data, &ret); err != nil {
+			return "", nil, nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return RESULT_PLAYBACK, nil, &ret, nil
+	}
+	return "", nil, nil, fmt.Errorf("%w: %s", ErrUnknownResult, path)
+}
+
+// DiffFiles compares two result files of the same kind. See DiffResults and DiffPlayback.
+func DiffFiles(oldPath string, newPath string, thresholds map[string]float64, alpha float64) (*Diff, error) {
+	oldKind, oldRet, oldPlayback, err := ReadResult(oldPath)
+	if err != nil {
+		return nil, err
+	}
+	newKind, newRet, newPlayback, err := ReadResult(newPath)
+	if err != nil {
+		return nil, err
+	} else if oldKind != newKind {
+		return nil, fmt.Errorf("can not compare a %s result with a %s result", oldKind, newKind)
+	}
+
+	if oldKind == RESULT_PLAYBACK {
+		return DiffPlayback(oldPlayback, newPlayback, thresholds), nil
+	}
+	return DiffResults(oldRet, newRet, thresholds, alpha), nil
+}
+
+// DiffResults compares throughput, error rates and latency percentiles of two benchmark results, in total and
+// per operation. A latency metric regresses only if the Kolmogorov-Smirnov test on the histograms rejects the
+// same distribution at the significance level alpha, so noise of large changes in small samples is not reported.
+// Tests are skipped if alpha is 0.
+func DiffResults(old *Result, new *Result, thresholds map[string]float64, alpha float64) *Diff {
+	diff := &Diff{Kind: RESULT_BENCH, Alpha: alpha}
+	diff.add(thresholds, &Delta{Metric: "throughput", Old: old.Throughput, New: new.Throughput, higherBetter: true})
+	diff.add(thresholds, &Delta{Metric: "bytes_per_second", Old: old.BytesPerSecond, New: new.BytesPerSecond, higherBetter: true})
+	diff.add(thresholds, &Delta{Metric: "error_rate", Old: old.ErrorRate(), New: new.ErrorRate(), points: true})
+	diff.addLatency(thresholds, "", old.Histogram(), new.Histogram())
+
+	for _, name := range OpNames {
+		oldOp, newOp := old.Ops[name], new.Ops[name]
+		if oldOp == nil || newOp == nil {
+			continue
+		}
+		diff.add(thresholds, &Delta{Metric: name + " throughput", Old: oldOp.Throughput, New: newOp.Throughput, higherBetter: true})
+		diff.add(thresholds, &Delta{Metric: name + " error_rate", Old: oldOp.ErrorRate(), New: newOp.ErrorRate(), points: true})
+		diff.addLatency(thresholds, name, oldOp.Histogram, newOp.Histogram)
+	}
+	return diff
+}
+
+// DiffPlayback compares hit ratios, memory and costs of two playback summaries.
+func DiffPlayback(old *PlaybackResult, new *PlaybackResult, thresholds map[string]float64) *Diff {
+	diff := &Diff{Kind: RESULT_PLAYBACK}
+	diff.add(thresholds, &Delta{Metric: "hit_ratio", Old: old.HitRatio, New: new.HitRatio, higherBetter: true, points: true})
+	diff.add(thresholds, &Delta{Metric: "chunk_hit_ratio", Old: old.ChunkHitRatio, New: new.ChunkHitRatio, higherBetter: true, points: true})
+	diff.add(thresholds, &Delta{Metric: "memory_per_lambda", Old: old.MemoryPerLambda, New: new.MemoryPerLambda})
+	diff.add(thresholds, &Delta{Metric: "max_memory_per_lambda", Old: float64(old.MaxMemoryPerLambda), New: float64(new.MaxMemoryPerLambda)})
+	diff.add(thresholds, &Delta{Metric: "total_memory", Old: float64(old.TotalMemory), New: float64(new.TotalMemory)})
+	diff.add(thresholds, &Delta{Metric: "active_minutes", Old: float64(old.ActiveMinutes), New: float64(new.ActiveMinutes)})
+	diff.add(thresholds, &Delta{Metric: "balancer_cost", Old: old.BalancerCost, New: new.BalancerCost})
+	return diff
+}
+
+// addLatency adds latency percentiles of the operation, with the statistical tests on the histograms.
+func (d *Diff) addLatency(thresholds map[string]float64, op string, old *histogram.Histogram, new *histogram.Histogram) {
+	if old == nil || new == nil {
+		return
+	}
+	prefix, significant, tested := "", true, false
+	if op != "" {
+		prefix = op + " "
+	}
+	if d.Alpha > 0 {
+		test := &HistogramTest{Op: op}
+		if op == "" {
+			test.Op = "ALL"
+		}
+		test.KS, test.KSP = histogram.KolmogorovSmirnov(old, new)
+		test.Slower, test.MannWhitneyP = histogram.MannWhitney(old, new)
+		d.Tests = append(d.Tests, test)
+		significant, tested = test.KSP < d.Alpha, true
+	}
+
+	oldLatency, newLatency := Summarize(old), Summarize(new)
+	metrics := []struct {
+		name     string
+		old, new float64
+	}{
+		{"p50", oldLatency.P50, newLatency.P50},
+		{"p90", oldLatency.P90, newLatency.P90},
+		{"p99", oldLatency.P99, newLatency.P99},
+		{"p99.9", oldLatency.P999, newLatency.P999},
+		{"p99.99", oldLatency.P9999, newLatency.P9999},
+		{"max", oldLatency.Max, newLatency.Max},
+	}
+	for _, m := range metrics {
+		d.add(thresholds, &Delta{Metric: prefix + m.name, Old: m.old, New: m.new, Significant: significant, tested: tested})
+	}
+}
+
+// add computes the change of the metric and judges it against the threshold.
+func (d *Diff) add(thresholds map[string]float64, delta *Delta) {
+	if !delta.tested {
+		delta.Significant = true
+	}
+	switch {
+	case delta.points:
+		delta.Change = delta.New - delta.Old
+	case delta.Old != 0:
+		delta.Change = (delta.New - delta.Old) * 100 / delta.Old
+	case delta.New != 0:
+		// A metric growing from 0 changes by 100%.
+		delta.Change = math.Copysign(100, delta.New)
+	}
+	worse := delta.Change
+	if delta.higherBetter {
+		worse = -worse
+	}
+
+	metric := strings.ToLower(delta.Metric)
+	if threshold, ok := thresholds[metric]; ok {
+		delta.Threshold = &threshold
+	} else if i := strings.Index(metric, " "); i >= 0 {
+		if threshold, ok := thresholds[metric[i+1:]]; ok {
+			delta.Threshold = &threshold
+		}
+	}
+
+	switch {
+	case delta.Threshold == nil || worse <= *delta.Threshold:
+		delta.Verdict = VERDICT_OK
+		if worse < 0 && delta.Significant && delta.Threshold != nil && -worse > *delta.Threshold {
+			delta.Verdict = VERDICT_IMPROVED
+		}
+	case !delta.Significant:
+		delta.Verdict = VERDICT_NOISE
+	default:
+		delta.Verdict = VERDICT_REGRESSED
+		d.Regressed = append(d.Regressed, delta.Metric)
+	}
+	d.Deltas = append(d.Deltas, delta)
+}
+
+// WriteTable writes one row per metric in csv, JSON, or markdown format. Changes of ratios are in percentage points.
+func (d *Diff) WriteTable(w io.Writer, format string) error {
+	if format == TABLE_JSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(d.Deltas)
+	}
+
+	header := []string{"metric", "old", "new", "change", "threshold", "verdict"}
+	lines := make([][]string, len(d.Deltas))
+	for i, delta := range d.Deltas {
+		unit, threshold := "%", ""
+		if delta.points {
+			unit = "pp"
+		}
+		if delta.Threshold != nil {
+			threshold = strconv.FormatFloat(*delta.Threshold, 'f', -1, 64) + unit
+		}
+		lines[i] = []string{
+			delta.Metric,
+			strconv.FormatFloat(delta.Old, 'f', 3, 64),
+			strconv.FormatFloat(delta.New, 'f', 3, 64),
+			strconv.FormatFloat(delta.Change, 'f', 2, 64) + unit,
+			threshold,
+			delta.Verdict,
+		}
+		if delta.Change > 0 {
+			lines[i][3] = "+" + lines[i][3]
+		}
+	}
+
+	switch format {
+	case "", TABLE_CSV:
+		writer := csv.NewWriter(w)
+		writer.Write(header)
+		writer.WriteAll(lines)
+		return writer.Error()
+	case TABLE_MARKDOWN:
+		return writeMarkdown(w, header, lines)
+	default:
+		return fmt.Errorf("unsupported table format: %s", format)
+	}
+}
+
+// WriteJSON writes the diff, including deltas and statistical tests, in JSON format.
+func (d *Diff) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(d)
+}
@@ -0,0 +1,158 @@
+package bench
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ds2-lab/infinibench/histogram"
+)
+
+// diffResult returns a result of GETs at the throughput, with n latencies from the min in steps of 1us.
+func diffResult(throughput float64, failed uint64, n int, min int64) *Result {
+	hist := histogram.New()
+	for i := 0; i < n; i++ {
+		hist.Record(min + int64(i)*1000)
+	}
+	op := &OpResult{Requests: uint64(n), Failed: failed, Throughput: throughput, Histogram: hist}
+	return &Result{Requests: op.Requests, Failed: failed, Throughput: throughput, Ops: map[string]*OpResult{"GET": op}}
+}
+
+func verdicts(diff *Diff) map[string]string {
+	verdicts := make(map[string]string, len(diff.Deltas))
+	for _, delta := range diff.Deltas {
+		verdicts[delta.Metric] = delta.Verdict
+	}
+	return verdicts
+}
+
+func TestParseThresholds(t *testing.T) {
+	thresholds, err := ParseThresholds(" p99=20; GET p50 = 5;error_rate=none;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]float64{"throughput": 5, "p50": 10, "p99": 20, "get p50": 5, "hit_ratio": 1, "chunk_hit_ratio": 1, "memory_per_lambda": 10}
+	if !reflect.DeepEqual(thresholds, expect) {
+		t.Fatalf("expect thresholds %v, got %v", expect, thresholds)
+	} else if DefaultThresholds["p99"] != 10 || DefaultThresholds["error_rate"] != 1 {
+		t.Fatalf("defaults are changed: %v", DefaultThresholds)
+	}
+
+	if thresholds, err := ParseThresholds(""); err != nil || !reflect.DeepEqual(thresholds, DefaultThresholds) {
+		t.Fatalf("expect the defaults, got %v, %v", thresholds, err)
+	}
+	for _, spec := range []string{"p99", "=5", "p99=fast", "p99=-1"} {
+		if _, err := ParseThresholds(spec); !errors.Is(err, ErrInvalidThreshold) {
+			t.Errorf("%s: expect %v, got %v", spec, ErrInvalidThreshold, err)
+		}
+	}
+}
+
+func TestDiffResults(t *testing.T) {
+	old := diffResult(1000, 0, 1000, 1000000)
+
+	diff := DiffResults(old, diffResult(1000, 0, 1000, 1000000), DefaultThresholds, 0.05)
+	if len(diff.Regressed) != 0 {
+		t.Fatalf("same results: expect no regressions, got %v", diff.Regressed)
+	} else if len(diff.Tests) != 2 || diff.Tests[0].Op != "ALL" || diff.Tests[1].Op != "GET" || diff.Tests[0].KSP != 1 {
+		t.Fatalf("unexpected tests %+v", diff.Tests)
+	}
+	for _, delta := range diff.Deltas {
+		if delta.Verdict != VERDICT_OK || delta.Change != 0 {
+			t.Fatalf("same results: unexpected delta %+v", delta)
+		}
+	}
+
+	// Throughput of -10% regresses, and +10% improves.
+	diff = DiffResults(old, diffResult(900, 0, 1000, 1000000), DefaultThresholds, 0.05)
+	if expect := []string{"throughput", "GET throughput"}; !reflect.DeepEqual(diff.Regressed, expect) {
+		t.Fatalf("slower throughput: expect regressions %v, got %v", expect, diff.Regressed)
+	} else if delta := diff.Deltas[0]; delta.Change != -10 || *delta.Threshold != 5 {
+		t.Fatalf("unexpected delta %+v", delta)
+	}
+	if v := verdicts(DiffResults(old, diffResult(1100, 0, 1000, 1000000), DefaultThresholds, 0.05)); v["throughput"] != VERDICT_IMPROVED {
+		t.Fatalf("faster throughput: expect %s, got %s", VERDICT_IMPROVED, v["throughput"])
+	}
+
+	// Error rates change in percentage points.
+	diff = DiffResults(old, diffResult(1000, 50, 1000, 1000000), DefaultThresholds, 0.05)
+	if v := verdicts(diff); v["error_rate"] != VERDICT_REGRESSED || v["GET error_rate"] != VERDICT_REGRESSED {
+		t.Fatalf("expect error rates to regress, got %v", v)
+	} else if delta := diff.Deltas[2]; delta.Metric != "error_rate" || delta.Old != 0 || delta.Change < 4.7 || delta.Change > 4.8 {
+		t.Fatalf("unexpected delta %+v", delta)
+	}
+
+	// Latencies 0.5ms higher regress if the histograms differ significantly.
+	slower := diffResult(1000, 0, 1000, 1500000)
+	for _, alpha := range []float64{0.05, 0} {
+		v := verdicts(DiffResults(old, slower, DefaultThresholds, alpha))
+		if v["p50"] != VERDICT_REGRESSED || v["GET p99"] != VERDICT_REGRESSED || v["p90"] != VERDICT_OK {
+			t.Fatalf("alpha %g: expect p50 and p99 to regress, got %v", alpha, v)
+		}
+	}
+	v := verdicts(DiffResults(diffResult(1000, 0, 2, 1000000), diffResult(1000, 0, 2, 1500000), DefaultThresholds, 0.05))
+	if v["p50"] != VERDICT_NOISE || v["GET p99"] != VERDICT_NOISE {
+		t.Fatalf("few samples: expect latencies to be %s, got %v", VERDICT_NOISE, v)
+	}
+
+	// Thresholds of an operation override thresholds of all operations.
+	thresholds, _ := ParseThresholds("GET p99=100;p50=none")
+	v = verdicts(DiffResults(old, slower, thresholds, 0.05))
+	if v["p99"] != VERDICT_REGRESSED || v["GET p99"] != VERDICT_OK || v["p50"] != VERDICT_OK {
+		t.Fatalf("expect only p99 of all operations to regress, got %v", v)
+	}
+}
+
+func TestDiffPlayback(t *testing.T) {
+	old := &PlaybackResult{HitRatio: 90, ChunkHitRatio: 95, MemoryPerLambda: 1000}
+	new := &PlaybackResult{HitRatio: 88, ChunkHitRatio: 95.5, MemoryPerLambda: 1050}
+	diff := DiffPlayback(old, new, DefaultThresholds)
+	if expect := []string{"hit_ratio"}; !reflect.DeepEqual(diff.Regressed, expect) {
+		t.Fatalf("expect regressions %v, got %v", expect, diff.Regressed)
+	}
+	if v := verdicts(diff); v["chunk_hit_ratio"] != VERDICT_OK || v["memory_per_lambda"] != VERDICT_OK || v["total_memory"] != VERDICT_OK {
+		t.Fatalf("unexpected verdicts %v", v)
+	}
+	if delta := diff.Deltas[0]; delta.Change != -2 {
+		t.Fatalf("expect hit ratio to change by -2pp, got %+v", delta)
+	}
+	// Metrics growing from 0 change by 100%.
+	diff = DiffPlayback(old, &PlaybackResult{HitRatio: 90, ChunkHitRatio: 95, MemoryPerLambda: 1000, BalancerCost: 1}, DefaultThresholds)
+	if delta := diff.Deltas[len(diff.Deltas)-1]; delta.Metric != "balancer_cost" || delta.Change != 100 || delta.Threshold != nil {
+		t.Fatalf("unexpected delta %+v", delta)
+	}
+}
+
+func TestDiffFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	bench := write("bench.json", `{"throughput": 1000, "ops": {}}`)
+	distributed := write("distributed.json", `{"workers": [], "result": {"throughput": 900, "ops": {}}}`)
+	playback := write("playback.json", `{"hit_ratio": 90}`)
+	unknown := write("unknown.json", `{"foo": 1}`)
+
+	diff, err := DiffFiles(bench, distributed, DefaultThresholds, 0.05)
+	if err != nil {
+		t.Fatal(err)
+	} else if diff.Kind != RESULT_BENCH || !reflect.DeepEqual(diff.Regressed, []string{"throughput"}) {
+		t.Fatalf("unexpected diff %+v", diff)
+	}
+	if diff, err := DiffFiles(playback, playback, DefaultThresholds, 0.05); err != nil || diff.Kind != RESULT_PLAYBACK {
+		t.Fatalf("unexpected diff %+v, %v", diff, err)
+	}
+	if _, err := DiffFiles(bench, playback, DefaultThresholds, 0.05); err == nil || !strings.Contains(err.Error(), "can not compare") {
+		t.Fatalf("expect an error of different kinds, got %v", err)
+	}
+	if _, err := DiffFiles(bench, unknown, DefaultThresholds, 0.05); !errors.Is(err, ErrUnknownResult) {
+		t.Fatalf("expect %v, got %v", ErrUnknownResult, err)
+	}
+}
@@ -0,0 +1,419 @@
+package bench
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Workers and the coordinator exchange messages in JSON lines over TCP:
+//
+//	worker -> coordinator: hello
+//	coordinator -> worker: assign, with the options of the worker's partition
+//	worker -> coordinator: ready, after clients are created and the partition is loaded if required
+//	coordinator -> worker: start, once all workers are ready
+//	worker -> coordinator: progress ..., then result
+//	coordinator -> worker: stop, if the coordinator is interrupted
+const (
+	MSG_HELLO    = "hello"
+	MSG_ASSIGN   = "assign"
+	MSG_READY    = "ready"
+	MSG_START    = "start"
+	MSG_PROGRESS = "progress"
+	MSG_RESULT   = "result"
+	MSG_STOP     = "stop"
+)
+
+// PROTOCOL_VERSION is bumped on incompatible changes of messages. Workers of other versions are rejected.
+const PROTOCOL_VERSION = 1
+
+// HELLO_TIMEOUT is the time for a connected worker to say hello before it is rejected.
+const HELLO_TIMEOUT = 10 * time.Second
+
+var (
+	ErrProtocol = errors.New("protocol error")
+)
+
+type message struct {
+	Type      string    `json:"type"`
+	Version   int       `json:"version,omitempty"`
+	Worker    string    `json:"worker,omitempty"`
+	Partition int       `json:"partition,omitempty"`
+	Options   *Options  `json:"options,omitempty"`
+	Progress  *Progress `json:"progress,omitempty"`
+	Result    *Result   `json:"result,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// msgConn exchanges messages on a connection. Sends and receives are not safe for concurrent use respectively.
+type msgConn struct {
+	net.Conn
+	encoder *json.Encoder
+	decoder *json.Decoder
+}
+
+func newMsgConn(c net.Conn) *msgConn {
+	return &msgConn{Conn: c, encoder: json.NewEncoder(c), decoder: json.NewDecoder(bufio.NewReader(c))}
+}
+
+func (c *msgConn) send(msg *message) error {
+	return c.encoder.Encode(msg)
+}
+
+// receive receives a message, expecting the type if specified.
+func (c *msgConn) receive(expect string) (*message, error) {
+	var msg message
+	if err := c.decoder.Decode(&msg); err != nil {
+		return nil, err
+	}
+	if expect != "" && msg.Type != expect {
+		return nil, fmt.Errorf("%w: expect %s, got %s", ErrProtocol, expect, msg.Type)
+	}
+	return &msg, nil
+}
+
+// Coordinator distributes a workload to workers connected over TCP, and merges their results.
+// The key range is partitioned among workers, so every worker accesses its own keys, and the target rate
+// of the open-loop mode is shared. Options like the number of clients and requests apply to each worker.
+type Coordinator struct {
+	Listener net.Listener
+	Workers  int // Number of workers to wait for before starting.
+
+	// Connected, if set, is called on the connection of each worker.
+	Connected func(worker string)
+}
+
+// WorkerResult is the result of a worker.
+type WorkerResult struct {
+	Worker    string  `json:"worker"`
+	Partition int     `json:"partition"`
+	Keymin    int     `json:"keymin"`
+	Keymax    int     `json:"keymax"`
+	Result    *Result `json:"result,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// DistributedResult is the result of a distributed run.
+type DistributedResult struct {
+	Result  *Result         `json:"result"` // Merged result of all workers.
+	Workers []*WorkerResult `json:"workers"`
+}
+
+// partition returns the options of the partition of the base options.
+func partition(base *Options, seed int64, i int, n int) *Options {
+	opts := *base
+	keys := base.Keymax - base.Keymin + 1
+	opts.Keymin = base.Keymin + keys*i/n
+	opts.Keymax = base.Keymin + keys*(i+1)/n - 1
+	opts.Rate = base.Rate / float64(n)
+	opts.Seed = seed + int64(i)<<40
+	opts.Progress = nil
+	return &opts
+}
+
+// Run waits for workers, runs the base options on all workers from a synchronized start, and returns the merged result.
+// The report function, if set, is called with the aggregated progress of workers. If the context is done, workers
+// are stopped and the merged result of completed requests is returned with the error. Failed workers do not stop
+// others, and the first error of workers is returned with the result.
+func (c *Coordinator) Run(ctx context.Context, base *Options, report func(*Progress)) (*DistributedResult, error) {
+	if c.Workers < 1 {
+		return nil, fmt.Errorf("%w: at least one worker is required", ErrProtocol)
+	} else if keys := base.Keymax - base.Keymin + 1; keys < c.Workers {
+		return nil, fmt.Errorf("%w: %d keys can not be partitioned among %d workers", ErrProtocol, keys, c.Workers)
+	}
+	seed := base.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	// Workers are set up in order, and the setup is aborted by closing the listener and connections on interruption.
+	var mu sync.Mutex
+	var conns []*msgConn
+	setup, stopped := make(chan struct{}), make(chan struct{})
+	defer close(stopped)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Listener.Close()
+			mu.Lock()
+			for _, conn := range conns {
+				conn.Close()
+			}
+			mu.Unlock()
+		case <-setup:
+		}
+	}()
+	defer func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+	setupErr := func(err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+
+	ret := &DistributedResult{Workers: make([]*WorkerResult, c.Workers)}
+	for i := range ret.Workers {
+		conn, hello, err := c.accept()
+		if err != nil {
+			return nil, setupErr(err)
+		}
+		mu.Lock()
+		conns = append(conns, conn)
+		mu.Unlock()
+		opts := partition(base, seed, i, len(ret.Workers))
+		ret.Workers[i] = &WorkerResult{Worker: hello.Worker, Partition: i, Keymin: opts.Keymin, Keymax: opts.Keymax}
+		if err := conn.send(&message{Type: MSG_ASSIGN, Partition: i, Options: opts}); err != nil {
+			return nil, setupErr(fmt.Errorf("worker %s: %w", hello.Worker, err))
+		}
+	}
+	c.Listener.Close()
+
+	for i, conn := range conns {
+		msg, err := conn.receive("")
+		if err == nil && msg.Type != MSG_READY {
+			err = fmt.Errorf("%w: expect %s, got %s %s", ErrProtocol, MSG_READY, msg.Type, msg.Error)
+		}
+		if err != nil {
+			return nil, setupErr(fmt.Errorf("worker %s: %w", ret.Workers[i].Worker, err))
+		}
+	}
+	close(setup)
+	start := time.Now()
+	var firstErr error
+	for i, conn := range conns {
+		if err := conn.send(&message{Type: MSG_START}); err != nil {
+			ret.Workers[i].Error = err.Error()
+			if firstErr == nil {
+				firstErr = fmt.Errorf("worker %s: %w", ret.Workers[i].Worker, err)
+			}
+		}
+	}
+
+	// Receive progress and results of workers.
+	type received struct {
+		worker int
+		msg    *message
+		err    error
+	}
+	msgs := make(chan *received)
+	active := 0
+	for i, conn := range conns {
+		if ret.Workers[i].Error != "" {
+			continue
+		}
+		active++
+		go func(i int, conn *msgConn) {
+			for {
+				msg, err := conn.receive("")
+				select {
+				case msgs <- &received{worker: i, msg: msg, err: err}:
+				case <-stopped:
+					return
+				}
+				if err != nil || msg.Type == MSG_RESULT {
+					return
+				}
+			}
+		}(i, conn)
+	}
+
+	progress := make([]*Progress, len(conns))
+	done := ctx.Done()
+	for active > 0 {
+		select {
+		case <-done:
+			// Stop workers and wait for their partial results.
+			for _, conn := range conns {
+				conn.send(&message{Type: MSG_STOP})
+			}
+			done = nil
+			continue
+		case r := <-msgs:
+			worker := ret.Workers[r.worker]
+			switch {
+			case r.err != nil:
+				worker.Error = r.err.Error()
+			case r.msg.Type == MSG_PROGRESS && r.msg.Progress != nil:
+				progress[r.worker] = r.msg.Progress
+				if report != nil {
+					report(mergeProgress(progress))
+				}
+				continue
+			case r.msg.Type == MSG_RESULT:
+				worker.Result, worker.Error = r.msg.Result, r.msg.Error
+			default:
+				continue
+			}
+			if worker.Error != "" && firstErr == nil {
+				firstErr = fmt.Errorf("worker %s: %s", worker.Worker, worker.Error)
+			}
+			active--
+		}
+	}
+
+	// The merged result counts clients of all workers.
+	opts := *base
+	opts.Clients *= len(ret.Workers)
+	opts.Seed = seed
+	opts.Progress = nil
+	results := make([]*Result, len(ret.Workers))
+	for i, worker := range ret.Workers {
+		results[i] = worker.Result
+	}
+	ret.Result = MergeResults(&opts, start, results...)
+	if err := ctx.Err(); err != nil {
+		return ret, err
+	}
+	return ret, firstErr
+}
+
+// accept accepts a worker and checks its hello.
+func (c *Coordinator) accept() (*msgConn, *message, error) {
+	for {
+		nc, err := c.Listener.Accept()
+		if err != nil {
+			return nil, nil, err
+		}
+		conn := newMsgConn(nc)
+		nc.SetReadDeadline(time.Now().Add(HELLO_TIMEOUT))
+		hello, err := conn.receive(MSG_HELLO)
+		nc.SetReadDeadline(time.Time{})
+		if err == nil && hello.Version != PROTOCOL_VERSION {
+			err = fmt.Errorf("%w: unsupported version %d", ErrProtocol, hello.Version)
+			conn.send(&message{Type: MSG_STOP, Error: err.Error()})
+		}
+		if err != nil {
+			// Reject the worker and wait for others.
+			conn.Close()
+			continue
+		}
+		if hello.Worker == "" {
+			hello.Worker = nc.RemoteAddr().String()
+		}
+		if c.Connected != nil {
+			c.Connected(hello.Worker)
+		}
+		return conn, hello, nil
+	}
+}
+
+// mergeProgress aggregates the latest progress of workers.
+func mergeProgress(progress []*Progress) *Progress {
+	merged := &Progress{Phase: PHASE_RUN}
+	for _, p := range progress {
+		if p == nil {
+			continue
+		}
+		if p.Elapsed > merged.Elapsed {
+			merged.Elapsed = p.Elapsed
+		}
+		merged.Requests += p.Requests
+		merged.Bytes += p.Bytes
+		merged.Throughput += p.Throughput
+		merged.Clients += p.Clients
+		merged.Backlog += p.Backlog
+	}
+	return merged
+}
+
+// RunWorker connects to the coordinator at the address, runs the assigned workload on the start signal,
+// and streams back progress and the result. The name identifies the worker in results, defaults to the host name.
+// It returns after the result is sent, and the error of the run, if any, is returned after being reported.
+func RunWorker(ctx context.Context, addr string, name string) error {
+	if name == "" {
+		host, _ := os.Hostname()
+		name = fmt.Sprintf("%s/%d", host, os.Getpid())
+	}
+	var dialer net.Dialer
+	nc, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	conn := newMsgConn(nc)
+	defer conn.Close()
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-finished:
+		}
+	}()
+
+	if err := conn.send(&message{Type: MSG_HELLO, Version: PROTOCOL_VERSION, Worker: name}); err != nil {
+		return err
+	}
+	assign, err := conn.receive("")
+	if err != nil {
+		return err
+	} else if assign.Type != MSG_ASSIGN || assign.Options == nil {
+		return fmt.Errorf("%w: rejected by the coordinator: %s", ErrProtocol, assign.Error)
+	}
+	opts := assign.Options
+
+	// Load the partition before the synchronized start.
+	if opts.Load {
+		if _, err := Run(ctx, loadOptions(opts)); err != nil {
+			conn.send(&message{Type: MSG_RESULT, Error: err.Error()})
+			return err
+		}
+		opts.Load = false
+	}
+	if err := conn.send(&message{Type: MSG_READY}); err != nil {
+		return err
+	}
+	if _, err := conn.receive(MSG_START); err != nil {
+		return err
+	}
+
+	// Stop the run if the coordinator asks to stop or goes away.
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		defer cancel()
+		for {
+			msg, err := conn.receive("")
+			if err != nil || msg.Type == MSG_STOP {
+				return
+			}
+		}
+	}()
+
+	opts.Progress = func(progress *Progress) {
+		conn.send(&message{Type: MSG_PROGRESS, Progress: progress})
+	}
+	ret, err := Run(runCtx, opts)
+	if errors.Is(err, context.Canceled) && ctx.Err() == nil {
+		// Stopped by the coordinator.
+		err = nil
+	}
+	msg := &message{Type: MSG_RESULT, Result: ret}
+	if err != nil {
+		msg.Error = err.Error()
+	}
+	if sendErr := conn.send(msg); sendErr != nil {
+		return sendErr
+	}
+	return err
+}
+
+// WriteJSON writes the result, including the merged result and results of all workers, in JSON format.
+func (r *DistributedResult) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
@@ -0,0 +1,176 @@
+package bench
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ds2-lab/infinibench/benchclient"
+)
+
+// recorder records keys sent by dummy clients of each constructor, i.e. of each run of a worker.
+var recorder struct {
+	sync.Mutex
+	runs []map[string]bool
+}
+
+func init() {
+	benchclient.Register("disttest", func(u *url.URL) (benchclient.Constructor, error) {
+		construct, err := benchclient.NewConstructor("dummy://?" + u.RawQuery)
+		if err != nil {
+			return nil, err
+		}
+		keys := make(map[string]bool)
+		recorder.Lock()
+		recorder.runs = append(recorder.runs, keys)
+		recorder.Unlock()
+		return func() benchclient.Client {
+			return &recordingClient{ContextClient: benchclient.WithContext(construct()), keys: keys}
+		}, nil
+	})
+}
+
+type recordingClient struct {
+	benchclient.ContextClient
+	keys map[string]bool
+}
+
+func (c *recordingClient) EcSetContext(ctx context.Context, key string, val []byte, opts ...benchclient.RequestOption) (string, error) {
+	recorder.Lock()
+	c.keys[key] = true
+	recorder.Unlock()
+	return c.ContextClient.EcSetContext(ctx, key, val, opts...)
+}
+
+// runDistributed runs the options on the workers on localhost, and returns the result, errors of workers and the error.
+func runDistributed(t *testing.T, ctx context.Context, opts *Options, workers int) (*DistributedResult, []error, error) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = RunWorker(context.Background(), ln.Addr().String(), fmt.Sprintf("worker-%d", i))
+		}(i)
+	}
+	coordinator := &Coordinator{Listener: ln, Workers: workers}
+	ret, err := coordinator.Run(ctx, opts, nil)
+
+	stopped := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(10 * time.Second):
+		t.Fatal("workers are not stopped")
+	}
+	return ret, errs, err
+}
+
+func testOptions() *Options {
+	opts := *DefaultOptions
+	opts.DSN = "disttest://"
+	opts.Clients = 2
+	opts.Requests = 50
+	opts.Keymin = 1
+	opts.Keymax = 90
+	opts.Objsz = 128
+	opts.Op = OP_SET
+	return &opts
+}
+
+func TestDistributedPartitions(t *testing.T) {
+	recorder.Lock()
+	recorder.runs = nil
+	recorder.Unlock()
+
+	opts := testOptions()
+	ret, errs, err := runDistributed(t, context.Background(), opts, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("worker %d: %v", i, err)
+		}
+	}
+
+	// Partitions cover the key range without overlapping.
+	next := opts.Keymin
+	var requests uint64
+	for i, worker := range ret.Workers {
+		if worker.Partition != i || worker.Keymin != next || worker.Keymax < worker.Keymin {
+			t.Fatalf("worker %d: unexpected partition %d of keys [%d, %d]", i, worker.Partition, worker.Keymin, worker.Keymax)
+		} else if worker.Result == nil {
+			t.Fatalf("worker %d: no result: %s", i, worker.Error)
+		}
+		next = worker.Keymax + 1
+		requests += worker.Result.Requests
+	}
+	if next != opts.Keymax+1 {
+		t.Fatalf("partitions end at %d, expect %d", next-1, opts.Keymax)
+	}
+
+	// Keys sent by workers do not overlap.
+	recorder.Lock()
+	defer recorder.Unlock()
+	if len(recorder.runs) != 3 {
+		t.Fatalf("expect 3 runs of workers, got %d", len(recorder.runs))
+	}
+	owners := make(map[string]int)
+	for run, keys := range recorder.runs {
+		for key := range keys {
+			if owner, ok := owners[key]; ok {
+				t.Fatalf("key %s is sent by runs %d and %d", key, owner, run)
+			}
+			owners[key] = run
+		}
+	}
+
+	// The merged result sums workers.
+	if expect := uint64(3 * opts.Clients * opts.Requests); requests != expect {
+		t.Fatalf("workers completed %d requests, expect %d", requests, expect)
+	} else if ret.Result.Requests != requests {
+		t.Fatalf("merged %d requests, expect %d", ret.Result.Requests, requests)
+	} else if ret.Result.Options.Clients != 3*opts.Clients {
+		t.Fatalf("merged %d clients, expect %d", ret.Result.Options.Clients, 3*opts.Clients)
+	}
+}
+
+func TestDistributedCancel(t *testing.T) {
+	opts := testOptions()
+	opts.DSN = "dummy://?overhead=1ms"
+	opts.Duration = time.Minute
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(500*time.Millisecond, cancel)
+	start := time.Now()
+	ret, errs, err := runDistributed(t, ctx, opts, 3)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect %v, got %v", context.Canceled, err)
+	} else if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("stopped after %v", elapsed)
+	}
+	// Workers are stopped by the coordinator, and report partial results.
+	for i, worker := range ret.Workers {
+		if errs[i] != nil {
+			t.Fatalf("worker %d: %v", i, errs[i])
+		} else if worker.Result == nil || worker.Error != "" {
+			t.Fatalf("worker %d: no result: %s", i, worker.Error)
+		} else if worker.Result.Requests == 0 {
+			t.Fatalf("worker %d: no request completed", i)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package bench
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"sync/atomic"
+)
+
+const (
+	KEYDIST_UNIFORM    = "uniform"
+	KEYDIST_SEQUENTIAL = "sequential"
+	KEYDIST_ZIPFIAN    = "zipfian"
+	KEYDIST_HOTSPOT    = "hotspot"
+	KEYDIST_LATEST     = "latest"
+)
+
+var (
+	ErrInvalidKeyRange = errors.New("invalid key range")
+	ErrInvalidZipfian  = errors.New("zipfian skew must be in (0, 1) or larger than 1")
+	ErrInvalidHotspot  = errors.New("hotspot percentages must be in [0, 100]")
+)
+
+// KeySpace holds all keys in the form of key_[keymin] ~ key_[keymax] and the states
+// shared by key generators. Keys are prebuilt so that generating a key does not allocate.
+type KeySpace struct {
+	Min  int
+	Max  int
+	Dist string
+
+	keys    []string
+	zipf    *zipfian
+	zipfS   float64 // Skew for rand.Zipf if larger than 1.
+	hotKeys int
+	hotOps  float64
+	latest  int64 // Offset of the most recently set key.
+}
+
+// NewKeySpace creates the key space specified by the options.
+func NewKeySpace(opts *Options) (*KeySpace, error) {
+	if opts.Keymax < opts.Keymin {
+		return nil, ErrInvalidKeyRange
+	}
+
+	space := &KeySpace{
+		Min:  opts.Keymin,
+		Max:  opts.Keymax,
+		Dist: opts.KeyDist,
+		keys: make([]string, opts.Keymax-opts.Keymin+1),
+	}
+	for i := range space.keys {
+		space.keys[i] = "key_" + strconv.Itoa(opts.Keymin+i)
+	}
+	space.latest = int64(len(space.keys) - 1)
+
+	switch space.Dist {
+	case "":
+		space.Dist = KEYDIST_UNIFORM
+	case KEYDIST_UNIFORM, KEYDIST_SEQUENTIAL:
+	case KEYDIST_ZIPFIAN, KEYDIST_LATEST:
+		if opts.ZipfTheta <= 0 || opts.ZipfTheta == 1 {
+			return nil, ErrInvalidZipfian
+		} else if opts.ZipfTheta < 1 {
+			space.zipf = newZipfian(len(space.keys), opts.ZipfTheta)
+		} else {
+			space.zipfS = opts.ZipfTheta
+		}
+	case KEYDIST_HOTSPOT:
+		if opts.HotKeys < 0 || opts.HotKeys > 100 || opts.HotOps < 0 || opts.HotOps > 100 {
+			return nil, ErrInvalidHotspot
+		}
+		space.hotKeys = int(math.Ceil(float64(len(space.keys)) * opts.HotKeys / 100))
+		space.hotOps = opts.HotOps / 100
+	default:
+		return nil, fmt.Errorf("unsupported key distribution: %s", opts.KeyDist)
+	}
+	return space, nil
+}
+
+// Len returns the number of keys in the key space.
+func (s *KeySpace) Len() int {
+	return len(s.keys)
+}
+
+// Key returns the key of specified postfix.
+func (s *KeySpace) Key(idx int) string {
+	return s.keys[idx-s.Min]
+}
+
+// NewGenerator creates a key generator for the client of specified id.
+// The seed determines the key sequence of the generator.
+func (s *KeySpace) NewGenerator(cid int, clients int, seed int64) *KeyGenerator {
+	gen := &KeyGenerator{
+		space: s,
+		rnd:   rand.New(rand.NewSource(seed)),
+		seq:   cid % len(s.keys),
+		step:  clients,
+	}
+	if s.zipfS > 0 {
+		gen.zipf = rand.NewZipf(gen.rnd, s.zipfS, 1, uint64(len(s.keys)-1))
+	}
+	return gen
+}
+
+// KeyGenerator generates keys following the distribution of the key space.
+// A generator is not thread-safe, each client should own one.
+type KeyGenerator struct {
+	space *KeySpace
+	rnd   *rand.Rand
+	zipf  *rand.Zipf
+	seq   int
+	step  int
+}
+
+// KeyAt returns the key at the offset of the key space.
+func (s *KeySpace) KeyAt(off int) string {
+	return s.keys[off]
+}
+
+// Next returns the key for the next request of specified operation.
+// SETs of the OP_SET workload are always sequential to load the data store.
+func (g *KeyGenerator) Next(op int, mixed bool) string {
+	return g.space.keys[g.NextOffset(op, mixed)]
+}
+
+// NextOffset is the same as Next, but returns the offset of the key in the key space.
+func (g *KeyGenerator) NextOffset(op int, mixed bool) int {
+	n := len(g.space.keys)
+	if op == OP_SET && (!mixed || g.space.Dist == KEYDIST_LATEST) {
+		// Sequential inserts, which also advance the latest key.
+		off := g.sequential()
+		atomic.StoreInt64(&g.space.latest, int64(off))
+		return off
+	}
+
+	switch g.space.Dist {
+	case KEYDIST_SEQUENTIAL:
+		return g.sequential()
+	case KEYDIST_ZIPFIAN:
+		return g.zipfian()
+	case KEYDIST_LATEST:
+		off := int(atomic.LoadInt64(&g.space.latest)) - g.zipfian()
+		if off < 0 {
+			off += n
+		}
+		return off
+	case KEYDIST_HOTSPOT:
+		if g.space.hotKeys >= n || (g.space.hotKeys > 0 && g.rnd.Float64() < g.space.hotOps) {
+			return g.rnd.Intn(g.space.hotKeys)
+		}
+		return g.space.hotKeys + g.rnd.Intn(n-g.space.hotKeys)
+	default:
+		return g.rnd.Intn(n)
+	}
+}
+
+func (g *KeyGenerator) sequential() int {
+	off := g.seq
+	g.seq = (g.seq + g.step) % len(g.space.keys)
+	return off
+}
+
+func (g *KeyGenerator) zipfian() int {
+	if g.zipf != nil {
+		return int(g.zipf.Uint64())
+	}
+	return g.space.zipf.next(g.rnd)
+}
+
+// zipfian implements the zipfian generator with skew in (0, 1) described in
+// "Quickly Generating Billion-Record Synthetic Databases" by Gray et al., as used by YCSB.
+// Item 0 is the most popular.
+type zipfian struct {
+	items int
+	theta float64
+	zetan float64
+	alpha float64
+	eta   float64
+	half  float64 // 1 + 0.5^theta
+}
+
+func newZipfian(items int, theta float64) *zipfian {
+	z := &zipfian{
+		items: items,
+		theta: theta,
+		alpha: 1 / (1 - theta),
+		half:  1 + math.Pow(0.5, theta),
+	}
+	for i := 1; i <= items; i++ {
+		z.zetan += 1 / math.Pow(float64(i), theta)
+	}
+	zeta2 := 1 + 1/math.Pow(2, theta)
+	z.eta = (1 - math.Pow(2/float64(items), 1-theta)) / (1 - zeta2/z.zetan)
+	return z
+}
+
+func (z *zipfian) next(rnd *rand.Rand) int {
+	u := rnd.Float64()
+	uz := u * z.zetan
+	if uz < 1 {
+		return 0
+	} else if uz < z.half {
+		return 1 % z.items
+	}
+	ret := int(float64(z.items) * math.Pow(z.eta*u-z.eta+1, z.alpha))
+	if ret >= z.items {
+		ret = z.items - 1
+	}
+	return ret
+}
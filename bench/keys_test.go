@@ -0,0 +1,175 @@
+package bench
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func newTestKeySpace(t *testing.T, dist string, keys int, change func(*Options)) *KeySpace {
+	t.Helper()
+	opts := *DefaultOptions
+	opts.Keymin, opts.Keymax = 1, keys
+	opts.KeyDist = dist
+	if change != nil {
+		change(&opts)
+	}
+	space, err := NewKeySpace(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return space
+}
+
+// countKeys returns the number of GETs of each offset in the key space.
+func countKeys(gen *KeyGenerator, space *KeySpace, n int) []int {
+	counts := make([]int, space.Len())
+	for i := 0; i < n; i++ {
+		counts[gen.NextOffset(OP_GET, false)]++
+	}
+	return counts
+}
+
+func TestNewKeySpace(t *testing.T) {
+	space := newTestKeySpace(t, "", 10, func(opts *Options) { opts.Keymin, opts.Keymax = 5, 14 })
+	if space.Dist != KEYDIST_UNIFORM || space.Len() != 10 || space.Key(5) != "key_5" || space.Key(14) != "key_14" || space.KeyAt(1) != "key_6" {
+		t.Fatalf("unexpected key space %+v", space)
+	}
+
+	for _, c := range []struct {
+		change func(*Options)
+		err    error
+	}{
+		{func(opts *Options) { opts.Keymin, opts.Keymax = 10, 9 }, ErrInvalidKeyRange},
+		{func(opts *Options) { opts.KeyDist, opts.ZipfTheta = KEYDIST_ZIPFIAN, 0 }, ErrInvalidZipfian},
+		{func(opts *Options) { opts.KeyDist, opts.ZipfTheta = KEYDIST_LATEST, 1 }, ErrInvalidZipfian},
+		{func(opts *Options) { opts.KeyDist, opts.HotKeys = KEYDIST_HOTSPOT, 101 }, ErrInvalidHotspot},
+		{func(opts *Options) { opts.KeyDist, opts.HotOps = KEYDIST_HOTSPOT, -1 }, ErrInvalidHotspot},
+	} {
+		opts := *DefaultOptions
+		c.change(&opts)
+		if _, err := NewKeySpace(&opts); err != c.err {
+			t.Errorf("expect %v, got %v", c.err, err)
+		}
+	}
+	opts := *DefaultOptions
+	opts.KeyDist = "gaussian"
+	if _, err := NewKeySpace(&opts); err == nil {
+		t.Error("expect an error of the unsupported distribution")
+	}
+}
+
+func TestSequentialKeys(t *testing.T) {
+	space := newTestKeySpace(t, KEYDIST_SEQUENTIAL, 10, nil)
+	// Clients interleave keys.
+	gen := space.NewGenerator(1, 3, 1)
+	var offs []int
+	for i := 0; i < 5; i++ {
+		offs = append(offs, gen.NextOffset(OP_GET, false))
+	}
+	if expect := []int{1, 4, 7, 0, 3}; !reflect.DeepEqual(offs, expect) {
+		t.Fatalf("expect offsets %v, got %v", expect, offs)
+	}
+
+	// SETs of the OP_SET workload are sequential in any distribution.
+	space = newTestKeySpace(t, KEYDIST_ZIPFIAN, 10, nil)
+	gen = space.NewGenerator(0, 2, 1)
+	for i := 0; i < 10; i++ {
+		if key, expect := gen.Next(OP_SET, false), space.KeyAt(2*i%10); key != expect {
+			t.Fatalf("SET %d: expect %s, got %s", i, expect, key)
+		}
+	}
+}
+
+func TestUniformKeys(t *testing.T) {
+	space := newTestKeySpace(t, KEYDIST_UNIFORM, 10, nil)
+	for off, count := range countKeys(space.NewGenerator(0, 1, 1), space, 100000) {
+		if math.Abs(float64(count)-10000) > 500 {
+			t.Fatalf("key %d: expect about 10000 GETs, got %d", off, count)
+		}
+	}
+
+	// Generators of the same seed generate the same keys.
+	a, b := space.NewGenerator(0, 1, 42), space.NewGenerator(0, 1, 42)
+	for i := 0; i < 100; i++ {
+		if ka, kb := a.Next(OP_GET, true), b.Next(OP_GET, true); ka != kb {
+			t.Fatalf("GET %d: %s != %s", i, ka, kb)
+		}
+	}
+}
+
+func TestZipfianKeys(t *testing.T) {
+	const keys, n = 1000, 200000
+	space := newTestKeySpace(t, KEYDIST_ZIPFIAN, keys, func(opts *Options) { opts.ZipfTheta = 0.99 })
+	counts := countKeys(space.NewGenerator(0, 1, 1), space, n)
+
+	// The popularity of the key of rank i is proportional to 1/i^theta.
+	var zetan float64
+	for i := 1; i <= keys; i++ {
+		zetan += 1 / math.Pow(float64(i), 0.99)
+	}
+	for _, rank := range []int{1, 2} {
+		expect := float64(n) / math.Pow(float64(rank), 0.99) / zetan
+		if count := float64(counts[rank-1]); math.Abs(count-expect) > 0.05*expect {
+			t.Fatalf("key of rank %d: expect about %.0f GETs, got %.0f", rank, expect, count)
+		}
+	}
+	var top int
+	for _, count := range counts[:keys/10] {
+		top += count
+	}
+	if share := float64(top) / n; share < 0.6 || share > 0.75 {
+		t.Fatalf("expect 10%% of keys to take about 2/3 of GETs, got %.2f", share)
+	}
+
+	// Skews larger than 1 follow rand.Zipf.
+	space = newTestKeySpace(t, KEYDIST_ZIPFIAN, keys, func(opts *Options) { opts.ZipfTheta = 2 })
+	counts = countKeys(space.NewGenerator(0, 1, 1), space, n)
+	if share := float64(counts[0]) / n; math.Abs(share-6/math.Pi/math.Pi) > 0.01 {
+		t.Fatalf("expect the first key to take 6/pi^2 of GETs, got %.3f", share)
+	}
+}
+
+func TestHotspotKeys(t *testing.T) {
+	space := newTestKeySpace(t, KEYDIST_HOTSPOT, 100, func(opts *Options) { opts.HotKeys, opts.HotOps = 20, 80 })
+	counts := countKeys(space.NewGenerator(0, 1, 1), space, 100000)
+	var hot int
+	for _, count := range counts[:20] {
+		hot += count
+	}
+	if share := float64(hot) / 100000; math.Abs(share-0.8) > 0.01 {
+		t.Fatalf("expect 20%% of keys to take 80%% of GETs, got %.3f", share)
+	}
+	for off, count := range counts {
+		if count == 0 {
+			t.Fatalf("key %d is never accessed", off)
+		}
+	}
+
+	// All keys are hot.
+	space = newTestKeySpace(t, KEYDIST_HOTSPOT, 10, func(opts *Options) { opts.HotKeys, opts.HotOps = 100, 0 })
+	for off, count := range countKeys(space.NewGenerator(0, 1, 1), space, 10000) {
+		if count == 0 {
+			t.Fatalf("key %d is never accessed", off)
+		}
+	}
+}
+
+func TestLatestKeys(t *testing.T) {
+	space := newTestKeySpace(t, KEYDIST_LATEST, 100, func(opts *Options) { opts.ZipfTheta = 0.99 })
+	gen := space.NewGenerator(0, 1, 1)
+	// SETs advance the latest key.
+	for i := 0; i < 31; i++ {
+		gen.Next(OP_SET, true)
+	}
+	counts := countKeys(gen, space, 100000)
+	for off := range counts {
+		if off != 30 && counts[off] >= counts[30] {
+			t.Fatalf("key %d is accessed %d times, more than %d times of the latest key", off, counts[off], counts[30])
+		}
+	}
+	// Older keys are less popular, and wrap around the key space.
+	if counts[29] <= counts[20] || counts[0] <= counts[90] || counts[90] <= counts[31] {
+		t.Fatalf("unexpected popularity %v", counts)
+	}
+}
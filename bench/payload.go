@@ -0,0 +1,150 @@
+package bench
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"sync"
+	"sync/atomic"
+)
+
+// Payload layout in verify mode:
+//
+//	magic(4) | version(8) | length(4) | checksum(4) | key length(2) | key | body
+//
+// The checksum covers the whole payload with the checksum field excluded.
+const (
+	PayloadMagic      = 0x49427631 // "IBv1"
+	PayloadHeaderSize = 22
+
+	payloadChecksumOffset = 16
+)
+
+var (
+	ErrPayloadHeader   = errors.New("verify: invalid payload header")
+	ErrPayloadKey      = errors.New("verify: key mismatch")
+	ErrPayloadLength   = errors.New("verify: length mismatch")
+	ErrPayloadChecksum = errors.New("verify: checksum mismatch")
+	ErrPayloadStale    = errors.New("verify: stale version")
+
+	payloadTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// PayloadOverhead returns the minimum size of the payload of the key.
+func PayloadOverhead(key string) int {
+	return PayloadHeaderSize + len(key)
+}
+
+// Verifier builds self-describing payloads for SETs and validates the data returned by GETs.
+// SETs in flight are tracked per key, so reads racing with concurrent SETs are not taken as stale.
+type Verifier struct {
+	version uint64
+	keys    []keyVersions
+}
+
+// keyVersions tracks versions of a key.
+type keyVersions struct {
+	mu       sync.Mutex
+	floor    uint64            // Oldest version GETs may return.
+	inflight map[uint64]uint64 // Versions of SETs in flight to the oldest version in flight when they began.
+}
+
+// NewVerifier creates a verifier for the key space.
+func NewVerifier(space *KeySpace) *Verifier {
+	return &Verifier{
+		keys: make([]keyVersions, space.Len()),
+	}
+}
+
+// Encode writes the header of the key at the offset to the buffer, and returns the payload with the new version.
+// The SET of the version is in flight until Ack or Fail is called.
+// The rest of the buffer is used as the body. The buffer will be extended if it is smaller than the header.
+func (v *Verifier) Encode(buf []byte, off int, key string) ([]byte, uint64) {
+	if overhead := PayloadOverhead(key); len(buf) < overhead {
+		buf = buf[:overhead]
+	}
+	kv := &v.keys[off]
+	kv.mu.Lock()
+	// Versions are allocated with the lock, so SETs that begin later have newer versions.
+	version := atomic.AddUint64(&v.version, 1)
+	oldest := version
+	for inflight := range kv.inflight {
+		if inflight < oldest {
+			oldest = inflight
+		}
+	}
+	if kv.inflight == nil {
+		kv.inflight = make(map[uint64]uint64, 1)
+	}
+	kv.inflight[version] = oldest
+	kv.mu.Unlock()
+
+	binary.BigEndian.PutUint32(buf[0:], PayloadMagic)
+	binary.BigEndian.PutUint64(buf[4:], version)
+	binary.BigEndian.PutUint32(buf[12:], uint32(len(buf)))
+	binary.BigEndian.PutUint16(buf[20:], uint16(len(key)))
+	copy(buf[PayloadHeaderSize:], key)
+	binary.BigEndian.PutUint32(buf[payloadChecksumOffset:], payloadChecksum(buf))
+	return buf, version
+}
+
+// Ack records the version of the key at the offset was set successfully. SETs concurrent with it may be applied
+// in any order, so GETs may return the version or versions of SETs in flight when it began.
+func (v *Verifier) Ack(off int, version uint64) {
+	kv := &v.keys[off]
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	if oldest, ok := kv.inflight[version]; ok {
+		kv.floor = oldest
+		delete(kv.inflight, version)
+	} else {
+		kv.floor = version
+	}
+}
+
+// Fail records the SET of the version of the key at the offset failed. The SET may have been applied anyway, so
+// GETs may return the version.
+func (v *Verifier) Fail(off int, version uint64) {
+	kv := &v.keys[off]
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	delete(kv.inflight, version)
+	if version < kv.floor {
+		kv.floor = version
+	}
+}
+
+// Acked returns the oldest version of the key at the offset that GETs may return.
+// Call Acked before a GET and pass the version to Verify.
+func (v *Verifier) Acked(off int) uint64 {
+	kv := &v.keys[off]
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+	return kv.floor
+}
+
+// Verify validates the data of the key. The version of data must not be older than the acked version.
+func (v *Verifier) Verify(data []byte, key string, acked uint64) error {
+	if len(data) < PayloadHeaderSize || binary.BigEndian.Uint32(data[0:]) != PayloadMagic {
+		return ErrPayloadHeader
+	}
+	if int(binary.BigEndian.Uint32(data[12:])) != len(data) {
+		return ErrPayloadLength
+	}
+	keyLen := int(binary.BigEndian.Uint16(data[20:]))
+	if PayloadHeaderSize+keyLen > len(data) || string(data[PayloadHeaderSize:PayloadHeaderSize+keyLen]) != key {
+		return ErrPayloadKey
+	}
+	if binary.BigEndian.Uint32(data[payloadChecksumOffset:]) != payloadChecksum(data) {
+		return ErrPayloadChecksum
+	}
+	if binary.BigEndian.Uint64(data[4:]) < acked {
+		return ErrPayloadStale
+	}
+	return nil
+}
+
+func payloadChecksum(buf []byte) uint32 {
+	checksum := crc32.Update(0, payloadTable, buf[:payloadChecksumOffset])
+	return crc32.Update(checksum, payloadTable, buf[payloadChecksumOffset+4:])
+}
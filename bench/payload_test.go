@@ -0,0 +1,117 @@
+package bench
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+)
+
+func newTestVerifier(t *testing.T, keys int) *Verifier {
+	opts := *DefaultOptions
+	opts.Keymin, opts.Keymax = 0, keys-1
+	space, err := NewKeySpace(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewVerifier(space)
+}
+
+func TestPayload(t *testing.T) {
+	verifier := newTestVerifier(t, 2)
+	data, version := verifier.Encode(make([]byte, 100), 1, "key_1")
+	if len(data) != 100 || version != 1 {
+		t.Fatalf("expect a payload of 100 bytes of version 1, got %d bytes of version %d", len(data), version)
+	} else if binary.BigEndian.Uint32(data) != PayloadMagic || string(data[PayloadHeaderSize:PayloadHeaderSize+5]) != "key_1" {
+		t.Fatalf("unexpected header %x", data[:PayloadHeaderSize+5])
+	} else if err := verifier.Verify(data, "key_1", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Buffers smaller than the header are extended.
+	if data, _ := verifier.Encode(make([]byte, 0, 64), 0, "key_0"); len(data) != PayloadOverhead("key_0") {
+		t.Fatalf("expect a payload of %d bytes, got %d", PayloadOverhead("key_0"), len(data))
+	} else if err := verifier.Verify(data, "key_0", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	tamper := func(change func([]byte) []byte) []byte {
+		tampered := append([]byte(nil), data...)
+		return change(tampered)
+	}
+	for _, c := range []struct {
+		name   string
+		data   []byte
+		key    string
+		acked  uint64
+		expect error
+	}{
+		{"magic", tamper(func(b []byte) []byte { b[0]++; return b }), "key_1", 0, ErrPayloadHeader},
+		{"short", data[:PayloadHeaderSize-1], "key_1", 0, ErrPayloadHeader},
+		{"truncated", data[:99], "key_1", 0, ErrPayloadLength},
+		{"extended", append(tamper(func(b []byte) []byte { return b }), 0), "key_1", 0, ErrPayloadLength},
+		{"key", data, "key_2", 0, ErrPayloadKey},
+		{"key length", tamper(func(b []byte) []byte { b[20] = 0xff; return b }), "key_1", 0, ErrPayloadKey},
+		{"body", tamper(func(b []byte) []byte { b[99]++; return b }), "key_1", 0, ErrPayloadChecksum},
+		{"version", tamper(func(b []byte) []byte { b[11]++; return b }), "key_1", 0, ErrPayloadChecksum},
+		{"stale", data, "key_1", 2, ErrPayloadStale},
+	} {
+		if err := verifier.Verify(c.data, c.key, c.acked); err != c.expect {
+			t.Errorf("%s: expect %v, got %v", c.name, c.expect, err)
+		}
+	}
+}
+
+func TestVerifierVersions(t *testing.T) {
+	verifier := newTestVerifier(t, 1)
+	if acked := verifier.Acked(0); acked != 0 {
+		t.Fatalf("expect no acked version, got %d", acked)
+	}
+	buf := make([]byte, 64)
+
+	_, v1 := verifier.Encode(buf, 0, "key_0")
+	verifier.Ack(0, v1)
+	if acked := verifier.Acked(0); acked != v1 {
+		t.Fatalf("expect acked version %d, got %d", v1, acked)
+	}
+
+	// SETs in flight when a SET began may be applied after it, so GETs may still return them.
+	_, v2 := verifier.Encode(buf, 0, "key_0")
+	_, v3 := verifier.Encode(buf, 0, "key_0")
+	verifier.Ack(0, v3)
+	if acked := verifier.Acked(0); acked != v2 {
+		t.Fatalf("expect acked version %d of the SET in flight, got %d", v2, acked)
+	}
+	verifier.Ack(0, v2)
+	if acked := verifier.Acked(0); acked != v2 {
+		t.Fatalf("expect acked version %d, got %d", v2, acked)
+	}
+
+	// Failed SETs do not advance the acked version.
+	_, v4 := verifier.Encode(buf, 0, "key_0")
+	verifier.Fail(0, v4)
+	if acked := verifier.Acked(0); acked != v2 {
+		t.Fatalf("expect acked version %d after a failed SET, got %d", v2, acked)
+	}
+
+	// A failed SET older than the acked version may have been applied last.
+	_, v5 := verifier.Encode(buf, 0, "key_0")
+	verifier.Ack(0, v5)
+	verifier.Fail(0, v4)
+	if acked := verifier.Acked(0); acked != v4 {
+		t.Fatalf("expect acked version %d of the failed SET, got %d", v4, acked)
+	}
+}
+
+func TestRunVerify(t *testing.T) {
+	opts := testOptions()
+	opts.DSN = "file://" + t.TempDir()
+	opts.Op, opts.Verify, opts.Load = OP_MIXED, true, true
+	opts.Requests = 200
+	ret, err := Run(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	} else if ret.Failed != 0 || ret.Verified == 0 || ret.Verified != ret.Ops["GET"].Requests {
+		t.Fatalf("expect all GETs to be verified, got %d verified of %d GETs and %d failed",
+			ret.Verified, ret.Ops["GET"].Requests, ret.Failed)
+	}
+}
@@ -0,0 +1,44 @@
+package bench
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// PlaybackResult is the machine-readable summary of a trace playback by simulator/playback.
+// Hit ratios are in percent, and memory is in bytes.
+type PlaybackResult struct {
+	Trace              string            `json:"trace"`
+	Elapsed            float64           `json:"elapsed"` // In seconds.
+	Records            int64             `json:"records"`
+	Lambdas            int               `json:"lambdas"`
+	TotalMemory        uint64            `json:"total_memory"`
+	MemoryPerLambda    float64           `json:"memory_per_lambda"` // Mean of lambdas.
+	MinMemoryPerLambda uint64            `json:"min_memory_per_lambda"`
+	MaxMemoryPerLambda uint64            `json:"max_memory_per_lambda"`
+	MinChunksPerLambda int               `json:"min_chunks_per_lambda"`
+	MaxChunksPerLambda int               `json:"max_chunks_per_lambda"`
+	ChunksSet          int               `json:"chunks_set"`
+	ChunksGot          uint64            `json:"chunks_got"`
+	ChunksReset        uint64            `json:"chunks_reset"`
+	ChunkHitRatio      float64           `json:"chunk_hit_ratio"`
+	Puts               int               `json:"puts"`
+	PutsSucceeded      int               `json:"puts_succeeded"`
+	Gets               int               `json:"gets"`
+	GetsSucceeded      int               `json:"gets_succeeded"`
+	Misses             int               `json:"misses"`
+	Timeouts           int               `json:"timeouts"`
+	Retries            int               `json:"retries"`          // Attempts after the first ones of requests.
+	Faults             map[string]uint64 `json:"faults,omitempty"` // Requests by injected fault.
+	HitRatio           float64           `json:"hit_ratio"`
+	ActiveMinutes      int               `json:"active_minutes"`
+	BalancerCost       float64           `json:"balancer_cost"` // Per request in milliseconds.
+	MaxConcurrency     int               `json:"max_concurrency"`
+}
+
+// WriteJSON writes the summary in JSON format.
+func (r *PlaybackResult) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
@@ -0,0 +1,197 @@
+package bench
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+const (
+	RAMP_CLIENTS = "clients"
+	RAMP_RATE    = "rate"
+
+	// RAMP_MAX_STEPS is the max number of steps up of ramps without a max load.
+	RAMP_MAX_STEPS = 20
+)
+
+var (
+	ErrInvalidRamp = errors.New("invalid ramp")
+)
+
+// Ramp steps the offered load upward until the latency or the error rate breaks the SLO, and finds the knee:
+// the max throughput sustained within the SLO. The load is the number of clients, or the target rate of the
+// open-loop mode in which latencies include the queueing delay. The load grows by Step if set, or by Factor.
+// After the SLO breaks, the load between the last good step and the first bad step is bisected Refine times.
+type Ramp struct {
+	By           string        // RAMP_CLIENTS or RAMP_RATE.
+	Start        float64       // Load of the first step.
+	Step         float64       // Increment of the load per step.
+	Factor       float64       // Multiplier of the load per step if Step is 0.
+	Max          float64       // Max load. The ramp stops after RAMP_MAX_STEPS steps if 0.
+	SLO          time.Duration // Latency objective at Percentile.
+	Percentile   float64
+	MaxErrorRate float64 // Max percentage of failed requests, not-found requests are not counted.
+	Refine       int
+}
+
+// RampStep is the result of a step of the ramp.
+type RampStep struct {
+	Load       float64 `json:"load"`
+	Throughput float64 `json:"throughput"`
+	Latency    float64 `json:"latency"`    // Latency at the percentile of the SLO in milliseconds.
+	ErrorRate  float64 `json:"error_rate"` // Percentage of failed requests.
+	OK         bool    `json:"ok"`         // Whether the step meets the SLO.
+	Result     *Result `json:"result,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// RampResult is the result of a ramp.
+type RampResult struct {
+	By           string      `json:"by"`
+	SLO          float64     `json:"slo"` // In milliseconds.
+	Percentile   float64     `json:"percentile"`
+	MaxErrorRate float64     `json:"max_error_rate"`
+	Steps        []*RampStep `json:"steps"`     // In the order of running.
+	Knee         *RampStep   `json:"knee"`      // The step with the max throughput within the SLO, nil if no step meets the SLO.
+	Saturated    bool        `json:"saturated"` // Whether the SLO broke before the max load or step. The knee is not found otherwise.
+}
+
+func (r *Ramp) validate() error {
+	switch {
+	case r.By != RAMP_CLIENTS && r.By != RAMP_RATE:
+		return fmt.Errorf("%w: unsupported load %s", ErrInvalidRamp, r.By)
+	case r.Start <= 0:
+		return fmt.Errorf("%w: start load must be positive", ErrInvalidRamp)
+	case r.Step < 0 || (r.Step == 0 && r.Factor <= 1):
+		return fmt.Errorf("%w: step must be positive or factor must be greater than 1", ErrInvalidRamp)
+	case r.SLO <= 0:
+		return fmt.Errorf("%w: SLO must be positive", ErrInvalidRamp)
+	case r.Percentile <= 0 || r.Percentile > 100:
+		return fmt.Errorf("%w: percentile must be in (0, 100]", ErrInvalidRamp)
+	}
+	return nil
+}
+
+// next returns the load of the next step. The number of clients grows by at least 1.
+func (r *Ramp) next(load float64) float64 {
+	next := load * r.Factor
+	if r.Step > 0 {
+		next = load + r.Step
+	}
+	if next = r.round(next); r.By == RAMP_CLIENTS && next <= load {
+		next = load + 1
+	}
+	return next
+}
+
+// more returns whether the ramp steps up to the load after the steps.
+func (r *Ramp) more(load float64, steps int) bool {
+	if r.Max > 0 {
+		return load <= r.Max
+	}
+	return steps < RAMP_MAX_STEPS
+}
+
+// round rounds the load of clients to an integer.
+func (r *Ramp) round(load float64) float64 {
+	if r.By == RAMP_CLIENTS {
+		return math.Round(load)
+	}
+	return load
+}
+
+// Run runs the ramp with the load applied over the base options. Each step creates its own clients.
+// The report function, if set, is called on the completion of each step.
+func (r *Ramp) Run(ctx context.Context, base *Options, report func(*RampStep)) (*RampResult, error) {
+	if err := r.validate(); err != nil {
+		return nil, err
+	}
+	ret := &RampResult{
+		By:           r.By,
+		SLO:          ToMillis(int64(r.SLO)),
+		Percentile:   r.Percentile,
+		MaxErrorRate: r.MaxErrorRate,
+	}
+
+	run := func(load float64) (*RampStep, error) {
+		opts := *base
+		if r.By == RAMP_CLIENTS {
+			opts.Clients = int(load)
+		} else {
+			opts.Rate = load
+		}
+		step := r.measure(ctx, load, &opts)
+		ret.Steps = append(ret.Steps, step)
+		if step.OK && (ret.Knee == nil || step.Throughput > ret.Knee.Throughput) {
+			ret.Knee = step
+		}
+		if report != nil {
+			report(step)
+		}
+		return step, ctx.Err()
+	}
+
+	// Step up until the SLO breaks.
+	var good, bad float64
+	for load, steps := r.round(r.Start), 0; r.more(load, steps); load, steps = r.next(load), steps+1 {
+		step, err := run(load)
+		if err != nil {
+			return ret, err
+		} else if !step.OK {
+			bad = load
+			break
+		}
+		good = load
+	}
+	if bad == 0 {
+		return ret, nil
+	}
+	ret.Saturated = true
+
+	// Bisect between the last good load and the first bad load.
+	for i := 0; i < r.Refine; i++ {
+		load := r.round((good + bad) / 2)
+		if load <= good || load >= bad {
+			break
+		}
+		step, err := run(load)
+		if err != nil {
+			return ret, err
+		} else if step.OK {
+			good = load
+		} else {
+			bad = load
+		}
+	}
+	return ret, nil
+}
+
+// measure runs a step and checks the result against the SLO. A step that fails to run breaks the SLO.
+func (r *Ramp) measure(ctx context.Context, load float64, opts *Options) *RampStep {
+	step := &RampStep{Load: load}
+	ret, err := Run(ctx, opts)
+	if err != nil {
+		step.Error = err.Error()
+	}
+	if ret == nil {
+		return step
+	}
+
+	step.Result = ret
+	step.Throughput = ret.Throughput
+	step.Latency = ToMillis(ret.Histogram().Percentile(r.Percentile))
+	step.ErrorRate = ret.ErrorRate()
+	step.OK = err == nil && ret.Requests > 0 && step.Latency <= ToMillis(int64(r.SLO)) && step.ErrorRate <= r.MaxErrorRate
+	return step
+}
+
+// WriteJSON writes the result, including results of all steps, in JSON format.
+func (r *RampResult) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
@@ -0,0 +1,118 @@
+package bench
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ds2-lab/infinibench/benchclient"
+)
+
+// RAMP_TEST_KNEE is the number of clients of the ramptest backend, beyond which requests slow down by 10 times.
+const RAMP_TEST_KNEE = 4
+
+func init() {
+	benchclient.Register("ramptest", func(u *url.URL) (benchclient.Constructor, error) {
+		construct, err := benchclient.NewConstructor("dummy://")
+		if err != nil {
+			return nil, err
+		}
+		clients := new(int32)
+		return func() benchclient.Client {
+			atomic.AddInt32(clients, 1)
+			return &slowClient{ContextClient: benchclient.WithContext(construct()), clients: clients}
+		}, nil
+	})
+}
+
+type slowClient struct {
+	benchclient.ContextClient
+	clients *int32
+}
+
+func (c *slowClient) EcSetContext(ctx context.Context, key string, val []byte, opts ...benchclient.RequestOption) (string, error) {
+	if atomic.LoadInt32(c.clients) > RAMP_TEST_KNEE {
+		time.Sleep(10 * time.Millisecond)
+	} else {
+		time.Sleep(time.Millisecond)
+	}
+	return c.ContextClient.EcSetContext(ctx, key, val, opts...)
+}
+
+func TestRampKnee(t *testing.T) {
+	opts := testOptions()
+	opts.DSN = "ramptest://"
+	opts.Requests = 20
+	ramp := &Ramp{By: RAMP_CLIENTS, Start: 1, Factor: 2, SLO: 5 * time.Millisecond, Percentile: 99, MaxErrorRate: 1, Refine: 3}
+	var reported []float64
+	ret, err := ramp.Run(context.Background(), opts, func(step *RampStep) {
+		reported = append(reported, step.Load)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Steps up to 8 clients, and bisects between 4 and 8.
+	expect := []float64{1, 2, 4, 8, 6, 5}
+	if len(ret.Steps) != len(expect) || len(reported) != len(expect) {
+		t.Fatalf("expect steps %v, reported %v", expect, reported)
+	}
+	for i, step := range ret.Steps {
+		if step.Load != expect[i] || reported[i] != expect[i] {
+			t.Fatalf("expect steps %v, reported %v", expect, reported)
+		} else if ok := step.Load <= RAMP_TEST_KNEE; step.OK != ok {
+			t.Fatalf("step of %v clients: expect ok %v, got %v at %.3f milliseconds", step.Load, ok, step.OK, step.Latency)
+		}
+	}
+	if !ret.Saturated || ret.Knee == nil || ret.Knee.Load != RAMP_TEST_KNEE {
+		t.Fatalf("expect the knee at %d clients, got %+v", RAMP_TEST_KNEE, ret.Knee)
+	}
+}
+
+func TestRampMaxSteps(t *testing.T) {
+	opts := testOptions()
+	opts.DSN = "dummy://"
+	opts.Requests = 1
+	ramp := &Ramp{By: RAMP_CLIENTS, Start: 1, Step: 1, SLO: time.Hour, Percentile: 99, MaxErrorRate: 1}
+	ret, err := ramp.Run(context.Background(), opts, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(ret.Steps) != RAMP_MAX_STEPS || ret.Steps[RAMP_MAX_STEPS-1].Load != RAMP_MAX_STEPS {
+		t.Fatalf("expect %d steps without a max load, got %d", RAMP_MAX_STEPS, len(ret.Steps))
+	} else if ret.Saturated {
+		t.Fatal("the knee is found without breaking the SLO")
+	}
+
+	// The max load caps the steps.
+	ramp.Max = 3
+	if ret, err = ramp.Run(context.Background(), opts, nil); err != nil {
+		t.Fatal(err)
+	} else if len(ret.Steps) != 3 || ret.Saturated || ret.Knee == nil {
+		t.Fatalf("expect 3 steps within the SLO, got %d", len(ret.Steps))
+	}
+}
+
+func TestRampValidate(t *testing.T) {
+	valid := Ramp{By: RAMP_RATE, Start: 100, Factor: 2, SLO: time.Millisecond, Percentile: 99}
+	if err := valid.validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, change := range []func(r *Ramp){
+		func(r *Ramp) { r.By = "servers" },
+		func(r *Ramp) { r.Start = 0 },
+		func(r *Ramp) { r.Step = -1 },
+		func(r *Ramp) { r.Factor = 1 },
+		func(r *Ramp) { r.SLO = 0 },
+		func(r *Ramp) { r.Percentile = 0 },
+		func(r *Ramp) { r.Percentile = 101 },
+	} {
+		ramp := valid
+		change(&ramp)
+		if _, err := ramp.Run(context.Background(), testOptions(), nil); !errors.Is(err, ErrInvalidRamp) {
+			t.Fatalf("%+v: expect %v, got %v", ramp, ErrInvalidRamp, err)
+		}
+	}
+}
@@ -0,0 +1,374 @@
+package bench
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/ds2-lab/infinibench/histogram"
+)
+
+// Result is the machine-readable result of a benchmark run.
+// Throughput and latencies cover successful requests in the measurement window only.
+// Latencies are in milliseconds, and histograms count latencies in nanoseconds.
+type Result struct {
+	Options        *Options             `json:"options"`
+	Environment    Environment          `json:"environment"`
+	Seed           int64                `json:"seed"`     // Seed of the run, pass as Options.Seed to repeat the workload.
+	Duration       float64              `json:"duration"` // Seconds of the measurement window.
+	Requests       uint64               `json:"requests"`
+	Bytes          uint64               `json:"bytes"`
+	Throughput     float64              `json:"throughput"`
+	BytesPerSecond float64              `json:"bytes_per_second"`
+	NotFound       uint64               `json:"not_found"`
+	Failed         uint64               `json:"failed"`
+	Timeouts       uint64               `json:"timeouts"` // Requests that exceeded Options.Timeout, not counted as failed.
+	Retries        uint64               `json:"retries"`  // Attempts after the first ones of requests, see Options.Attempts.
+	Verified       uint64               `json:"verified,omitempty"`
+	Pipeline       int                  `json:"pipeline"` // Number of requests actually pipelined.
+	OpenLoop       *OpenLoopResult      `json:"open_loop,omitempty"`
+	Faults         map[string]uint64    `json:"faults,omitempty"` // Requests of the whole run by injected fault, see Options.Faults.
+	Ops            map[string]*OpResult `json:"ops"`
+	Warnings       []string             `json:"warnings,omitempty"`
+
+	results [][]result
+	elapsed time.Duration
+}
+
+// Environment describes where and when the benchmark ran.
+type Environment struct {
+	Host      string    `json:"host"`
+	GoVersion string    `json:"go_version"`
+	OS        string    `json:"os"`
+	Arch      string    `json:"arch"`
+	NumCPU    int       `json:"num_cpu"`
+	Args      []string  `json:"args"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+}
+
+// OpenLoopResult describes how well the system kept up with the target rate in the open-loop mode.
+type OpenLoopResult struct {
+	Arrival    string  `json:"arrival"`
+	Rate       float64 `json:"rate"`
+	MaxBacklog int     `json:"max_backlog"`
+	Late       uint64  `json:"late"`
+	MaxDelay   float64 `json:"max_delay"` // In milliseconds.
+}
+
+// OpResult is the result of one type of operation.
+type OpResult struct {
+	Requests          uint64               `json:"requests"`
+	Bytes             uint64               `json:"bytes"`
+	Throughput        float64              `json:"throughput"`
+	BytesPerSecond    float64              `json:"bytes_per_second"`
+	NotFound          uint64               `json:"not_found"`
+	Failed            uint64               `json:"failed"`
+	Timeouts          uint64               `json:"timeouts"`
+	Retries           uint64               `json:"retries"`
+	Errors            map[string]uint64    `json:"errors,omitempty"` // Failed requests by error.
+	Latency           LatencySummary       `json:"latency"`
+	Histogram         *histogram.Histogram `json:"histogram"`
+	NotFoundHistogram *histogram.Histogram `json:"not_found_histogram,omitempty"`
+	FailedHistogram   *histogram.Histogram `json:"failed_histogram,omitempty"`
+	RetryHistogram    *histogram.Histogram `json:"retry_histogram,omitempty"` // Time retried requests spent before their last attempts.
+	Sizes             []*SizeResult        `json:"sizes,omitempty"`           // Latencies by size bucket in ascending order.
+}
+
+// SizeResult summarizes latencies of requests in a size bucket.
+type SizeResult struct {
+	Bucket     string         `json:"bucket"`
+	Throughput float64        `json:"throughput"`
+	Latency    LatencySummary `json:"latency"`
+}
+
+// LatencySummary summarizes a latency histogram in milliseconds.
+type LatencySummary struct {
+	Count  uint64  `json:"count"`
+	Min    float64 `json:"min"`
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"stddev"`
+	P50    float64 `json:"p50"`
+	P90    float64 `json:"p90"`
+	P99    float64 `json:"p99"`
+	P999   float64 `json:"p99.9"`
+	P9999  float64 `json:"p99.99"`
+	Max    float64 `json:"max"`
+}
+
+func newEnvironment(start time.Time) Environment {
+	host, _ := os.Hostname()
+	args := make([]string, len(os.Args))
+	for i, arg := range os.Args {
+		args[i] = redactArg(arg)
+	}
+	return Environment{
+		Host:      host,
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		NumCPU:    runtime.NumCPU(),
+		Args:      args,
+		Start:     start,
+		End:       time.Now(),
+	}
+}
+
+// Summarize summarizes the latency histogram.
+func Summarize(hist *histogram.Histogram) LatencySummary {
+	return LatencySummary{
+		Count:  hist.Total,
+		Min:    ToMillis(hist.Min),
+		Mean:   hist.Mean() / float64(time.Millisecond),
+		StdDev: hist.StdDev() / float64(time.Millisecond),
+		P50:    ToMillis(hist.Percentile(50)),
+		P90:    ToMillis(hist.Percentile(90)),
+		P99:    ToMillis(hist.Percentile(99)),
+		P999:   ToMillis(hist.Percentile(99.9)),
+		P9999:  ToMillis(hist.Percentile(99.99)),
+		Max:    ToMillis(hist.Max),
+	}
+}
+
+// newResult builds the result from the stats of the measurement window.
+func newResult(opts *Options, stats []opStats, real time.Duration, start time.Time, bySize bool) *Result {
+	ret := &Result{
+		Options:     opts.redacted(),
+		Environment: newEnvironment(start),
+		Duration:    real.Seconds(),
+		Ops:         make(map[string]*OpResult),
+	}
+	for op := range stats {
+		s := &stats[op]
+		if s.count+s.notFound.Total+s.failed.Total+s.timeouts == 0 {
+			continue
+		}
+		opRet := &OpResult{
+			Requests:  s.count,
+			Bytes:     s.totalPayload,
+			NotFound:  s.notFound.Total,
+			Failed:    s.failed.Total,
+			Timeouts:  s.timeouts,
+			Retries:   s.retries,
+			Errors:    s.errors,
+			Latency:   Summarize(s.latency),
+			Histogram: s.latency,
+		}
+		if real > 0 {
+			opRet.Throughput = float64(s.count) / real.Seconds()
+			opRet.BytesPerSecond = float64(s.totalPayload) / real.Seconds()
+		}
+		if s.notFound.Total > 0 {
+			opRet.NotFoundHistogram = s.notFound
+		}
+		if s.failed.Total > 0 {
+			opRet.FailedHistogram = s.failed
+		}
+		if s.retried.Total > 0 {
+			opRet.RetryHistogram = s.retried
+		}
+		if bySize {
+			buckets := make([]int, 0, len(s.sizes))
+			for bucket := range s.sizes {
+				buckets = append(buckets, bucket)
+			}
+			sort.Ints(buckets)
+			for _, bucket := range buckets {
+				size := &SizeResult{Bucket: sizeBucketName(bucket), Latency: Summarize(s.sizes[bucket])}
+				if real > 0 {
+					size.Throughput = float64(size.Latency.Count) / real.Seconds()
+				}
+				opRet.Sizes = append(opRet.Sizes, size)
+			}
+		}
+		ret.Ops[OpNames[op]] = opRet
+
+		ret.Requests += opRet.Requests
+		ret.Bytes += opRet.Bytes
+		ret.NotFound += opRet.NotFound
+		ret.Failed += opRet.Failed
+		ret.Timeouts += opRet.Timeouts
+		ret.Retries += opRet.Retries
+	}
+	if real > 0 {
+		ret.Throughput = float64(ret.Requests) / real.Seconds()
+		ret.BytesPerSecond = float64(ret.Bytes) / real.Seconds()
+	}
+	return ret
+}
+
+// MergeResults merges results of concurrent runs of the same workload, e.g. runs of distributed workers,
+// into the result of the options. Counters and histograms are summed, and throughput is of the longest run.
+// Results by size bucket can not be merged and are dropped.
+func MergeResults(opts *Options, start time.Time, results ...*Result) *Result {
+	ret := &Result{
+		Options:     opts.redacted(),
+		Environment: newEnvironment(start),
+		Seed:        opts.Seed,
+		Ops:         make(map[string]*OpResult),
+	}
+	warnings := make(map[string]bool)
+	for _, r := range results {
+		if r == nil {
+			continue
+		}
+		ret.Duration = math.Max(ret.Duration, r.Duration)
+		ret.Requests += r.Requests
+		ret.Bytes += r.Bytes
+		ret.NotFound += r.NotFound
+		ret.Failed += r.Failed
+		ret.Timeouts += r.Timeouts
+		ret.Retries += r.Retries
+		ret.Verified += r.Verified
+		for fault, n := range r.Faults {
+			if ret.Faults == nil {
+				ret.Faults = make(map[string]uint64)
+			}
+			ret.Faults[fault] += n
+		}
+		if ret.Pipeline == 0 || r.Pipeline < ret.Pipeline {
+			ret.Pipeline = r.Pipeline
+		}
+		for _, warning := range r.Warnings {
+			if !warnings[warning] {
+				warnings[warning] = true
+				ret.Warnings = append(ret.Warnings, warning)
+			}
+		}
+		if r.OpenLoop != nil {
+			if ret.OpenLoop == nil {
+				ret.OpenLoop = &OpenLoopResult{Arrival: r.OpenLoop.Arrival}
+			}
+			// Backlogs of workers may peak at different times, so the sum is an upper bound.
+			ret.OpenLoop.Rate += r.OpenLoop.Rate
+			ret.OpenLoop.MaxBacklog += r.OpenLoop.MaxBacklog
+			ret.OpenLoop.Late += r.OpenLoop.Late
+			ret.OpenLoop.MaxDelay = math.Max(ret.OpenLoop.MaxDelay, r.OpenLoop.MaxDelay)
+		}
+		for name, op := range r.Ops {
+			merged := ret.Ops[name]
+			if merged == nil {
+				merged = &OpResult{Histogram: histogram.New()}
+				ret.Ops[name] = merged
+			}
+			merged.Requests += op.Requests
+			merged.Bytes += op.Bytes
+			merged.NotFound += op.NotFound
+			merged.Failed += op.Failed
+			merged.Timeouts += op.Timeouts
+			merged.Retries += op.Retries
+			for err, n := range op.Errors {
+				if merged.Errors == nil {
+					merged.Errors = make(map[string]uint64)
+				}
+				merged.Errors[err] += n
+			}
+			merged.Histogram.Merge(op.Histogram)
+			if op.NotFoundHistogram != nil {
+				if merged.NotFoundHistogram == nil {
+					merged.NotFoundHistogram = histogram.New()
+				}
+				merged.NotFoundHistogram.Merge(op.NotFoundHistogram)
+			}
+			if op.FailedHistogram != nil {
+				if merged.FailedHistogram == nil {
+					merged.FailedHistogram = histogram.New()
+				}
+				merged.FailedHistogram.Merge(op.FailedHistogram)
+			}
+			if op.RetryHistogram != nil {
+				if merged.RetryHistogram == nil {
+					merged.RetryHistogram = histogram.New()
+				}
+				merged.RetryHistogram.Merge(op.RetryHistogram)
+			}
+		}
+	}
+
+	for _, op := range ret.Ops {
+		op.Latency = Summarize(op.Histogram)
+		if ret.Duration > 0 {
+			op.Throughput = float64(op.Requests) / ret.Duration
+			op.BytesPerSecond = float64(op.Bytes) / ret.Duration
+		}
+	}
+	if ret.Duration > 0 {
+		ret.Throughput = float64(ret.Requests) / ret.Duration
+		ret.BytesPerSecond = float64(ret.Bytes) / ret.Duration
+	}
+	return ret
+}
+
+// Op returns the result of the operation, or nil if no request of the operation was sent.
+func (r *Result) Op(op int) *OpResult {
+	if op < 0 || op >= len(OpNames) {
+		return nil
+	}
+	return r.Ops[OpNames[op]]
+}
+
+// Histogram merges latency histograms of successful requests of all operations.
+func (r *Result) Histogram() *histogram.Histogram {
+	hist := histogram.New()
+	for _, op := range r.Ops {
+		hist.Merge(op.Histogram)
+	}
+	return hist
+}
+
+// Latency summarizes latencies of successful requests of all operations.
+func (r *Result) Latency() LatencySummary {
+	return Summarize(r.Histogram())
+}
+
+// ErrorRate returns the percentage of failed and timed out requests, not-found requests are not counted as failed.
+func (r *Result) ErrorRate() float64 {
+	if total := r.Requests + r.NotFound + r.Failed + r.Timeouts; total > 0 {
+		return float64(r.Failed+r.Timeouts) * 100 / float64(total)
+	}
+	return 0
+}
+
+// ErrorRate returns the percentage of failed and timed out requests of the operation, not-found requests are not
+// counted as failed.
+func (o *OpResult) ErrorRate() float64 {
+	if total := o.Requests + o.NotFound + o.Failed + o.Timeouts; total > 0 {
+		return float64(o.Failed+o.Timeouts) * 100 / float64(total)
+	}
+	return 0
+}
+
+// Series groups requests of the whole run, including the warmup and cooldown windows, into rows of the interval.
+func (r *Result) Series(interval time.Duration) []SeriesRow {
+	return series(r.results, interval, r.elapsed)
+}
+
+// WriteJSON writes the result in JSON format.
+func (r *Result) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// ExportHistograms writes the latency histograms of all operations in csv format.
+func (r *Result) ExportHistograms(w io.Writer) error {
+	fmt.Fprintf(w, "#op,low(ns),high(ns),count,percentile\n")
+	for _, name := range OpNames {
+		if op := r.Ops[name]; op != nil {
+			if err := op.Histogram.Export(w, name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ToMillis converts nanoseconds to milliseconds.
+func ToMillis(ns int64) float64 {
+	return float64(ns) / float64(time.Millisecond)
+}
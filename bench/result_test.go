@@ -0,0 +1,56 @@
+package bench
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestResultJSON(t *testing.T) {
+	opts := testOptions()
+	opts.Op, opts.Load = OP_MIXED, true
+	ret, err := Run(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := ret.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// Fields are named in snake case, and options are kept without functions.
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(buf.Bytes(), &fields); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"options", "environment", "seed", "duration", "requests", "throughput", "bytes_per_second", "not_found", "failed", "ops"} {
+		if _, ok := fields[field]; !ok {
+			t.Errorf("expect the field %s in %s", field, buf.String())
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "result.json")
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	kind, decoded, _, err := ReadResult(path)
+	if err != nil {
+		t.Fatal(err)
+	} else if kind != RESULT_BENCH || decoded.Requests != ret.Requests || decoded.Seed != ret.Seed || decoded.Options.Clients != opts.Clients {
+		t.Fatalf("unexpected result of kind %s: %+v", kind, decoded)
+	}
+	for name, op := range ret.Ops {
+		got := decoded.Ops[name]
+		if got == nil || got.Requests != op.Requests || got.Latency != op.Latency || got.Histogram.Total != op.Histogram.Total {
+			t.Fatalf("%s: expect %+v, got %+v", name, op, got)
+		} else if got.Histogram.Percentile(99) != op.Histogram.Percentile(99) {
+			t.Fatalf("%s: expect p99 of %d, got %d", name, op.Histogram.Percentile(99), got.Histogram.Percentile(99))
+		}
+	}
+	if decoded.Latency() != ret.Latency() {
+		t.Fatalf("expect latencies %+v, got %+v", ret.Latency(), decoded.Latency())
+	}
+}
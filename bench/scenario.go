@@ -0,0 +1,286 @@
+package bench
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	PHASE_CLEANUP = "cleanup"
+)
+
+// Scenario is a list of phases run in order. A scenario file in JSON or YAML looks like:
+//
+//	name: nightly
+//	options:            # Overrides the base options for all phases.
+//	  clientlib: redis
+//	  keymin: 1
+//	  keymax: 1000
+//	phases:
+//	  - name: load      # Fills the key range with SETs.
+//	    type: load
+//	    clients: 8
+//	  - name: mixed     # Option names are case-insensitive.
+//	    op: 2
+//	    readpercent: 95
+//	    duration: 5m
+//	  - name: ramp      # Each step overrides the options of the phase.
+//	    op: 1
+//	    duration: 30s
+//	    steps: [{clients: 1}, {clients: 4}, {clients: 16}]
+//	  - name: cleanup   # Deletes the key range.
+//	    type: cleanup
+//
+// Durations can be written as strings like "30s". Load phases ignore warmups, cooldowns, intervals, faults and the
+// verify mode, so phases that verify objects set them, e.g. with "load: true".
+type Scenario struct {
+	Name   string
+	Phases []*Phase
+}
+
+// Phase is a phase of a scenario.
+type Phase struct {
+	Name    string
+	Type    string // PHASE_LOAD, PHASE_RUN, or PHASE_CLEANUP.
+	Options *Options
+	Steps   []*Options // Runs of a ramp, the phase runs with Options if empty.
+}
+
+// PhaseResult is the result of a phase, or a step of a ramp.
+type PhaseResult struct {
+	Name    string  `json:"name"`
+	Type    string  `json:"type"`
+	Result  *Result `json:"result,omitempty"`
+	Deleted int     `json:"deleted,omitempty"` // Number of keys deleted in the cleanup phase.
+	Error   string  `json:"error,omitempty"`
+}
+
+// ScenarioResult is the result of a scenario.
+type ScenarioResult struct {
+	Name   string         `json:"name"`
+	Phases []*PhaseResult `json:"phases"`
+}
+
+type scenarioSpec struct {
+	Name    string
+	Options json.RawMessage
+	Phases  []json.RawMessage
+}
+
+type phaseSpec struct {
+	Options
+	Name  string
+	Type  string
+	Steps []json.RawMessage
+}
+
+// LoadScenario reads the scenario file in JSON, or in YAML if the file ends with ".yaml" or ".yml".
+// Options of the scenario are applied over the base options.
+func LoadScenario(path string, base *Options) (*Scenario, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	format := "json"
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+		format = "yaml"
+	}
+	return ParseScenario(data, format, base)
+}
+
+// ParseScenario parses the scenario in the format of "json" or "yaml".
+func ParseScenario(data []byte, format string, base *Options) (*Scenario, error) {
+	var doc interface{}
+	switch format {
+	case "json":
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("scenario: %w", err)
+		}
+	case "yaml":
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("scenario: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("scenario: unsupported format: %s", format)
+	}
+	doc, err := normalizeScenario(doc)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = json.Marshal(doc); err != nil {
+		return nil, fmt.Errorf("scenario: %w", err)
+	}
+
+	var spec scenarioSpec
+	if err := decodeStrict(data, &spec); err != nil {
+		return nil, err
+	}
+	opts := *base
+	if len(spec.Options) > 0 {
+		if err := decodeStrict(spec.Options, &opts); err != nil {
+			return nil, err
+		}
+	}
+
+	scenario := &Scenario{Name: spec.Name, Phases: make([]*Phase, len(spec.Phases))}
+	for i, raw := range spec.Phases {
+		ps := phaseSpec{Options: opts}
+		if err := decodeStrict(raw, &ps); err != nil {
+			return nil, fmt.Errorf("phase %d: %w", i+1, err)
+		}
+		phase := &Phase{Name: ps.Name, Type: ps.Type, Options: &ps.Options}
+		if phase.Type == "" {
+			phase.Type = PHASE_RUN
+		} else if phase.Type != PHASE_LOAD && phase.Type != PHASE_RUN && phase.Type != PHASE_CLEANUP {
+			return nil, fmt.Errorf("phase %d: unsupported type: %s", i+1, phase.Type)
+		}
+		if phase.Name == "" {
+			phase.Name = fmt.Sprintf("%s %d", phase.Type, i+1)
+		}
+		for j, raw := range ps.Steps {
+			step := ps.Options
+			if err := decodeStrict(raw, &step); err != nil {
+				return nil, fmt.Errorf("phase %s step %d: %w", phase.Name, j+1, err)
+			}
+			phase.Steps = append(phase.Steps, &step)
+		}
+		scenario.Phases[i] = phase
+	}
+	return scenario, nil
+}
+
+// decodeStrict decodes JSON data over the value. Unknown fields are rejected to catch typos.
+func decodeStrict(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("scenario: %w", err)
+	}
+	return nil
+}
+
+var durationOptions = func() map[string]bool {
+	names := make(map[string]bool)
+	t := reflect.TypeOf(Options{})
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Type == reflect.TypeOf(time.Duration(0)) {
+			names[strings.ToLower(t.Field(i).Name)] = true
+		}
+	}
+	return names
+}()
+
+// normalizeScenario converts YAML maps to JSON objects and duration strings of options to nanoseconds.
+func normalizeScenario(doc interface{}) (interface{}, error) {
+	switch v := doc.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			m[fmt.Sprint(key)] = val
+		}
+		return normalizeScenario(m)
+	case map[string]interface{}:
+		for key, val := range v {
+			if s, ok := val.(string); ok && durationOptions[strings.ToLower(key)] {
+				d, err := time.ParseDuration(s)
+				if err != nil {
+					return nil, fmt.Errorf("scenario: %s: %w", key, err)
+				}
+				v[key] = int64(d)
+				continue
+			}
+			normalized, err := normalizeScenario(val)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = normalized
+		}
+		return v, nil
+	case []interface{}:
+		for i, val := range v {
+			normalized, err := normalizeScenario(val)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = normalized
+		}
+		return v, nil
+	default:
+		return doc, nil
+	}
+}
+
+// Run runs phases in order. The report function, if set, is called on the completion of each phase or step.
+// Phases after a failed phase are skipped, and results of completed phases are returned with the error.
+func (s *Scenario) Run(ctx context.Context, report func(*PhaseResult)) (*ScenarioResult, error) {
+	ret := &ScenarioResult{Name: s.Name}
+	for _, phase := range s.Phases {
+		steps := phase.Steps
+		if len(steps) == 0 {
+			steps = []*Options{phase.Options}
+		}
+		for i, opts := range steps {
+			phaseRet := &PhaseResult{Name: phase.Name, Type: phase.Type}
+			if len(phase.Steps) > 0 {
+				phaseRet.Name = fmt.Sprintf("%s/%d", phase.Name, i+1)
+			}
+			var err error
+			switch phase.Type {
+			case PHASE_CLEANUP:
+				phaseRet.Deleted, err = Cleanup(ctx, opts)
+			case PHASE_LOAD:
+				phaseRet.Result, err = Run(ctx, loadOptions(opts))
+			default:
+				phaseRet.Result, err = Run(ctx, opts)
+			}
+			if err != nil {
+				phaseRet.Error = err.Error()
+			}
+			ret.Phases = append(ret.Phases, phaseRet)
+			if report != nil {
+				report(phaseRet)
+			}
+			if err != nil {
+				return ret, fmt.Errorf("phase %s: %w", phaseRet.Name, err)
+			}
+		}
+	}
+	return ret, nil
+}
+
+// loadOptions returns the options to fill the key range with sequential SETs once, as fast as possible. Requests of
+// the whole load are measured, and objects are loaded without faults or payloads of the verify mode.
+func loadOptions(opts *Options) *Options {
+	load := *opts
+	if load.Clients < 1 {
+		load.Clients = 1
+	}
+	load.Op = OP_SET
+	load.Requests = (opts.Keymax - opts.Keymin + load.Clients) / load.Clients
+	load.Duration = 0
+	load.Warmup = 0
+	load.Cooldown = 0
+	load.Interval = 0
+	load.Rate = 0
+	load.Load = false
+	load.Verify = false
+	load.Faults = ""
+	return &load
+}
+
+// WriteJSON writes the result in JSON format.
+func (r *ScenarioResult) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
@@ -0,0 +1,172 @@
+package bench
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testScenario = `
+name: nightly
+options:
+  clientlib: redis
+  keymin: 1
+  keymax: 1000
+phases:
+  - name: load
+    type: load
+    clients: 8
+  - Op: 2
+    ReadPercent: 95
+    duration: 5m
+    warmup: 30s
+  - name: ramp
+    op: 1
+    duration: 30s
+    steps: [{clients: 1}, {clients: 4, duration: 1m}]
+  - name: cleanup
+    type: cleanup
+`
+
+func TestParseScenario(t *testing.T) {
+	base := *DefaultOptions
+	base.Clients = 2
+	for _, format := range []string{"yaml", "json"} {
+		data := []byte(testScenario)
+		if format == "json" {
+			data = []byte(`{"name": "nightly", "options": {"clientlib": "redis", "keymin": 1, "keymax": 1000}, "phases": [
+				{"name": "load", "type": "load", "clients": 8},
+				{"Op": 2, "ReadPercent": 95, "duration": "5m", "warmup": 30000000000},
+				{"name": "ramp", "op": 1, "duration": "30s", "steps": [{"clients": 1}, {"clients": 4, "duration": "1m"}]},
+				{"name": "cleanup", "type": "cleanup"}]}`)
+		}
+		scenario, err := ParseScenario(data, format, &base)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		} else if scenario.Name != "nightly" || len(scenario.Phases) != 4 {
+			t.Fatalf("%s: unexpected scenario %+v", format, scenario)
+		}
+
+		names := make([]string, 0, 4)
+		types := make([]string, 0, 4)
+		for _, phase := range scenario.Phases {
+			names, types = append(names, phase.Name), append(types, phase.Type)
+			// Options of the scenario apply to all phases over the base options.
+			if phase.Options.ClientLib != CLIENT_REDIS || phase.Options.Keymax != 1000 || phase.Options.Objsz != base.Objsz {
+				t.Fatalf("%s: phase %s: options of the scenario are not applied: %+v", format, phase.Name, phase.Options)
+			}
+		}
+		if expect := []string{"load", "run 2", "ramp", "cleanup"}; !reflect.DeepEqual(names, expect) {
+			t.Fatalf("%s: expect phases %v, got %v", format, expect, names)
+		} else if expect := []string{PHASE_LOAD, PHASE_RUN, PHASE_RUN, PHASE_CLEANUP}; !reflect.DeepEqual(types, expect) {
+			t.Fatalf("%s: expect types %v, got %v", format, expect, types)
+		}
+
+		if load := scenario.Phases[0].Options; load.Clients != 8 {
+			t.Fatalf("%s: expect 8 clients to load, got %d", format, load.Clients)
+		} else if scenario.Phases[1].Options.Clients != 2 {
+			t.Fatalf("%s: expect the base clients, got %d", format, scenario.Phases[1].Options.Clients)
+		}
+		run := scenario.Phases[1].Options
+		if run.Op != OP_MIXED || run.ReadPercent != 95 || run.Duration != 5*time.Minute || run.Warmup != 30*time.Second {
+			t.Fatalf("%s: unexpected options of the run %+v", format, run)
+		}
+		ramp := scenario.Phases[2]
+		if len(ramp.Steps) != 2 || ramp.Steps[0].Clients != 1 || ramp.Steps[1].Clients != 4 {
+			t.Fatalf("%s: unexpected steps %+v", format, ramp.Steps)
+		} else if ramp.Steps[0].Duration != 30*time.Second || ramp.Steps[1].Duration != time.Minute || ramp.Steps[0].Op != OP_GET {
+			t.Fatalf("%s: steps do not override the phase: %+v", format, ramp.Steps)
+		}
+	}
+}
+
+func TestParseScenarioErrors(t *testing.T) {
+	cases := []struct {
+		doc, format, err string
+	}{
+		{"phases: [{name: x}]", "toml", "unsupported format"},
+		{"phases: [", "yaml", "scenario:"},
+		{`{"phases": [}`, "json", "scenario:"},
+		{"phases: [{clinets: 4}]", "yaml", "unknown field"},
+		{"options: {keymaxx: 4}", "yaml", "unknown field"},
+		{"phases: [{type: warmup}]", "yaml", "unsupported type: warmup"},
+		{"phases: [{duration: 5 minutes}]", "yaml", "duration"},
+		{"phases: [{name: ramp, steps: [{clients: many}]}]", "yaml", "phase ramp step 1"},
+	}
+	for _, c := range cases {
+		if _, err := ParseScenario([]byte(c.doc), c.format, DefaultOptions); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: expect an error of %q, got %v", c.doc, c.err, err)
+		}
+	}
+}
+
+func TestLoadOptions(t *testing.T) {
+	opts := testOptions()
+	opts.Clients = 4
+	opts.Keymin, opts.Keymax = 1, 10
+	opts.Op = OP_MIXED
+	opts.Duration, opts.Warmup, opts.Cooldown = time.Minute, 10*time.Second, 10*time.Second
+	opts.Interval, opts.Rate = 100, 1000
+	opts.Load, opts.Verify = true, true
+	opts.Faults = "error=10"
+
+	load := loadOptions(opts)
+	expect := *opts
+	expect.Op = OP_SET
+	expect.Requests = 3 // Keys are partitioned among clients.
+	expect.Duration, expect.Warmup, expect.Cooldown = 0, 0, 0
+	expect.Interval, expect.Rate = 0, 0
+	expect.Load, expect.Verify = false, false
+	expect.Faults = ""
+	if !reflect.DeepEqual(*load, expect) {
+		t.Fatalf("expect %+v, got %+v", expect, *load)
+	} else if opts.Op != OP_MIXED || !opts.Verify {
+		t.Fatal("options are modified")
+	}
+
+	opts.Clients = 0
+	if load := loadOptions(opts); load.Clients != 1 || load.Requests != 10 {
+		t.Fatalf("expect 1 client of 10 requests, got %d clients of %d requests", load.Clients, load.Requests)
+	}
+}
+
+func TestScenarioRun(t *testing.T) {
+	base := testOptions()
+	base.DSN = "dummy://?ns=TestScenarioRun"
+	scenario, err := ParseScenario([]byte(`
+phases:
+  - type: load
+    clients: 3
+    faults: error=100
+  - op: 1
+    requests: 20
+  - type: cleanup
+  - op: 1
+    requests: 20
+`), "yaml", base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reported int
+	ret, err := scenario.Run(context.Background(), func(*PhaseResult) { reported++ })
+	if err != nil {
+		t.Fatal(err)
+	} else if len(ret.Phases) != 4 || reported != 4 {
+		t.Fatalf("expect 4 phases, got %d, reported %d", len(ret.Phases), reported)
+	}
+
+	// The load phase sets every key once, and GETs of the next phase hit.
+	keys := uint64(base.Keymax - base.Keymin + 1)
+	if load := ret.Phases[0].Result; load.Requests != keys || load.Failed != 0 {
+		t.Fatalf("expect %d keys loaded without errors, got %d requests and %d errors", keys, load.Requests, load.Failed)
+	} else if run := ret.Phases[1].Result; run.Requests == 0 || run.NotFound != 0 {
+		t.Fatalf("%d of %d GETs are not found after loading", run.NotFound, run.Requests)
+	}
+	if cleanup := ret.Phases[2]; cleanup.Deleted != int(keys) {
+		t.Fatalf("expect %d keys deleted, got %d", keys, cleanup.Deleted)
+	} else if run := ret.Phases[3].Result; run.Requests != 0 || run.NotFound == 0 {
+		t.Fatalf("%d GETs are found and %d are not found after cleaning up", run.Requests, run.NotFound)
+	}
+}
@@ -0,0 +1,144 @@
+package bench
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ds2-lab/infinibench/benchclient"
+	"github.com/ds2-lab/infinibench/histogram"
+)
+
+const (
+	SERIES_CSV   = "csv"
+	SERIES_JSONL = "jsonl"
+)
+
+// SeriesRow summarizes requests completed in one interval of the run.
+// Latencies are of successful requests in milliseconds.
+type SeriesRow struct {
+	Time       float64 `json:"time"` // End of the interval in seconds since the start of the run.
+	Requests   uint64  `json:"requests"`
+	Sets       uint64  `json:"sets"`
+	Gets       uint64  `json:"gets"`
+	Throughput float64 `json:"throughput"`
+	Bytes      float64 `json:"bytes_per_second"`
+	NotFound   uint64  `json:"not_found"`
+	Errors     uint64  `json:"errors"`
+	Timeouts   uint64  `json:"timeouts"`
+	P50        float64 `json:"p50"`
+	P90        float64 `json:"p90"`
+	P99        float64 `json:"p99"`
+	Max        float64 `json:"max"`
+}
+
+// series groups results by completion time into rows of the interval. Empty intervals are included.
+// A trailing partial interval shorter than half of the interval is merged into the last row.
+func series(results [][]result, interval time.Duration, real time.Duration) []SeriesRow {
+	n := int((real + interval - 1) / interval)
+	if n > 1 && real-time.Duration(n-1)*interval < interval/2 {
+		n--
+	} else if n < 1 {
+		n = 1
+	}
+	rows := make([]SeriesRow, n)
+	hists := make([]*histogram.Histogram, len(rows))
+	payloads := make([]uint64, len(rows))
+	for i := 0; i < len(results); i++ {
+		for j := 0; j < len(results[i]); j++ {
+			r := &results[i][j]
+			idx := int(r.end / interval)
+			if idx >= len(rows) {
+				idx = len(rows) - 1
+			}
+			switch benchclient.ResultFromError(r.err) {
+			case benchclient.ResultNotFound:
+				rows[idx].NotFound++
+				continue
+			case benchclient.ResultError:
+				rows[idx].Errors++
+				continue
+			case benchclient.ResultTimeout:
+				rows[idx].Timeouts++
+				continue
+			}
+
+			rows[idx].Requests++
+			if r.op == OP_SET {
+				rows[idx].Sets++
+			} else {
+				rows[idx].Gets++
+			}
+			payloads[idx] += uint64(r.size)
+			if hists[idx] == nil {
+				hists[idx] = histogram.New()
+			}
+			hists[idx].Record(int64(r.dur))
+		}
+	}
+
+	for idx := range rows {
+		row := &rows[idx]
+		span := interval
+		if last := real - time.Duration(idx)*interval; idx == len(rows)-1 && last > 0 {
+			span = last
+		}
+		row.Time = (time.Duration(idx)*interval + span).Seconds()
+		row.Throughput = float64(row.Requests) / span.Seconds()
+		row.Bytes = float64(payloads[idx]) / span.Seconds()
+		if hist := hists[idx]; hist != nil {
+			row.P50 = ToMillis(hist.Percentile(50))
+			row.P90 = ToMillis(hist.Percentile(90))
+			row.P99 = ToMillis(hist.Percentile(99))
+			row.Max = ToMillis(hist.Max)
+		}
+	}
+	return rows
+}
+
+// WriteSeries writes the time series of results to the file in csv or JSON Lines format.
+func WriteSeries(path string, format string, rows []SeriesRow) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	switch format {
+	case SERIES_JSONL:
+		encoder := json.NewEncoder(file)
+		for i := range rows {
+			if err := encoder.Encode(&rows[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "", SERIES_CSV:
+		writer := csv.NewWriter(file)
+		writer.Write([]string{"time", "requests", "sets", "gets", "throughput", "bytes_per_second", "not_found", "errors", "timeouts", "p50", "p90", "p99", "max"})
+		for _, row := range rows {
+			writer.Write([]string{
+				strconv.FormatFloat(row.Time, 'f', 3, 64),
+				strconv.FormatUint(row.Requests, 10),
+				strconv.FormatUint(row.Sets, 10),
+				strconv.FormatUint(row.Gets, 10),
+				strconv.FormatFloat(row.Throughput, 'f', 2, 64),
+				strconv.FormatFloat(row.Bytes, 'f', 0, 64),
+				strconv.FormatUint(row.NotFound, 10),
+				strconv.FormatUint(row.Errors, 10),
+				strconv.FormatUint(row.Timeouts, 10),
+				strconv.FormatFloat(row.P50, 'f', 3, 64),
+				strconv.FormatFloat(row.P90, 'f', 3, 64),
+				strconv.FormatFloat(row.P99, 'f', 3, 64),
+				strconv.FormatFloat(row.Max, 'f', 3, 64),
+			})
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		return fmt.Errorf("unsupported series format: %s", format)
+	}
+}
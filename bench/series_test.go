@@ -0,0 +1,123 @@
+package bench
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	infinistore "github.com/ds2-lab/infinistore/client"
+)
+
+func TestSeries(t *testing.T) {
+	ms := time.Millisecond
+	results := [][]result{
+		{
+			{end: 500 * ms, dur: 1 * ms, op: OP_SET, size: 100},
+			{end: 1200 * ms, dur: 2 * ms, op: OP_GET, size: 200},
+			{end: 2200 * ms, dur: 1 * ms, op: OP_GET, err: infinistore.ErrNotFound},
+		},
+		{
+			{end: 700 * ms, dur: 1 * ms, op: OP_SET, err: errors.New("failed")},
+			{end: 2250 * ms, dur: 1 * ms, op: OP_GET, err: context.DeadlineExceeded},
+			{end: 5 * time.Second, dur: 3 * ms, op: OP_SET, size: 100},
+		},
+	}
+
+	// The trailing 300ms is merged into the last row, and later requests are counted in the last row.
+	rows := series(results, time.Second, 2300*ms)
+	if len(rows) != 2 {
+		t.Fatalf("expect 2 rows, got %d", len(rows))
+	}
+	expect := []SeriesRow{
+		{Time: 1, Requests: 1, Sets: 1, Throughput: 1, Bytes: 100, Errors: 1},
+		{Time: 2.3, Requests: 2, Sets: 1, Gets: 1, Throughput: 2 / 1.3, Bytes: 300 / 1.3, NotFound: 1, Timeouts: 1},
+	}
+	for i, row := range rows {
+		latency := row
+		row.P50, row.P90, row.P99, row.Max = 0, 0, 0, 0
+		if math.Abs(row.Throughput-expect[i].Throughput) > 1e-9 || math.Abs(row.Bytes-expect[i].Bytes) > 1e-9 {
+			t.Fatalf("row %d: expect %+v, got %+v", i, expect[i], row)
+		}
+		row.Throughput, row.Bytes = expect[i].Throughput, expect[i].Bytes
+		if row != expect[i] {
+			t.Fatalf("row %d: expect %+v, got %+v", i, expect[i], row)
+		} else if i == 1 && (math.Abs(latency.P50-2) > 0.01 || math.Abs(latency.Max-3) > 0.01) {
+			t.Fatalf("row %d: expect p50 of 2ms and max of 3ms, got %+v", i, latency)
+		}
+	}
+
+	// Empty intervals are included, and a trailing half interval is a row.
+	rows = series(results[:1], time.Second, 3500*ms)
+	if len(rows) != 4 || rows[0].Requests != 1 || rows[1].Requests != 1 || rows[2].Requests != 0 || rows[2].NotFound != 1 ||
+		rows[3].Requests != 0 || rows[3].Time != 3.5 || rows[3].P50 != 0 {
+		t.Fatalf("unexpected rows %+v", rows)
+	}
+	if rows = series(nil, time.Second, 100*ms); len(rows) != 1 || rows[0].Time != 0.1 {
+		t.Fatalf("expect a row of the short run, got %+v", rows)
+	}
+}
+
+func TestWriteSeries(t *testing.T) {
+	rows := []SeriesRow{{Time: 1, Requests: 10, Throughput: 10, P50: 1.5}, {Time: 2, Requests: 20, Throughput: 20, Errors: 1}}
+	dir := t.TempDir()
+
+	name := filepath.Join(dir, "series.csv")
+	if err := WriteSeries(name, SERIES_CSV, rows); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadFile(name)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "time,requests,sets,gets,throughput,") ||
+		lines[1] != "1.000,10,0,0,10.00,0,0,0,0,1.500,0.000,0.000,0.000" {
+		t.Fatalf("unexpected csv\n%s", data)
+	}
+
+	name = filepath.Join(dir, "series.jsonl")
+	if err := WriteSeries(name, SERIES_JSONL, rows); err != nil {
+		t.Fatal(err)
+	}
+	file, _ := os.Open(name)
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	var decoded []SeriesRow
+	for scanner.Scan() {
+		var row SeriesRow
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			t.Fatal(err)
+		}
+		decoded = append(decoded, row)
+	}
+	if len(decoded) != 2 || decoded[0] != rows[0] || decoded[1] != rows[1] {
+		t.Fatalf("expect %+v, got %+v", rows, decoded)
+	}
+
+	if err := WriteSeries(filepath.Join(dir, "series.xml"), "xml", rows); err == nil {
+		t.Fatal("expect an error of the unsupported format")
+	}
+}
+
+func TestRunSeries(t *testing.T) {
+	opts := testOptions()
+	opts.Duration = 300 * time.Millisecond
+	opts.Interval = 1
+	ret, err := Run(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := ret.Series(100 * time.Millisecond)
+	var requests uint64
+	for _, row := range rows {
+		requests += row.Requests
+	}
+	if len(rows) < 3 || requests != ret.Requests {
+		t.Fatalf("expect rows to cover %d requests, got %d requests in %d rows", ret.Requests, requests, len(rows))
+	}
+}
@@ -0,0 +1,156 @@
+package bench
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"math/rand"
+	"os"
+	"sort"
+
+	"github.com/ds2-lab/infinibench/simulator/readers"
+	"github.com/dustin/go-humanize"
+)
+
+const (
+	SZDIST_FIXED     = "fixed"
+	SZDIST_UNIFORM   = "uniform"
+	SZDIST_LOGNORMAL = "lognormal"
+	SZDIST_EMPIRICAL = "empirical"
+
+	// SZMAX_EMPIRICAL caps sizes of the empirical distribution unless -szmax is set, because each client holds a
+	// buffer of the max size.
+	SZMAX_EMPIRICAL = 64 * 1024 * 1024
+	// BUFFERS_WARNING is the total size of buffers of clients beyond which runs warn.
+	BUFFERS_WARNING = 1024 * 1024 * 1024
+)
+
+var (
+	ErrInvalidSizeRange = errors.New("invalid object size range, check -szmin and -szmax")
+)
+
+// SizeDistribution generates object sizes for SETs.
+type SizeDistribution struct {
+	Dist string
+
+	min    int
+	max    int
+	mu     float64
+	sigma  float64
+	bounds []uint64
+	cdf    []float64
+	capped int // Max size of the histogram if capped by SZMAX_EMPIRICAL.
+}
+
+// NewSizeDistribution creates the size distribution specified by the options.
+func NewSizeDistribution(opts *Options) (*SizeDistribution, error) {
+	d := &SizeDistribution{
+		Dist:  opts.SizeDist,
+		min:   opts.Objsz,
+		max:   opts.Objsz,
+		sigma: opts.SizeSigma,
+	}
+	switch d.Dist {
+	case "":
+		d.Dist = SZDIST_FIXED
+	case SZDIST_FIXED:
+	case SZDIST_UNIFORM, SZDIST_LOGNORMAL:
+		d.min, d.max = opts.SizeMin, opts.SizeMax
+		if d.min <= 0 || d.max < d.min {
+			return nil, ErrInvalidSizeRange
+		}
+		// The median of the log-normal distribution is -sz.
+		d.mu = math.Log(float64(opts.Objsz))
+	case SZDIST_EMPIRICAL:
+		file, err := os.Open(opts.SizeHist)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		hist, err := readers.ReadSizeHistogram(file)
+		if err != nil {
+			return nil, err
+		}
+		d.bounds = hist.Bounds
+		d.cdf = make([]float64, len(hist.Counts))
+		total := float64(hist.Total())
+		var acc uint64
+		for i, count := range hist.Counts {
+			acc += count
+			d.cdf[i] = float64(acc) / total
+		}
+		d.min, d.max = 1, int(hist.Bounds[len(hist.Bounds)-1])
+		// Sizes are capped to save memory.
+		if opts.SizeMax > 0 {
+			if opts.SizeMax < d.max {
+				d.max = opts.SizeMax
+			}
+		} else if d.max > SZMAX_EMPIRICAL {
+			d.max, d.capped = SZMAX_EMPIRICAL, d.max
+		}
+	default:
+		return nil, fmt.Errorf("unsupported size distribution: %s", opts.SizeDist)
+	}
+	return d, nil
+}
+
+// Max returns the max size the distribution can generate.
+func (d *SizeDistribution) Max() int {
+	return d.max
+}
+
+// Next returns the size of the next object.
+func (d *SizeDistribution) Next(rnd *rand.Rand) int {
+	switch d.Dist {
+	case SZDIST_UNIFORM:
+		return d.min + rnd.Intn(d.max-d.min+1)
+	case SZDIST_LOGNORMAL:
+		sz := int(math.Exp(d.mu + d.sigma*rnd.NormFloat64()))
+		if sz < d.min {
+			return d.min
+		} else if sz > d.max {
+			return d.max
+		}
+		return sz
+	case SZDIST_EMPIRICAL:
+		// Locate the bucket, then pick a size in the bucket uniformly.
+		i := sort.SearchFloat64s(d.cdf, rnd.Float64())
+		if i >= len(d.cdf) {
+			i = len(d.cdf) - 1
+		}
+		lower := uint64(0)
+		if i > 0 {
+			lower = d.bounds[i-1]
+		}
+		if d.bounds[i] == lower {
+			// The bucket of bound 0 holds empty objects.
+			return int(lower)
+		}
+		sz := int(lower + 1 + uint64(rnd.Int63n(int64(d.bounds[i]-lower))))
+		if sz > d.max {
+			return d.max
+		}
+		return sz
+	default:
+		return d.min
+	}
+}
+
+// sizeBucket returns the index of power of 2 bucket the size belongs to.
+// Bucket i counts sizes in (2^(i-1), 2^i], and bucket 0 counts sizes of 0 and 1.
+func sizeBucket(size int) int {
+	if size <= 1 {
+		return 0
+	}
+	return bits.Len(uint(size - 1))
+}
+
+// sizeBucketName returns the readable range of the size bucket.
+func sizeBucketName(bucket int) string {
+	if bucket == 0 {
+		return "<= 1 B"
+	}
+	return fmt.Sprintf("%s - %s", humanize.IBytes(uint64(1)<<(bucket-1)+1), humanize.IBytes(uint64(1)<<bucket))
+}
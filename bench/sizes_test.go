@@ -0,0 +1,191 @@
+package bench
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// writeSizeHistogram writes the histogram of bounds and counts to a file in the directory of the test.
+func writeSizeHistogram(t *testing.T, lines string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "sizes.csv")
+	if err := os.WriteFile(path, []byte(lines), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSizeDistribution(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	opts := *DefaultOptions
+	opts.Objsz = 1000
+
+	// Fixed sizes by default.
+	d, err := NewSizeDistribution(&opts)
+	if err != nil {
+		t.Fatal(err)
+	} else if d.Dist != SZDIST_FIXED || d.Max() != 1000 || d.Next(rnd) != 1000 {
+		t.Fatalf("expect fixed sizes of 1000, got %s up to %d", d.Dist, d.Max())
+	}
+
+	opts.SizeDist, opts.SizeMin, opts.SizeMax = SZDIST_UNIFORM, 10, 20
+	if d, err = NewSizeDistribution(&opts); err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[int]bool)
+	for i := 0; i < 1000; i++ {
+		sz := d.Next(rnd)
+		if sz < 10 || sz > 20 {
+			t.Fatalf("uniform size %d is not in [10, 20]", sz)
+		}
+		seen[sz] = true
+	}
+	if len(seen) != 11 {
+		t.Fatalf("expect 11 uniform sizes, got %d", len(seen))
+	}
+
+	// The median of log-normal sizes is -sz, and sizes are clamped to the range.
+	opts.SizeDist, opts.SizeMin, opts.SizeMax, opts.SizeSigma = SZDIST_LOGNORMAL, 100, 5000, 1
+	if d, err = NewSizeDistribution(&opts); err != nil {
+		t.Fatal(err)
+	}
+	sizes := make([]int, 10001)
+	for i := range sizes {
+		if sizes[i] = d.Next(rnd); sizes[i] < 100 || sizes[i] > 5000 {
+			t.Fatalf("log-normal size %d is not in [100, 5000]", sizes[i])
+		}
+	}
+	sort.Ints(sizes)
+	if median := sizes[len(sizes)/2]; math.Abs(float64(median)-1000) > 50 {
+		t.Fatalf("expect the median about 1000, got %d", median)
+	} else if sizes[0] != 100 || sizes[len(sizes)-1] != 5000 {
+		t.Fatalf("expect sizes clamped to [100, 5000], got [%d, %d]", sizes[0], sizes[len(sizes)-1])
+	}
+
+	for _, c := range []struct {
+		dist     string
+		min, max int
+	}{
+		{SZDIST_UNIFORM, 0, 10},
+		{SZDIST_UNIFORM, 20, 10},
+		{SZDIST_LOGNORMAL, -1, 10},
+	} {
+		opts.SizeDist, opts.SizeMin, opts.SizeMax = c.dist, c.min, c.max
+		if _, err := NewSizeDistribution(&opts); err != ErrInvalidSizeRange {
+			t.Fatalf("%s of [%d, %d]: expect %v, got %v", c.dist, c.min, c.max, ErrInvalidSizeRange, err)
+		}
+	}
+	opts.SizeDist = "pareto"
+	if _, err := NewSizeDistribution(&opts); err == nil || !strings.Contains(err.Error(), "pareto") {
+		t.Fatalf("expect an error of the unsupported distribution, got %v", err)
+	}
+}
+
+func TestEmpiricalSizes(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	opts := *DefaultOptions
+	opts.SizeDist = SZDIST_EMPIRICAL
+	// 10% empty objects, 60% in (0, 100], and 30% in (1000, 2000].
+	opts.SizeHist = writeSizeHistogram(t, "# bound,count\n0,10\n100,60\n1000,0\n2000,30\n")
+	d, err := NewSizeDistribution(&opts)
+	if err != nil {
+		t.Fatal(err)
+	} else if d.Max() != 2000 || d.capped != 0 {
+		t.Fatalf("expect sizes up to 2000, got %d", d.Max())
+	}
+	var empty, small, large int
+	for i := 0; i < 10000; i++ {
+		switch sz := d.Next(rnd); {
+		case sz == 0:
+			empty++
+		case sz >= 1 && sz <= 100:
+			small++
+		case sz > 1000 && sz <= 2000:
+			large++
+		default:
+			t.Fatalf("size %d is out of buckets", sz)
+		}
+	}
+	for _, c := range []struct {
+		name          string
+		count, expect int
+	}{{"empty", empty, 1000}, {"small", small, 6000}, {"large", large, 3000}} {
+		if math.Abs(float64(c.count-c.expect)) > 300 {
+			t.Fatalf("expect about %d %s sizes of 10000, got %d", c.expect, c.name, c.count)
+		}
+	}
+
+	// -szmax caps sizes.
+	opts.SizeMax = 1500
+	if d, err = NewSizeDistribution(&opts); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		if sz := d.Next(rnd); sz > 1500 {
+			t.Fatalf("size %d exceeds -szmax", sz)
+		}
+	}
+
+	// Large sizes are capped by default.
+	opts.SizeMax = 0
+	opts.SizeHist = writeSizeHistogram(t, "1024,1\n1099511627776,1\n")
+	if d, err = NewSizeDistribution(&opts); err != nil {
+		t.Fatal(err)
+	} else if d.Max() != SZMAX_EMPIRICAL || d.capped != 1<<40 {
+		t.Fatalf("expect sizes capped at %d, got %d of %d", SZMAX_EMPIRICAL, d.Max(), d.capped)
+	}
+	opts.SizeMax = 1 << 30
+	if d, err = NewSizeDistribution(&opts); err != nil {
+		t.Fatal(err)
+	} else if d.Max() != 1<<30 || d.capped != 0 {
+		t.Fatalf("expect sizes capped at -szmax, got %d", d.Max())
+	}
+
+	for _, hist := range []string{"", "0,0\n", "100,1\n10,1\n", "100\n", "-1,1\n"} {
+		opts.SizeHist = writeSizeHistogram(t, hist)
+		if _, err := NewSizeDistribution(&opts); err == nil {
+			t.Fatalf("%q: expect an error", hist)
+		}
+	}
+	opts.SizeHist = filepath.Join(t.TempDir(), "missing.csv")
+	if _, err := NewSizeDistribution(&opts); !os.IsNotExist(err) {
+		t.Fatalf("expect an error of the missing file, got %v", err)
+	}
+}
+
+func TestRunWarnsCappedSizes(t *testing.T) {
+	opts := testOptions()
+	opts.DSN = "dummy://"
+	opts.Clients, opts.Requests = 1, 1
+	opts.SizeDist = SZDIST_EMPIRICAL
+	opts.SizeHist = writeSizeHistogram(t, "1024,1\n1099511627776,1\n")
+	ret, err := Run(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, warning := range ret.Warnings {
+		if strings.Contains(warning, "capped at 64 MiB") {
+			return
+		}
+	}
+	t.Fatalf("expect a warning of capped sizes, got %v", ret.Warnings)
+}
+
+func TestSizeBucket(t *testing.T) {
+	for _, c := range []struct{ size, bucket int }{{0, 0}, {1, 0}, {2, 1}, {3, 2}, {4, 2}, {5, 3}, {1024, 10}, {1025, 11}} {
+		if bucket := sizeBucket(c.size); bucket != c.bucket {
+			t.Errorf("size %d: expect bucket %d, got %d", c.size, c.bucket, bucket)
+		}
+	}
+	if name := sizeBucketName(0); name != "<= 1 B" {
+		t.Errorf("unexpected name %q of bucket 0", name)
+	} else if name := sizeBucketName(11); name != "1.0 KiB - 2.0 KiB" {
+		t.Errorf("unexpected name %q of bucket 11", name)
+	}
+}
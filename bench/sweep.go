@@ -0,0 +1,370 @@
+package bench
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SWEEP_PRODUCT = "product"
+	SWEEP_ZIP     = "zip"
+)
+
+const (
+	TABLE_CSV      = "csv"
+	TABLE_JSON     = "json"
+	TABLE_MARKDOWN = "md"
+)
+
+var (
+	ErrInvalidSweep = errors.New("invalid sweep")
+)
+
+// SweepParam is an option swept over a list of values.
+type SweepParam struct {
+	Name   string // Field name of Options in any case.
+	Values []string
+}
+
+// Sweep runs the benchmark at every point of the swept options.
+// In the SWEEP_PRODUCT mode, points are the cartesian product of values, ordered with the last option varying fastest.
+// In the SWEEP_ZIP mode, the i-th point takes the i-th value of every option, so all options must have the same number of values.
+type Sweep struct {
+	Params []*SweepParam
+	Mode   string
+}
+
+// SweepPoint is the result of a sweep point.
+type SweepPoint struct {
+	Values []string `json:"values"` // Values of swept options in the order of params.
+	Result *Result  `json:"result,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// SweepResult is the result of a sweep.
+type SweepResult struct {
+	Params []string      `json:"params"`
+	Points []*SweepPoint `json:"points"`
+}
+
+// SweepRow summarizes a sweep point in the table. Latencies are of successful requests of all operations in milliseconds.
+type SweepRow struct {
+	Values         map[string]string `json:"values"`
+	Requests       uint64            `json:"requests"`
+	Throughput     float64           `json:"throughput"`
+	BytesPerSecond float64           `json:"bytes_per_second"`
+	NotFound       uint64            `json:"not_found"`
+	Failed         uint64            `json:"failed"`
+	Timeouts       uint64            `json:"timeouts"`
+	P50            float64           `json:"p50"`
+	P90            float64           `json:"p90"`
+	P99            float64           `json:"p99"`
+	P999           float64           `json:"p99.9"`
+	Max            float64           `json:"max"`
+	Error          string            `json:"error,omitempty"`
+}
+
+// ParseSweep parses swept options in the form of "name=v1,v2,...;name=from..to". A range steps by 1 by default,
+// by n if followed by ":n", or multiplies by n if followed by "*n", e.g. "clients=1..16*2;objsz=1024,4096".
+func ParseSweep(spec string) ([]*SweepParam, error) {
+	var params []*SweepParam
+	for _, field := range strings.Split(spec, ";") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidSweep, field)
+		}
+		param := &SweepParam{Name: kv[0]}
+		for _, value := range strings.Split(kv[1], ",") {
+			values, err := expandRange(strings.TrimSpace(value))
+			if err != nil {
+				return nil, err
+			}
+			param.Values = append(param.Values, values...)
+		}
+		params = append(params, param)
+	}
+	if len(params) == 0 {
+		return nil, fmt.Errorf("%w: no option to sweep", ErrInvalidSweep)
+	}
+	return params, nil
+}
+
+// expandRange expands the range of numbers in the form of "from..to[:step|*factor]". Other values are returned as is.
+func expandRange(value string) ([]string, error) {
+	bounds := strings.SplitN(value, "..", 2)
+	if len(bounds) != 2 {
+		return []string{value}, nil
+	}
+	to, step, multiply := bounds[1], "1", false
+	if i := strings.IndexAny(to, ":*"); i >= 0 {
+		to, step, multiply = to[:i], to[i+1:], to[i] == '*'
+	}
+	from, err1 := strconv.ParseFloat(bounds[0], 64)
+	end, err2 := strconv.ParseFloat(to, 64)
+	by, err3 := strconv.ParseFloat(step, 64)
+	if err1 != nil || err2 != nil || err3 != nil || from > end || (multiply && (by <= 1 || from <= 0)) || (!multiply && by <= 0) {
+		return nil, fmt.Errorf("%w: range %s", ErrInvalidSweep, value)
+	}
+
+	// Values are computed from the start, so errors of floats do not accumulate, and the end is included within
+	// a tolerance, e.g. 0.3 of 0.1..0.3:0.1.
+	tol := 1e-9 * math.Max(math.Abs(from), math.Abs(end))
+	var values []string
+	for i := 0; ; i++ {
+		v := from + float64(i)*by
+		if multiply {
+			v = from * math.Pow(by, float64(i))
+		}
+		if v > end+tol {
+			break
+		}
+		values = append(values, formatValue(v))
+	}
+	return values, nil
+}
+
+// formatValue formats the value of a range with 12 significant digits at most, e.g. 0.3 for 0.30000000000000004.
+func formatValue(v float64) string {
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(v, 'g', 12, 64), 64)
+	return strconv.FormatFloat(rounded, 'f', -1, 64)
+}
+
+// optionField returns the field of the options by name in any case.
+func optionField(opts *Options, name string) (reflect.Value, error) {
+	v := reflect.ValueOf(opts).Elem()
+	field := v.FieldByNameFunc(func(field string) bool { return strings.EqualFold(field, name) })
+	if !field.IsValid() || field.Kind() == reflect.Func {
+		return field, fmt.Errorf("%w: unknown option %s", ErrInvalidSweep, name)
+	}
+	return field, nil
+}
+
+// SetOption sets the option by field name in any case. The value is parsed by the type of the option.
+func SetOption(opts *Options, name string, value string) error {
+	field, err := optionField(opts, name)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case field.Type() == reflect.TypeOf(time.Duration(0)):
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidSweep, name, err)
+		}
+		field.SetInt(int64(d))
+	case field.Kind() == reflect.Int || field.Kind() == reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			// Accept numbers from ranges like "1e+06".
+			f, ferr := strconv.ParseFloat(value, 64)
+			if ferr != nil || f != float64(int64(f)) {
+				return fmt.Errorf("%w: %s: %v", ErrInvalidSweep, name, err)
+			}
+			i = int64(f)
+		}
+		field.SetInt(i)
+	case field.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidSweep, name, err)
+		}
+		field.SetFloat(f)
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidSweep, name, err)
+		}
+		field.SetBool(b)
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+	default:
+		return fmt.Errorf("%w: unsupported option %s", ErrInvalidSweep, name)
+	}
+	return nil
+}
+
+// Points returns values of all sweep points.
+func (s *Sweep) Points() ([][]string, error) {
+	switch s.Mode {
+	case "", SWEEP_PRODUCT:
+		points := [][]string{nil}
+		for _, param := range s.Params {
+			next := make([][]string, 0, len(points)*len(param.Values))
+			for _, point := range points {
+				for _, value := range param.Values {
+					next = append(next, append(point[:len(point):len(point)], value))
+				}
+			}
+			points = next
+		}
+		return points, nil
+	case SWEEP_ZIP:
+		if len(s.Params) == 0 {
+			return nil, fmt.Errorf("%w: no option to zip", ErrInvalidSweep)
+		}
+		points := make([][]string, len(s.Params[0].Values))
+		for _, param := range s.Params {
+			if len(param.Values) != len(points) {
+				return nil, fmt.Errorf("%w: options of the zip mode must have the same number of values", ErrInvalidSweep)
+			}
+			for i, value := range param.Values {
+				points[i] = append(points[i], value)
+			}
+		}
+		return points, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported mode %s", ErrInvalidSweep, s.Mode)
+	}
+}
+
+// Run runs the benchmark at every point with the swept options applied over the base options. Each point creates
+// its own clients. The report function, if set, is called on the completion of each point. A failed point does not
+// stop the sweep, but the sweep stops if the context is done.
+func (s *Sweep) Run(ctx context.Context, base *Options, report func(*SweepPoint)) (*SweepResult, error) {
+	points, err := s.Points()
+	if err != nil {
+		return nil, err
+	}
+	for _, param := range s.Params {
+		if _, err := optionField(&Options{}, param.Name); err != nil {
+			return nil, err
+		}
+	}
+	ret := &SweepResult{Params: make([]string, len(s.Params))}
+	for i, param := range s.Params {
+		ret.Params[i] = param.Name
+	}
+
+	for _, values := range points {
+		opts := *base
+		for i, value := range values {
+			if err := SetOption(&opts, s.Params[i].Name, value); err != nil {
+				return ret, err
+			}
+		}
+		point := &SweepPoint{Values: values}
+		point.Result, err = Run(ctx, &opts)
+		if err != nil {
+			point.Error = err.Error()
+		}
+		ret.Points = append(ret.Points, point)
+		if report != nil {
+			report(point)
+		}
+		if ctx.Err() != nil {
+			return ret, ctx.Err()
+		}
+	}
+	return ret, nil
+}
+
+// Rows summarizes points of the sweep in the order of points.
+func (r *SweepResult) Rows() []*SweepRow {
+	rows := make([]*SweepRow, len(r.Points))
+	for i, point := range r.Points {
+		row := &SweepRow{Values: make(map[string]string, len(r.Params)), Error: point.Error}
+		for j, name := range r.Params {
+			row.Values[name] = point.Values[j]
+		}
+		if ret := point.Result; ret != nil {
+			latency := ret.Latency()
+			row.Requests, row.Throughput, row.BytesPerSecond = ret.Requests, ret.Throughput, ret.BytesPerSecond
+			row.NotFound, row.Failed, row.Timeouts = ret.NotFound, ret.Failed, ret.Timeouts
+			row.P50, row.P90, row.P99, row.P999, row.Max = latency.P50, latency.P90, latency.P99, latency.P999, latency.Max
+		}
+		rows[i] = row
+	}
+	return rows
+}
+
+// WriteTable writes one row per point in csv, JSON, or markdown format.
+func (r *SweepResult) WriteTable(w io.Writer, format string) error {
+	rows := r.Rows()
+	if format == TABLE_JSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(rows)
+	}
+
+	header := append(r.Params[:len(r.Params):len(r.Params)], "requests", "throughput", "bytes_per_second", "not_found", "failed", "timeouts", "p50", "p90", "p99", "p99.9", "max", "error")
+	lines := make([][]string, len(rows))
+	for i, row := range rows {
+		line := make([]string, 0, len(header))
+		for _, name := range r.Params {
+			line = append(line, row.Values[name])
+		}
+		lines[i] = append(line,
+			strconv.FormatUint(row.Requests, 10),
+			strconv.FormatFloat(row.Throughput, 'f', 2, 64),
+			strconv.FormatFloat(row.BytesPerSecond, 'f', 0, 64),
+			strconv.FormatUint(row.NotFound, 10),
+			strconv.FormatUint(row.Failed, 10),
+			strconv.FormatUint(row.Timeouts, 10),
+			strconv.FormatFloat(row.P50, 'f', 3, 64),
+			strconv.FormatFloat(row.P90, 'f', 3, 64),
+			strconv.FormatFloat(row.P99, 'f', 3, 64),
+			strconv.FormatFloat(row.P999, 'f', 3, 64),
+			strconv.FormatFloat(row.Max, 'f', 3, 64),
+			row.Error)
+	}
+
+	switch format {
+	case "", TABLE_CSV:
+		writer := csv.NewWriter(w)
+		writer.Write(header)
+		writer.WriteAll(lines)
+		return writer.Error()
+	case TABLE_MARKDOWN:
+		return writeMarkdown(w, header, lines)
+	default:
+		return fmt.Errorf("unsupported table format: %s", format)
+	}
+}
+
+// writeMarkdown writes the table in markdown format.
+func writeMarkdown(w io.Writer, header []string, lines [][]string) error {
+	row := func(fields []string) error {
+		for i := range fields {
+			fields[i] = strings.ReplaceAll(fields[i], "|", "\\|")
+		}
+		_, err := fmt.Fprintf(w, "| %s |\n", strings.Join(fields, " | "))
+		return err
+	}
+	sep := make([]string, len(header))
+	for i := range sep {
+		sep[i] = "---"
+	}
+	if err := row(header); err != nil {
+		return err
+	}
+	if err := row(sep); err != nil {
+		return err
+	}
+	for _, line := range lines {
+		if err := row(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes the result, including results of all points, in JSON format.
+func (r *SweepResult) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
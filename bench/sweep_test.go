@@ -0,0 +1,158 @@
+package bench
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSweep(t *testing.T) {
+	params, err := ParseSweep(" clients=1..16*2; objsz=1024, 4096 ;zipftheta=0.1..0.3:0.1;keydist=uniform,zipfian;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []*SweepParam{
+		{Name: "clients", Values: []string{"1", "2", "4", "8", "16"}},
+		{Name: "objsz", Values: []string{"1024", "4096"}},
+		{Name: "zipftheta", Values: []string{"0.1", "0.2", "0.3"}},
+		{Name: "keydist", Values: []string{"uniform", "zipfian"}},
+	}
+	if !reflect.DeepEqual(params, expect) {
+		t.Fatalf("expect %v, got %v", expect, params)
+	}
+
+	for _, spec := range []string{"", ";", "clients", "=1", "clients=", "clients=4..1", "clients=1..4:0", "clients=1..4*1",
+		"clients=0..4*2", "clients=a..4", "clients=1..4:x"} {
+		if _, err := ParseSweep(spec); !errors.Is(err, ErrInvalidSweep) {
+			t.Errorf("%q: expect %v, got %v", spec, ErrInvalidSweep, err)
+		}
+	}
+}
+
+func TestExpandRange(t *testing.T) {
+	for _, c := range []struct {
+		value  string
+		expect []string
+	}{
+		{"fixed", []string{"fixed"}},
+		{"3..3", []string{"3"}},
+		{"1..10:4", []string{"1", "5", "9"}},
+		{"1000..1e6*10", []string{"1000", "10000", "100000", "1000000"}},
+		{"0..1:0.25", []string{"0", "0.25", "0.5", "0.75", "1"}},
+		{"0.1..0.7:0.3", []string{"0.1", "0.4", "0.7"}},
+		{"-2..2:2", []string{"-2", "0", "2"}},
+	} {
+		if values, err := expandRange(c.value); err != nil || !reflect.DeepEqual(values, c.expect) {
+			t.Errorf("%s: expect %v, got %v, %v", c.value, c.expect, values, err)
+		}
+	}
+
+	for _, c := range []struct {
+		v      float64
+		expect string
+	}{
+		{0.1 + 0.2, "0.3"},
+		{1e6, "1000000"},
+		{1.0 / 3, "0.333333333333"},
+	} {
+		if s := formatValue(c.v); s != c.expect {
+			t.Errorf("%g: expect %s, got %s", c.v, c.expect, s)
+		}
+	}
+}
+
+func TestSetOption(t *testing.T) {
+	opts := *DefaultOptions
+	for _, c := range []struct{ name, value string }{
+		{"clients", "1e+01"},
+		{"ZIPFTHETA", "0.5"},
+		{"Timeout", "2s"},
+		{"verify", "true"},
+		{"KeyDist", KEYDIST_HOTSPOT},
+		{"interval", "100"},
+	} {
+		if err := SetOption(&opts, c.name, c.value); err != nil {
+			t.Fatalf("%s=%s: %v", c.name, c.value, err)
+		}
+	}
+	if opts.Clients != 10 || opts.ZipfTheta != 0.5 || opts.Timeout != 2*time.Second || !opts.Verify ||
+		opts.KeyDist != KEYDIST_HOTSPOT || opts.Interval != 100 {
+		t.Fatalf("options are not set: %+v", opts)
+	}
+
+	for _, c := range []struct{ name, value string }{
+		{"nothing", "1"},
+		{"progress", "1"},
+		{"clients", "1.5"},
+		{"timeout", "2"},
+		{"zipftheta", "high"},
+		{"verify", "maybe"},
+	} {
+		if err := SetOption(&opts, c.name, c.value); !errors.Is(err, ErrInvalidSweep) {
+			t.Errorf("%s=%s: expect %v, got %v", c.name, c.value, ErrInvalidSweep, err)
+		}
+	}
+}
+
+func TestSweepPoints(t *testing.T) {
+	params := []*SweepParam{{Name: "clients", Values: []string{"1", "2"}}, {Name: "objsz", Values: []string{"10", "20"}}}
+	points, err := (&Sweep{Params: params}).Points()
+	if expect := [][]string{{"1", "10"}, {"1", "20"}, {"2", "10"}, {"2", "20"}}; err != nil || !reflect.DeepEqual(points, expect) {
+		t.Fatalf("product: expect %v, got %v, %v", expect, points, err)
+	}
+	points, err = (&Sweep{Params: params, Mode: SWEEP_ZIP}).Points()
+	if expect := [][]string{{"1", "10"}, {"2", "20"}}; err != nil || !reflect.DeepEqual(points, expect) {
+		t.Fatalf("zip: expect %v, got %v, %v", expect, points, err)
+	}
+
+	for _, sweep := range []*Sweep{
+		{Mode: SWEEP_ZIP},
+		{Params: append(params, &SweepParam{Name: "op", Values: []string{"1"}}), Mode: SWEEP_ZIP},
+		{Params: params, Mode: "random"},
+	} {
+		if _, err := sweep.Points(); !errors.Is(err, ErrInvalidSweep) {
+			t.Errorf("%+v: expect %v, got %v", sweep, ErrInvalidSweep, err)
+		}
+	}
+}
+
+func TestSweepRun(t *testing.T) {
+	params, err := ParseSweep("clients=1,2;requests=20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reported [][]string
+	ret, err := (&Sweep{Params: params}).Run(context.Background(), testOptions(), func(point *SweepPoint) {
+		reported = append(reported, point.Values)
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if expect := [][]string{{"1", "20"}, {"2", "20"}}; !reflect.DeepEqual(reported, expect) {
+		t.Fatalf("expect points %v, got %v", expect, reported)
+	}
+	for i, row := range ret.Rows() {
+		if row.Error != "" || row.Requests != uint64(20*(i+1)) || row.Values["clients"] != reported[i][0] {
+			t.Fatalf("point %d: unexpected row %+v", i, row)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := ret.WriteTable(&buf, TABLE_MARKDOWN); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "| clients | requests | requests | throughput |") ||
+		!strings.HasPrefix(lines[3], "| 2 | 20 | 40 |") {
+		t.Fatalf("unexpected table\n%s", buf.String())
+	}
+
+	// Unknown options fail before running.
+	params, _ = ParseSweep("nothing=1")
+	if _, err := (&Sweep{Params: params}).Run(context.Background(), testOptions(), nil); !errors.Is(err, ErrInvalidSweep) {
+		t.Fatalf("expect %v, got %v", ErrInvalidSweep, err)
+	}
+}
@@ -1,7 +1,10 @@
 package benchclient
 
 import (
+	"context"
 	"errors"
+	"net"
+	"sync"
 	"time"
 
 	infinistore "github.com/ds2-lab/infinistore/client"
@@ -13,14 +16,22 @@ const (
 	ResultSuccess  = 0
 	ResultError    = 1
 	ResultNotFound = 2
+	ResultTimeout  = 3
 )
 
-func resultFromError(err error) int {
-	switch err {
-	case nil:
+// ResultFromError classifies the error returned by a client into one of the Result codes.
+// Exceeded deadlines and network timeouts are classified as ResultTimeout.
+func ResultFromError(err error) int {
+	var netErr net.Error
+	switch {
+	case err == nil:
 		return ResultSuccess
-	case infinistore.ErrNotFound:
+	case errors.Is(err, infinistore.ErrNotFound):
 		return ResultNotFound
+	case errors.Is(err, context.DeadlineExceeded):
+		return ResultTimeout
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return ResultTimeout
 	default:
 		return ResultError
 	}
@@ -30,20 +41,63 @@ var (
 	ErrNotSupported = errors.New("not supported")
 )
 
+// Client is the interface of InfiniStore clients. Arguments of EcSet and EcGet are positional, see
+// RequestOptions.Args. Use ContextClient for typed options.
 type Client interface {
 	EcSet(string, []byte, ...interface{}) (string, error)
 	EcGet(string, ...interface{}) (string, infinistore.ReadAllCloser, error)
 	Close()
 }
 
-type clientSetter func(string, []byte) error
-type clientGetter func(string) (infinistore.ReadAllCloser, error)
+// ContextClient is implemented by clients that can cancel requests. A request returns the error of the context,
+// e.g. context.DeadlineExceeded, if the context is done before the request completes.
+// Requests with options that are not supported fail with ErrUnsupportedOption without being sent.
+// Clients without the support can be adapted by WithContext.
+type ContextClient interface {
+	Client
+	EcSetContext(context.Context, string, []byte, ...RequestOption) (string, error)
+	EcGetContext(context.Context, string, ...RequestOption) (string, infinistore.ReadAllCloser, error)
+	// SupportedOptions returns the options supported by SETs and GETs.
+	SupportedOptions() (set Option, get Option)
+}
+
+// BatchClient is implemented by clients that can send multiple requests together.
+// Results are returned per key in the order of keys.
+type BatchClient interface {
+	Client
+	EcMSet([]string, [][]byte) ([]string, []error)
+	EcMGet([]string) ([]string, []infinistore.ReadAllCloser, []error)
+}
+
+// ContextBatchClient is implemented by batch clients that can cancel requests.
+type ContextBatchClient interface {
+	BatchClient
+	EcMSetContext(context.Context, []string, [][]byte) ([]string, []error)
+	EcMGetContext(context.Context, []string) ([]string, []infinistore.ReadAllCloser, []error)
+}
+
+// Deleter is implemented by clients that can delete objects.
+// Deleting a key that does not exist may return infinistore.ErrNotFound.
+type Deleter interface {
+	Delete(string) error
+}
+
+type clientSetter func(context.Context, string, []byte, *RequestOptions) error
+type clientGetter func(context.Context, string, *RequestOptions) (infinistore.ReadAllCloser, error)
+type clientBatchSetter func(context.Context, []string, [][]byte) []error
+type clientBatchGetter func(context.Context, []string) ([]infinistore.ReadAllCloser, []error)
+type clientDeleter func(context.Context, string) error
 
 type defaultClient struct {
-	log    logger.ILogger
-	setter clientSetter
-	getter clientGetter
-	abbr   string // Abbreviation for logging
+	log     logger.ILogger
+	setter  clientSetter
+	getter  clientGetter
+	msetter clientBatchSetter // Optional, requests are fanned out concurrently if not set.
+	mgetter clientBatchGetter // Optional, requests are fanned out concurrently if not set.
+	deleter clientDeleter     // Optional, Delete is not supported if not set.
+	abbr    string            // Abbreviation for logging
+	setOpts Option            // Options honored by the setter besides dry runs and set modes.
+	getOpts Option            // Options honored by the getter besides dry runs.
 }
 
 func newDefaultClient(logPrefix string) *defaultClient {
@@ -65,14 +119,20 @@ func newDefaultClientWithAccessor(logPrefix string, setter clientSetter, getter
 }
 
 func (c *defaultClient) EcSet(key string, val []byte, args ...interface{}) (string, error) {
+	opts, err := OptionsFromArgs(args...)
+	if err != nil {
+		return uuid.New().String(), err
+	}
+	return c.EcSetContext(context.Background(), key, val, opts...)
+}
+
+func (c *defaultClient) EcSetContext(ctx context.Context, key string, val []byte, opts ...RequestOption) (string, error) {
 	reqId := uuid.New().String()
 
-	// Debuging options
-	var dryrun int
-	if len(args) > 0 {
-		dryrun, _ = args[0].(int)
-	}
-	if dryrun > 0 {
+	options := NewRequestOptions(opts...)
+	if err := options.Check(OptionDryRun | OptionSetMode | c.setOpts); err != nil {
+		return reqId, err
+	} else if options.DryRun > 0 {
 		return reqId, nil
 	}
 
@@ -82,9 +142,9 @@ func (c *defaultClient) EcSet(key string, val []byte, args ...interface{}) (stri
 
 	// Timing
 	start := time.Now()
-	err := c.setter(key, val)
+	err := contextError(ctx, c.setter(ctx, key, val, options))
 	duration := time.Since(start)
-	nanoLog(logClient, "set", key, start.UnixNano(), duration.Nanoseconds(), len(val), resultFromError(err), c.abbr)
+	nanoLog(logClient, "set", key, start.UnixNano(), duration.Nanoseconds(), len(val), ResultFromError(err), c.abbr)
 	if err != nil {
 		c.log.Error("Failed to upload: %v", err)
 		return reqId, err
@@ -94,13 +154,20 @@ func (c *defaultClient) EcSet(key string, val []byte, args ...interface{}) (stri
 }
 
 func (c *defaultClient) EcGet(key string, args ...interface{}) (string, infinistore.ReadAllCloser, error) {
+	opts, err := OptionsFromArgs(args...)
+	if err != nil {
+		return uuid.New().String(), nil, err
+	}
+	return c.EcGetContext(context.Background(), key, opts...)
+}
+
+func (c *defaultClient) EcGetContext(ctx context.Context, key string, opts ...RequestOption) (string, infinistore.ReadAllCloser, error) {
 	reqId := uuid.New().String()
 
-	var dryrun int
-	if len(args) > 0 {
-		dryrun, _ = args[0].(int)
-	}
-	if dryrun > 0 {
+	options := NewRequestOptions(opts...)
+	if err := options.Check(OptionDryRun | c.getOpts); err != nil {
+		return reqId, nil, err
+	} else if options.DryRun > 0 {
 		return reqId, nil, nil
 	}
 
@@ -110,13 +177,14 @@ func (c *defaultClient) EcGet(key string, args ...interface{}) (string, infinist
 
 	// Timing
 	start := time.Now()
-	reader, err := c.getter(key)
+	reader, err := c.getter(ctx, key, options)
+	err = contextError(ctx, err)
 	duration := time.Since(start)
 	size := 0
 	if reader != nil {
 		size = reader.Len()
 	}
-	nanoLog(logClient, "get", key, start.UnixNano(), duration.Nanoseconds(), size, resultFromError(err), c.abbr)
+	nanoLog(logClient, "get", key, start.UnixNano(), duration.Nanoseconds(), size, ResultFromError(err), c.abbr)
 	if err != nil {
 		c.log.Error("failed to download: %v", err)
 		return reqId, nil, err
@@ -125,6 +193,137 @@ func (c *defaultClient) EcGet(key string, args ...interface{}) (string, infinist
 	return reqId, reader, nil
 }
 
+func (c *defaultClient) Delete(key string) error {
+	if c.deleter == nil {
+		return ErrNotSupported
+	}
+
+	// Timing
+	start := time.Now()
+	err := c.deleter(context.Background(), key)
+	duration := time.Since(start)
+	nanoLog(logClient, "del", key, start.UnixNano(), duration.Nanoseconds(), 0, ResultFromError(err), c.abbr)
+	if err != nil && err != infinistore.ErrNotFound {
+		c.log.Error("Failed to delete: %v", err)
+		return err
+	}
+	c.log.Info("Del %s %v", key, duration)
+	return err
+}
+
+func (c *defaultClient) SupportedOptions() (Option, Option) {
+	return OptionDryRun | OptionSetMode | c.setOpts, OptionDryRun | c.getOpts
+}
+
 func (c *defaultClient) Close() {
 	// Nothing
 }
+
+func (c *defaultClient) EcMSet(keys []string, vals [][]byte) ([]string, []error) {
+	return c.EcMSetContext(context.Background(), keys, vals)
+}
+
+func (c *defaultClient) EcMSetContext(ctx context.Context, keys []string, vals [][]byte) ([]string, []error) {
+	reqIds := make([]string, len(keys))
+	for i := range reqIds {
+		reqIds[i] = uuid.New().String()
+	}
+
+	if c.setter == nil && c.msetter == nil {
+		return reqIds, c.batchErrors(len(keys), ErrNotSupported)
+	}
+
+	// Timing
+	start := time.Now()
+	var errs []error
+	if c.msetter != nil {
+		errs = c.msetter(ctx, keys, vals)
+	} else {
+		errs = make([]error, len(keys))
+		c.fanOut(len(keys), func(i int) {
+			errs[i] = c.setter(ctx, keys[i], vals[i], &RequestOptions{})
+		})
+	}
+	duration := time.Since(start)
+	for i, key := range keys {
+		errs[i] = contextError(ctx, errs[i])
+		nanoLog(logClient, "set", key, start.UnixNano(), duration.Nanoseconds(), len(vals[i]), ResultFromError(errs[i]), c.abbr)
+		if errs[i] != nil {
+			c.log.Error("Failed to upload: %v", errs[i])
+		}
+	}
+	c.log.Info("Set %d keys %v", len(keys), duration)
+	return reqIds, errs
+}
+
+func (c *defaultClient) EcMGet(keys []string) ([]string, []infinistore.ReadAllCloser, []error) {
+	return c.EcMGetContext(context.Background(), keys)
+}
+
+func (c *defaultClient) EcMGetContext(ctx context.Context, keys []string) ([]string, []infinistore.ReadAllCloser, []error) {
+	reqIds := make([]string, len(keys))
+	for i := range reqIds {
+		reqIds[i] = uuid.New().String()
+	}
+
+	if c.getter == nil && c.mgetter == nil {
+		return reqIds, make([]infinistore.ReadAllCloser, len(keys)), c.batchErrors(len(keys), ErrNotSupported)
+	}
+
+	// Timing
+	start := time.Now()
+	var readers []infinistore.ReadAllCloser
+	var errs []error
+	if c.mgetter != nil {
+		readers, errs = c.mgetter(ctx, keys)
+	} else {
+		readers = make([]infinistore.ReadAllCloser, len(keys))
+		errs = make([]error, len(keys))
+		c.fanOut(len(keys), func(i int) {
+			readers[i], errs[i] = c.getter(ctx, keys[i], &RequestOptions{})
+		})
+	}
+	duration := time.Since(start)
+	for i, key := range keys {
+		errs[i] = contextError(ctx, errs[i])
+		size := 0
+		if readers[i] != nil {
+			size = readers[i].Len()
+		}
+		nanoLog(logClient, "get", key, start.UnixNano(), duration.Nanoseconds(), size, ResultFromError(errs[i]), c.abbr)
+		if errs[i] != nil && errs[i] != infinistore.ErrNotFound {
+			c.log.Error("failed to download: %v", errs[i])
+		}
+	}
+	c.log.Info("Get %d keys %v", len(keys), duration)
+	return reqIds, readers, errs
+}
+
+func (c *defaultClient) fanOut(n int, fn func(int)) {
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			defer wg.Done()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+func (c *defaultClient) batchErrors(n int, err error) []error {
+	errs := make([]error, n)
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
+
+// contextError returns the error of the context instead of errors of backends, e.g. canceled requests of S3,
+// if the request failed after the context is done.
+func contextError(ctx context.Context, err error) error {
+	if err != nil && err != infinistore.ErrNotFound && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
@@ -0,0 +1,72 @@
+package benchclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	infinistore "github.com/ds2-lab/infinistore/client"
+)
+
+// netTimeout is a network error of a timeout.
+type netTimeout struct{}
+
+func (netTimeout) Error() string   { return "i/o timeout" }
+func (netTimeout) Timeout() bool   { return true }
+func (netTimeout) Temporary() bool { return true }
+
+func TestResultFromError(t *testing.T) {
+	for _, c := range []struct {
+		err    error
+		expect int
+	}{
+		{nil, ResultSuccess},
+		{infinistore.ErrNotFound, ResultNotFound},
+		{fmt.Errorf("get: %w", infinistore.ErrNotFound), ResultNotFound},
+		{context.DeadlineExceeded, ResultTimeout},
+		{fmt.Errorf("attempt 2: %w", context.DeadlineExceeded), ResultTimeout},
+		{&net.OpError{Op: "read", Err: netTimeout{}}, ResultTimeout},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, ResultError},
+		{context.Canceled, ResultError},
+		{errors.New("failed"), ResultError},
+	} {
+		if result := ResultFromError(c.err); result != c.expect {
+			t.Errorf("%v: expect result %d, got %d", c.err, c.expect, result)
+		}
+	}
+}
+
+func TestBatch(t *testing.T) {
+	ctx := context.Background()
+	cli := NewDummyWithStorage(NewDummyStorage(0, nil), &DummyOptions{Type: DummyStore})
+	keys := []string{"a", "b", "c"}
+	reqIds, errs := cli.EcMSetContext(ctx, keys[:2], [][]byte{make([]byte, 10), make([]byte, 20)})
+	if len(reqIds) != 2 || reqIds[0] == reqIds[1] || errs[0] != nil || errs[1] != nil {
+		t.Fatalf("unexpected results %v, %v", reqIds, errs)
+	}
+
+	// Results are returned per key in the order of keys.
+	_, readers, errs := cli.EcMGetContext(ctx, keys)
+	if len(readers) != 3 || readers[0].Len() != 10 || readers[1].Len() != 20 || readers[2] != nil {
+		t.Fatalf("unexpected readers %v", readers)
+	} else if errs[0] != nil || errs[1] != nil || errs[2] != infinistore.ErrNotFound {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	cli = NewDummyWithStorage(NewDummyStorage(0, nil), &DummyOptions{Type: DummyStore, Overhead: time.Second})
+	if _, errs := cli.EcMSetContext(canceled, keys, make([][]byte, 3)); errs[0] != context.Canceled || errs[2] != context.Canceled {
+		t.Fatalf("expect %v, got %v", context.Canceled, errs)
+	}
+
+	unsupported := &defaultClient{log: cli.log}
+	if _, errs := unsupported.EcMSet(keys, make([][]byte, 3)); len(errs) != 3 || errs[2] != ErrNotSupported {
+		t.Fatalf("expect %v, got %v", ErrNotSupported, errs)
+	} else if _, readers, errs := unsupported.EcMGet(keys); len(readers) != 3 || errs[2] != ErrNotSupported {
+		t.Fatalf("expect %v, got %v", ErrNotSupported, errs)
+	}
+}
@@ -0,0 +1,103 @@
+package benchclient
+
+import (
+	"context"
+
+	infinistore "github.com/ds2-lab/infinistore/client"
+)
+
+// WithContext returns the client as a ContextClient. Clients that can not cancel requests, e.g. InfiniStore clients,
+// are wrapped: a request returns the error of the context once the context is done, while the underlying request
+// runs to completion in the background and its result is discarded. The next request waits for the abandoned
+// request, so that the underlying client is never used concurrently by the wrapper, and Close closes the underlying
+// client in the background once the abandoned request completes. Replace clients with requests abandoned, instead of
+// reusing them, if requests are expected to proceed on time.
+// Options are passed to the client as positional arguments, so dry runs, placements and set modes are supported.
+func WithContext(cli Client) ContextClient {
+	if ctxCli, ok := cli.(ContextClient); ok {
+		return ctxCli
+	}
+	return &contextClient{Client: cli, inflight: make(chan struct{}, 1)}
+}
+
+type contextClient struct {
+	Client
+	inflight chan struct{} // Held by the request in flight, including abandoned requests.
+}
+
+type contextResult struct {
+	reqId  string
+	reader infinistore.ReadAllCloser
+	err    error
+}
+
+func (c *contextClient) EcSetContext(ctx context.Context, key string, val []byte, opts ...RequestOption) (string, error) {
+	options := NewRequestOptions(opts...)
+	set, _ := c.SupportedOptions()
+	if err := options.Check(set); err != nil {
+		return "", err
+	}
+	ret := c.do(ctx, func() (string, infinistore.ReadAllCloser, error) {
+		reqId, err := c.Client.EcSet(key, val, options.Args()...)
+		return reqId, nil, err
+	})
+	return ret.reqId, ret.err
+}
+
+func (c *contextClient) EcGetContext(ctx context.Context, key string, opts ...RequestOption) (string, infinistore.ReadAllCloser, error) {
+	options := NewRequestOptions(opts...)
+	_, get := c.SupportedOptions()
+	if err := options.Check(get); err != nil {
+		return "", nil, err
+	}
+	ret := c.do(ctx, func() (string, infinistore.ReadAllCloser, error) {
+		return c.Client.EcGet(key, options.Args()...)
+	})
+	return ret.reqId, ret.reader, ret.err
+}
+
+// Close closes the underlying client once the request in flight, if any, completes.
+func (c *contextClient) Close() {
+	select {
+	case c.inflight <- struct{}{}:
+		c.Client.Close()
+	default:
+		go func() {
+			c.inflight <- struct{}{}
+			c.Client.Close()
+		}()
+	}
+}
+
+func (c *contextClient) SupportedOptions() (Option, Option) {
+	return OptionDryRun | OptionPlacements | OptionSetMode, OptionDryRun
+}
+
+func (c *contextClient) do(ctx context.Context, request func() (string, infinistore.ReadAllCloser, error)) *contextResult {
+	select {
+	case c.inflight <- struct{}{}:
+	case <-ctx.Done():
+		return &contextResult{err: ctx.Err()}
+	}
+
+	done := make(chan *contextResult, 1)
+	go func() {
+		defer func() { <-c.inflight }()
+		ret := &contextResult{}
+		ret.reqId, ret.reader, ret.err = request()
+		done <- ret
+	}()
+
+	select {
+	case ret := <-done:
+		return ret
+	case <-ctx.Done():
+		// Release the reader of the abandoned request.
+		go func() {
+			if ret := <-done; ret.reader != nil {
+				ret.reader.Close()
+			}
+		}()
+		return &contextResult{err: ctx.Err()}
+	}
+}
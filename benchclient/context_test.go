@@ -0,0 +1,128 @@
+package benchclient
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	infinistore "github.com/ds2-lab/infinistore/client"
+)
+
+// blockingClient is a client that can not cancel requests, and blocks requests until they are unblocked.
+type blockingClient struct {
+	unblock  chan struct{}
+	inflight int32
+	overlaps int32 // Requests sent while another is in flight.
+	closed   int32
+	args     []interface{}
+}
+
+func newBlockingClient() *blockingClient {
+	return &blockingClient{unblock: make(chan struct{})}
+}
+
+func (c *blockingClient) EcSet(key string, val []byte, args ...interface{}) (string, error) {
+	if atomic.AddInt32(&c.inflight, 1) > 1 {
+		atomic.AddInt32(&c.overlaps, 1)
+	}
+	defer atomic.AddInt32(&c.inflight, -1)
+	c.args = args
+	<-c.unblock
+	return "set", nil
+}
+
+func (c *blockingClient) EcGet(key string, args ...interface{}) (string, infinistore.ReadAllCloser, error) {
+	if _, err := c.EcSet(key, nil, args...); err != nil {
+		return "", nil, err
+	}
+	return "get", NewByteReader([]byte(key)), nil
+}
+
+func (c *blockingClient) Close() {
+	atomic.StoreInt32(&c.closed, 1)
+}
+
+func TestWithContextTimeout(t *testing.T) {
+	blocking := newBlockingClient()
+	cli := WithContext(blocking)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := cli.EcSetContext(ctx, "key", []byte("value")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect %v, got %v", context.DeadlineExceeded, err)
+	} else if ResultFromError(err) != ResultTimeout {
+		t.Fatalf("expect a timeout, got result %d", ResultFromError(err))
+	} else if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("returned after %v", elapsed)
+	}
+
+	// The next request waits for the abandoned request, and times out without being sent.
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, _, err := cli.EcGetContext(ctx, "key"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	// The client is closed after the abandoned request completes.
+	cli.Close()
+	time.Sleep(10 * time.Millisecond)
+	if atomic.LoadInt32(&blocking.closed) != 0 {
+		t.Fatal("closed with a request in flight")
+	}
+	blocking.unblock <- struct{}{}
+	for deadline := time.Now().Add(time.Second); atomic.LoadInt32(&blocking.closed) == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("not closed after the abandoned request completed")
+		}
+	}
+	if atomic.LoadInt32(&blocking.overlaps) != 0 {
+		t.Fatal("requests are sent concurrently")
+	}
+}
+
+func TestWithContext(t *testing.T) {
+	blocking := newBlockingClient()
+	close(blocking.unblock)
+	cli := WithContext(blocking)
+	if WithContext(cli) != cli {
+		t.Fatal("context clients are wrapped again")
+	}
+
+	reqId, reader, err := cli.EcGetContext(context.Background(), "key", WithDryRun(3))
+	if err != nil {
+		t.Fatal(err)
+	} else if data, _ := reader.ReadAll(); reqId != "get" || string(data) != "key" {
+		t.Fatalf("unexpected response %s of %q", reqId, data)
+	} else if !reflect.DeepEqual(blocking.args, []interface{}{3}) {
+		t.Fatalf("unexpected arguments %v", blocking.args)
+	}
+
+	// Options are passed as positional arguments.
+	if _, err := cli.EcSetContext(context.Background(), "key", nil, WithPlacements([]int{1, 2}), WithSetMode(SetModeReset)); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(blocking.args, []interface{}{0, []int{1, 2}, SetModeReset}) {
+		t.Fatalf("unexpected arguments %v", blocking.args)
+	}
+
+	// Unsupported options fail without sending requests.
+	blocking.args = nil
+	if _, err := cli.EcSetContext(context.Background(), "key", nil, WithTTL(time.Second)); !errors.Is(err, ErrUnsupportedOption) {
+		t.Fatalf("expect %v, got %v", ErrUnsupportedOption, err)
+	} else if _, _, err := cli.EcGetContext(context.Background(), "key", WithRange(0, 1)); !errors.Is(err, ErrUnsupportedOption) {
+		t.Fatalf("expect %v, got %v", ErrUnsupportedOption, err)
+	} else if blocking.args != nil {
+		t.Fatalf("requests with unsupported options are sent")
+	}
+
+	// Requests of done contexts are not sent while a request is in flight.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cli.(*contextClient).inflight <- struct{}{}
+	if _, err := cli.EcSetContext(ctx, "key", nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect %v, got %v", context.Canceled, err)
+	}
+}
@@ -2,80 +2,285 @@ package benchclient
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/rand"
 	"strings"
+	"sync"
 	"time"
 
 	infinistore "github.com/ds2-lab/infinistore/client"
-	"github.com/zhangjyr/hashmap"
 )
 
 const (
 	DummyStore          = "ds"
 	DummyCache          = "dc"
-	DummyCacheMissRatio = 50 // Miss ratio of cache, 10 means 10%
+	DummyCacheMissRatio = 50 // Miss ratio of caches without a capacity, 10 means 10%
 )
 
 var (
-	sizemap *hashmap.HashMap
+	ErrObjectTooLarge = errors.New("object larger than the capacity")
+
+	// defaultDummyStorage is shared by clients of NewDummy, and of dummy DSNs without a namespace or capacity.
+	defaultDummyStorage = NewDummyStorage(0, nil)
+
+	// dummyStorages are storages of dummy DSNs by namespace, capacity and eviction policy.
+	dummyStoragesMu sync.Mutex
+	dummyStorages   = make(map[string]*DummyStorage)
 )
 
+// ResetDummySizeRegistry clears storages shared by dummy clients.
 func ResetDummySizeRegistry() {
-	sizemap = hashmap.New(10000)
+	dummyStoragesMu.Lock()
+	defer dummyStoragesMu.Unlock()
+	defaultDummyStorage = NewDummyStorage(0, nil)
+	dummyStorages = make(map[string]*DummyStorage)
+}
+
+// sharedDummyStorage returns the storage of the namespace, capacity and eviction policy, which is shared by
+// dummy clients of all constructors, so that objects loaded by a run are found by later runs.
+func sharedDummyStorage(ns string, capacity int64, evict string) (*DummyStorage, error) {
+	policy, err := NewEvictionPolicy(evict)
+	if err != nil {
+		return nil, err
+	}
+	dummyStoragesMu.Lock()
+	defer dummyStoragesMu.Unlock()
+	if ns == "" && capacity == 0 {
+		return defaultDummyStorage, nil
+	} else if capacity == 0 {
+		// Policies of unbounded storages evict nothing.
+		evict = ""
+	}
+	key := fmt.Sprintf("%s/%d/%s", ns, capacity, evict)
+	storage, ok := dummyStorages[key]
+	if !ok {
+		storage = NewDummyStorage(capacity, policy)
+		dummyStorages[key] = storage
+	}
+	return storage, nil
+}
+
+// DummyStats are the counters of a DummyStorage.
+type DummyStats struct {
+	Objects   int
+	Bytes     int64
+	Capacity  int64
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+}
+
+// DummyStorage records sizes of objects of dummy clients, which is the namespace of a dummy backend shared by
+// its clients. Objects are evicted by the policy to fit in the capacity.
+type DummyStorage struct {
+	mu        sync.Mutex
+	sizes     map[string]int
+	capacity  int64
+	used      int64
+	policy    EvictionPolicy
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+// NewDummyStorage returns the storage of the capacity in bytes, 0 for unbounded. The policy is LRU if nil.
+func NewDummyStorage(capacity int64, policy EvictionPolicy) *DummyStorage {
+	if policy == nil {
+		policy, _ = NewEvictionPolicy(EvictLRU)
+	}
+	return &DummyStorage{sizes: make(map[string]int), capacity: capacity, policy: policy}
+}
+
+// Set records the size of the object, evicting other objects if the capacity is exceeded.
+func (s *DummyStorage) Set(key string, size int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.capacity > 0 && int64(size) > s.capacity {
+		return fmt.Errorf("%w: %d > %d", ErrObjectTooLarge, size, s.capacity)
+	}
+	if old, ok := s.sizes[key]; ok {
+		s.used -= int64(old)
+		s.policy.Access(key)
+	} else {
+		s.policy.Add(key)
+	}
+	s.sizes[key] = size
+	s.used += int64(size)
+	for s.capacity > 0 && s.used > s.capacity {
+		victim, ok := s.policy.Victim()
+		if !ok {
+			break
+		}
+		s.remove(victim)
+		s.evictions++
+	}
+	return nil
+}
+
+// Get returns the size of the object, or false if the object is not found.
+func (s *DummyStorage) Get(key string) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	size, ok := s.sizes[key]
+	if ok {
+		s.hits++
+		s.policy.Access(key)
+	} else {
+		s.misses++
+	}
+	return size, ok
+}
+
+// Del removes the object and returns if it existed.
+func (s *DummyStorage) Del(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sizes[key]; !ok {
+		return false
+	}
+	s.remove(key)
+	return true
+}
+
+func (s *DummyStorage) remove(key string) {
+	s.used -= int64(s.sizes[key])
+	delete(s.sizes, key)
+	s.policy.Remove(key)
+}
+
+// Stats returns the counters of the storage.
+func (s *DummyStorage) Stats() DummyStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return DummyStats{
+		Objects:   len(s.sizes),
+		Bytes:     s.used,
+		Capacity:  s.capacity,
+		Hits:      s.hits,
+		Misses:    s.misses,
+		Evictions: s.evictions,
+	}
+}
+
+// DummyOptions configures dummy clients. The latency of a request is the overhead, plus the size over the
+// bandwidth, plus a random jitter.
+type DummyOptions struct {
+	Type      string        // DummyStore or DummyCache. Caches without a capacity miss randomly by DummyCacheMissRatio.
+	Bandwidth int64         // In B/s, 0 for unlimited.
+	Overhead  time.Duration // Fixed latency of each request.
+	Jitter    time.Duration // Max random latency of each request, drawn uniformly.
 }
 
 type Dummy struct {
 	*defaultClient
-	ctx       context.Context
-	bandwidth int64
+	storage *DummyStorage
+	opts    DummyOptions
 }
 
-// NewDummy returns a new dummy client.
+// NewDummy returns a new dummy client. Clients of NewDummy share an unbounded storage.
 // bandwidth defined the bandwidth of the dummy client in B/s, 0 for unlimited.
 func NewDummy(bandwidth int64, t string) *Dummy {
-	//client := newSession(addr)
+	return NewDummyWithStorage(defaultDummyStorage, &DummyOptions{Type: t, Bandwidth: bandwidth})
+}
+
+// NewDummyWithStorage returns a new dummy client of the storage, which may be shared by clients.
+func NewDummyWithStorage(storage *DummyStorage, opts *DummyOptions) *Dummy {
 	client := &Dummy{
-		defaultClient: newDefaultClient(fmt.Sprintf("Dummy%s: ", strings.ToUpper(t))),
-		ctx:           context.Background(),
-		bandwidth:     bandwidth,
+		defaultClient: newDefaultClient(fmt.Sprintf("Dummy%s: ", strings.ToUpper(opts.Type))),
+		storage:       storage,
+		opts:          *opts,
 	}
 	client.setter = client.set
 	client.getter = client.get
-	client.abbr = t
+	client.deleter = client.del
+	client.abbr = opts.Type
+	client.getOpts = OptionRange
 	return client
 }
 
-func (d *Dummy) set(key string, val []byte) (err error) {
-	sizemap.Set(key, len(val))
+// Storage returns the storage of the client.
+func (d *Dummy) Storage() *DummyStorage {
+	return d.storage
+}
 
-	if d.bandwidth == 0 {
-		return nil
+// set records the size of the object. Objects do not expire, so TTLs are not supported.
+func (d *Dummy) set(ctx context.Context, key string, val []byte, opts *RequestOptions) (err error) {
+	if err := d.transfer(ctx, len(val)); err != nil {
+		return err
 	}
 
-	time.Sleep(d.sizeToDuration(len(val)))
-	return nil
+	return d.storage.Set(key, len(val))
 }
 
-func (d *Dummy) get(key string) (infinistore.ReadAllCloser, error) {
-	size, ok := sizemap.Get(key)
-	if !ok {
+func (d *Dummy) get(ctx context.Context, key string, opts *RequestOptions) (infinistore.ReadAllCloser, error) {
+	size, ok := d.storage.Get(key)
+	if !ok || d.opts.Type == DummyCache && d.storage.capacity == 0 && rand.Intn(100) < DummyCacheMissRatio {
+		// Misses take the overhead only.
+		if err := d.transfer(ctx, 0); err != nil {
+			return nil, err
+		}
 		return nil, infinistore.ErrNotFound
 	}
 
-	if d.abbr == DummyCache && rand.Intn(100) < DummyCacheMissRatio {
-		return nil, infinistore.ErrNotFound
+	n := size
+	if opts.Has(OptionRange) {
+		n = rangeSize(n, opts.Offset, opts.Length)
+	}
+	if err := d.transfer(ctx, n); err != nil {
+		return nil, err
 	}
+	return &DummyReadAllCloser{size: n}, nil
+}
+
+// rangeSize returns the size of the range of the object of the size.
+func rangeSize(size int, offset int64, length int64) int {
+	n := int64(size) - offset
+	if length > 0 && length < n {
+		n = length
+	}
+	if n < 0 {
+		return 0
+	}
+	return int(n)
+}
+
+func (d *Dummy) del(ctx context.Context, key string) error {
+	if !d.storage.Del(key) {
+		return infinistore.ErrNotFound
+	}
+	return nil
+}
 
-	if d.bandwidth == 0 {
-		return &DummyReadAllCloser{size: size.(int)}, nil
+// transfer waits for the latency of transferring the size, unless the context is done.
+func (d *Dummy) transfer(ctx context.Context, size int) error {
+	latency := d.latency(size)
+	if latency <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(latency)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
 	}
-	time.Sleep(d.sizeToDuration(size.(int)))
-	return &DummyReadAllCloser{size: size.(int)}, nil
 }
 
-func (d *Dummy) sizeToDuration(size int) time.Duration {
-	return time.Duration(float64(size) / float64(d.bandwidth) * float64(time.Second))
+// latency returns the latency of a request of the size.
+func (d *Dummy) latency(size int) time.Duration {
+	latency := d.opts.Overhead
+	if d.opts.Bandwidth > 0 {
+		latency += time.Duration(float64(size) / float64(d.opts.Bandwidth) * float64(time.Second))
+	}
+	if d.opts.Jitter > 0 {
+		latency += time.Duration(rand.Int63n(int64(d.opts.Jitter)))
+	}
+	return latency
 }
 
 type DummyReadAllCloser struct {
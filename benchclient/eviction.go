@@ -0,0 +1,148 @@
+package benchclient
+
+import (
+	"container/heap"
+	"container/list"
+	"fmt"
+)
+
+const (
+	EvictLRU  = "lru"
+	EvictLFU  = "lfu"
+	EvictFIFO = "fifo"
+)
+
+// EvictionPolicy chooses objects to evict from a DummyStorage with a capacity. Calls are serialized by the storage.
+type EvictionPolicy interface {
+	// Add tracks a new object.
+	Add(key string)
+	// Access tracks a hit or an overwrite of the object.
+	Access(key string)
+	// Remove stops tracking the object.
+	Remove(key string)
+	// Victim returns the object to evict next without removing it, or false if no object is tracked.
+	Victim() (string, bool)
+}
+
+// NewEvictionPolicy returns the builtin policy of the name, EvictLRU, EvictLFU, or EvictFIFO.
+func NewEvictionPolicy(name string) (EvictionPolicy, error) {
+	switch name {
+	case "", EvictLRU:
+		return newListPolicy(true), nil
+	case EvictFIFO:
+		return newListPolicy(false), nil
+	case EvictLFU:
+		return &lfuPolicy{entries: make(map[string]*lfuEntry)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported eviction policy %s, support lru, lfu, and fifo", name)
+	}
+}
+
+// listPolicy evicts the least recently used object if accesses are tracked, or the first added object otherwise.
+type listPolicy struct {
+	order    *list.List // Front is the most recent.
+	elements map[string]*list.Element
+	recency  bool
+}
+
+func newListPolicy(recency bool) *listPolicy {
+	return &listPolicy{order: list.New(), elements: make(map[string]*list.Element), recency: recency}
+}
+
+func (p *listPolicy) Add(key string) {
+	p.elements[key] = p.order.PushFront(key)
+}
+
+func (p *listPolicy) Access(key string) {
+	if elem, ok := p.elements[key]; ok && p.recency {
+		p.order.MoveToFront(elem)
+	}
+}
+
+func (p *listPolicy) Remove(key string) {
+	if elem, ok := p.elements[key]; ok {
+		p.order.Remove(elem)
+		delete(p.elements, key)
+	}
+}
+
+func (p *listPolicy) Victim() (string, bool) {
+	if back := p.order.Back(); back != nil {
+		return back.Value.(string), true
+	}
+	return "", false
+}
+
+// lfuPolicy evicts the least frequently used object, and the least recently used one among ties.
+type lfuPolicy struct {
+	entries map[string]*lfuEntry
+	queue   lfuQueue
+	seq     uint64
+}
+
+type lfuEntry struct {
+	key   string
+	freq  uint64
+	seq   uint64 // Order of the last access.
+	index int
+}
+
+func (p *lfuPolicy) Add(key string) {
+	p.seq++
+	entry := &lfuEntry{key: key, freq: 1, seq: p.seq}
+	p.entries[key] = entry
+	heap.Push(&p.queue, entry)
+}
+
+func (p *lfuPolicy) Access(key string) {
+	if entry, ok := p.entries[key]; ok {
+		p.seq++
+		entry.freq++
+		entry.seq = p.seq
+		heap.Fix(&p.queue, entry.index)
+	}
+}
+
+func (p *lfuPolicy) Remove(key string) {
+	if entry, ok := p.entries[key]; ok {
+		heap.Remove(&p.queue, entry.index)
+		delete(p.entries, key)
+	}
+}
+
+func (p *lfuPolicy) Victim() (string, bool) {
+	if len(p.queue) == 0 {
+		return "", false
+	}
+	return p.queue[0].key, true
+}
+
+type lfuQueue []*lfuEntry
+
+func (q lfuQueue) Len() int { return len(q) }
+
+func (q lfuQueue) Less(i, j int) bool {
+	if q[i].freq != q[j].freq {
+		return q[i].freq < q[j].freq
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q lfuQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index, q[j].index = i, j
+}
+
+func (q *lfuQueue) Push(x interface{}) {
+	entry := x.(*lfuEntry)
+	entry.index = len(*q)
+	*q = append(*q, entry)
+}
+
+func (q *lfuQueue) Pop() interface{} {
+	old := *q
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return entry
+}
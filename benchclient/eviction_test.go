@@ -0,0 +1,166 @@
+package benchclient
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// victims returns objects in the order of eviction, removing them from the policy.
+func victims(p EvictionPolicy) []string {
+	var keys []string
+	for {
+		key, ok := p.Victim()
+		if !ok {
+			return keys
+		}
+		keys = append(keys, key)
+		p.Remove(key)
+	}
+}
+
+func TestEvictionPolicy(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		expect []string
+	}{
+		// Adds a, b, c, d, accesses a, c, a, and removes b.
+		{EvictLRU, []string{"d", "c", "a"}},
+		{"", []string{"d", "c", "a"}},
+		{EvictFIFO, []string{"a", "c", "d"}},
+		{EvictLFU, []string{"d", "c", "a"}},
+	} {
+		policy, err := NewEvictionPolicy(c.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range []string{"a", "b", "c", "d"} {
+			policy.Add(key)
+		}
+		for _, key := range []string{"a", "c", "a", "missing"} {
+			policy.Access(key)
+		}
+		policy.Remove("b")
+		policy.Remove("missing")
+		if keys := victims(policy); !reflect.DeepEqual(keys, c.expect) {
+			t.Errorf("%s: expect victims %v, got %v", c.name, c.expect, keys)
+		}
+	}
+
+	// Ties of frequencies are broken by recency.
+	policy, _ := NewEvictionPolicy(EvictLFU)
+	for _, key := range []string{"a", "b", "c"} {
+		policy.Add(key)
+	}
+	for _, key := range []string{"c", "b", "a", "a"} {
+		policy.Access(key)
+	}
+	if expect, keys := []string{"c", "b", "a"}, victims(policy); !reflect.DeepEqual(keys, expect) {
+		t.Errorf("lfu: expect victims %v, got %v", expect, keys)
+	}
+
+	if _, err := NewEvictionPolicy("mru"); err == nil {
+		t.Error("expect an error of the unsupported policy")
+	}
+}
+
+func TestDummyStorage(t *testing.T) {
+	policy, _ := NewEvictionPolicy(EvictLRU)
+	storage := NewDummyStorage(300, policy)
+	for _, key := range []string{"a", "b", "c"} {
+		if err := storage.Set(key, 100); err != nil {
+			t.Fatal(err)
+		}
+	}
+	storage.Get("a")
+	// Overwrites count as accesses, and resize objects.
+	storage.Set("b", 50)
+	storage.Set("d", 150)
+	if _, ok := storage.Get("c"); ok {
+		t.Fatal("expect c to be evicted")
+	}
+	stats := storage.Stats()
+	if expect := (DummyStats{Objects: 3, Bytes: 300, Capacity: 300, Hits: 1, Misses: 1, Evictions: 1}); stats != expect {
+		t.Fatalf("expect stats %+v, got %+v", expect, stats)
+	}
+
+	if err := storage.Set("e", 301); !errors.Is(err, ErrObjectTooLarge) {
+		t.Fatalf("expect %v, got %v", ErrObjectTooLarge, err)
+	} else if !storage.Del("a") || storage.Del("a") {
+		t.Fatal("expect a to be deleted once")
+	} else if stats := storage.Stats(); stats.Objects != 2 || stats.Bytes != 200 {
+		t.Fatalf("unexpected stats after the deletion %+v", stats)
+	}
+
+	// Unbounded storages evict nothing.
+	storage = NewDummyStorage(0, nil)
+	for i := 0; i < 100; i++ {
+		storage.Set(string(rune('a'+i)), 1<<20)
+	}
+	if stats := storage.Stats(); stats.Objects != 100 || stats.Evictions != 0 {
+		t.Fatalf("unexpected stats of the unbounded storage %+v", stats)
+	}
+}
+
+func TestSharedDummyStorage(t *testing.T) {
+	defer ResetDummySizeRegistry()
+	open := func(dsn string) *Dummy {
+		cli, err := Open(dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cli.(*Dummy)
+	}
+
+	if open("dummy://").Storage() != open("dummy://?bw=1GiB&evict=lfu").Storage() {
+		t.Fatal("expect dummy DSNs without a namespace or capacity to share the storage")
+	} else if open("dummy://").Storage() != NewDummy(0, DummyStore).Storage() {
+		t.Fatal("expect dummy DSNs to share the storage of NewDummy")
+	}
+	run1 := open("dummy://?ns=run1").Storage()
+	if run1 != open("dummy://?ns=run1&evict=fifo").Storage() || run1 == open("dummy://?ns=run2").Storage() ||
+		run1 == open("dummy://").Storage() {
+		t.Fatal("expect dummy DSNs to share the storage of the namespace")
+	}
+	capped := open("dummy://?ns=run1&cap=1KiB").Storage()
+	if capped == run1 || capped != open("dummy://?ns=run1&cap=1KiB&evict=lru").Storage() ||
+		capped == open("dummy://?ns=run1&cap=1KiB&evict=lfu").Storage() {
+		t.Fatal("expect dummy DSNs to share the storage of the capacity and eviction policy")
+	}
+
+	ctx := context.Background()
+	if _, err := open("dummy://?ns=run1").EcSetContext(ctx, "key", make([]byte, 10)); err != nil {
+		t.Fatal(err)
+	} else if _, _, err := open("dummy://?ns=run1").EcGetContext(ctx, "key"); err != nil {
+		t.Fatalf("expect the object set by another client, got %v", err)
+	}
+	ResetDummySizeRegistry()
+	if _, _, err := open("dummy://?ns=run1").EcGetContext(ctx, "key"); err == nil {
+		t.Fatal("expect storages to be reset")
+	}
+}
+
+func TestDummyCacheEviction(t *testing.T) {
+	cli := NewDummyWithStorage(NewDummyStorage(1000, nil), &DummyOptions{Type: DummyCache, Overhead: time.Millisecond})
+	ctx := context.Background()
+	for i := 0; i < 20; i++ {
+		if _, err := cli.EcSetContext(ctx, string(rune('a'+i)), make([]byte, 100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hits := 0
+	for i := 0; i < 20; i++ {
+		start := time.Now()
+		if _, _, err := cli.EcGetContext(ctx, string(rune('a'+i))); err == nil {
+			hits++
+		} else if elapsed := time.Since(start); elapsed < time.Millisecond {
+			t.Fatalf("expect misses to take the overhead, got %v", elapsed)
+		}
+	}
+	// Caches of a capacity miss evicted objects only.
+	if stats := cli.Storage().Stats(); hits != 10 || stats.Evictions != 10 || stats.Misses != 10 {
+		t.Fatalf("expect the last 10 objects to hit, got %d hits and stats %+v", hits, stats)
+	}
+}
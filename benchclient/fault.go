@@ -0,0 +1,513 @@
+package benchclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	infinistore "github.com/ds2-lab/infinistore/client"
+	"github.com/google/uuid"
+)
+
+const (
+	FaultLatency  = "latency"  // Extra latency from a distribution before the request.
+	FaultError    = "error"    // Fail without sending the request.
+	FaultNotFound = "notfound" // GETs miss without sending the request.
+	FaultStall    = "stall"    // Stall until the deadline of the request, or for FaultStallMax without a deadline. An argument caps stalls.
+	FaultTruncate = "truncate" // Cut the payload to a random length.
+	FaultCorrupt  = "corrupt"  // Flip a random byte of the payload.
+
+	// FaultUnapplied counts payload faults of GETs that are not applied, because readers return no data.
+	FaultUnapplied = "unapplied"
+
+	// FaultStallMax is the default stall of requests without a deadline.
+	FaultStallMax = time.Minute
+)
+
+var (
+	ErrInjected     = errors.New("injected fault")
+	ErrInvalidFault = errors.New("invalid fault")
+
+	faultKinds = []string{FaultLatency, FaultError, FaultNotFound, FaultStall, FaultTruncate, FaultCorrupt}
+)
+
+// LatencyDistribution is the distribution of injected latencies: "fixed" A, "uniform" in [A, B],
+// "exp" with the mean A, or "normal" with the mean A and the standard deviation B.
+type LatencyDistribution struct {
+	Dist string
+	A    time.Duration
+	B    time.Duration
+}
+
+// Sample returns a latency of the distribution. Negative latencies of the normal distribution are 0.
+func (d *LatencyDistribution) Sample(rnd *rand.Rand) time.Duration {
+	var latency float64
+	switch d.Dist {
+	case "uniform":
+		latency = float64(d.A) + rnd.Float64()*float64(d.B-d.A)
+	case "exp":
+		latency = rnd.ExpFloat64() * float64(d.A)
+	case "normal":
+		latency = float64(d.A) + rnd.NormFloat64()*float64(d.B)
+	default:
+		latency = float64(d.A)
+	}
+	if latency < 0 {
+		return 0
+	}
+	return time.Duration(latency)
+}
+
+// Fault is a fault injected into a percentage of requests in a window of time since the start of the injector.
+type Fault struct {
+	Kind    string
+	Op      string              // "set" or "get", "" for both. Not-found faults apply to GETs only.
+	Rate    float64             // Percentage of requests.
+	From    time.Duration       // Start of the window.
+	To      time.Duration       // End of the window, 0 for no end.
+	Latency LatencyDistribution // Latency faults only.
+	Stall   time.Duration       // Stall faults only, the max stall. Until the deadline, or FaultStallMax without a deadline, if 0.
+}
+
+// Active returns if the fault applies to requests of the operation at the elapsed time.
+func (f *Fault) Active(op string, elapsed time.Duration) bool {
+	return (f.Op == "" || f.Op == op) && elapsed >= f.From && (f.To == 0 || elapsed < f.To)
+}
+
+// ParseFaults parses faults separated by ";" in the form of "[op.]kind[:arg...]=rate[%][@from..to]", e.g.
+// "error=30%@5m..10m" fails 30% of requests between minute 5 and 10, and "get.latency:exp:20ms=100" delays
+// every GET by an exponentially distributed latency with the mean 20ms. Latency arguments are "fixed:10ms",
+// "uniform:5ms:50ms", "exp:20ms", and "normal:20ms:5ms". Stalls take the max stall, e.g. "stall:10s=1".
+func ParseFaults(spec string) ([]*Fault, error) {
+	var faults []*Fault
+	for _, field := range strings.Split(spec, ";") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		fault, err := parseFault(field)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidFault, field, err)
+		}
+		faults = append(faults, fault)
+	}
+	return faults, nil
+}
+
+func parseFault(field string) (*Fault, error) {
+	kv := strings.SplitN(field, "=", 2)
+	if len(kv) != 2 {
+		return nil, errors.New("no rate")
+	}
+	fault := &Fault{}
+
+	// Rate and window.
+	value := kv[1]
+	if at := strings.Index(value, "@"); at >= 0 {
+		bounds := strings.SplitN(value[at+1:], "..", 2)
+		if len(bounds) != 2 {
+			return nil, errors.New("window is not in the form of from..to")
+		}
+		var err error
+		if fault.From, err = parseFaultDuration(bounds[0]); err != nil {
+			return nil, err
+		}
+		if fault.To, err = parseFaultDuration(bounds[1]); err != nil {
+			return nil, err
+		} else if fault.To != 0 && fault.To <= fault.From {
+			return nil, errors.New("window ends before it starts")
+		}
+		value = value[:at]
+	}
+	rate, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), "%"), 64)
+	if err != nil {
+		return nil, err
+	} else if rate < 0 || rate > 100 {
+		return nil, fmt.Errorf("rate %v is not in [0, 100]", rate)
+	}
+	fault.Rate = rate
+
+	// Operation, kind and arguments.
+	args := strings.Split(strings.ToLower(strings.TrimSpace(kv[0])), ":")
+	if dot := strings.Index(args[0], "."); dot >= 0 {
+		if fault.Op = args[0][:dot]; fault.Op != "set" && fault.Op != "get" {
+			return nil, fmt.Errorf("unknown operation %s", fault.Op)
+		}
+		args[0] = args[0][dot+1:]
+	}
+	fault.Kind, args = args[0], args[1:]
+	switch fault.Kind {
+	case FaultLatency:
+		return fault, parseLatency(&fault.Latency, args)
+	case FaultStall:
+		if len(args) > 1 {
+			return nil, errors.New("too many arguments")
+		} else if len(args) == 1 {
+			fault.Stall, err = time.ParseDuration(args[0])
+		}
+		return fault, err
+	case FaultError, FaultNotFound, FaultTruncate, FaultCorrupt:
+		if len(args) > 0 {
+			return nil, errors.New("too many arguments")
+		}
+		return fault, nil
+	default:
+		return nil, fmt.Errorf("unknown kind %s, support %s", fault.Kind, strings.Join(faultKinds, ", "))
+	}
+}
+
+func parseLatency(d *LatencyDistribution, args []string) (err error) {
+	if len(args) == 0 {
+		return errors.New("no latency")
+	} else if len(args) == 1 {
+		// Shorthand of the fixed latency.
+		args = []string{"fixed", args[0]}
+	}
+	var n int
+	switch d.Dist = args[0]; d.Dist {
+	case "fixed", "exp":
+		n = 1
+	case "uniform", "normal":
+		n = 2
+	default:
+		return fmt.Errorf("unknown latency distribution %s, support fixed, uniform, exp, and normal", d.Dist)
+	}
+	if len(args) != n+1 {
+		return fmt.Errorf("latency distribution %s takes %d arguments", d.Dist, n)
+	}
+	if d.A, err = time.ParseDuration(args[1]); err != nil {
+		return
+	}
+	if n == 2 {
+		if d.B, err = time.ParseDuration(args[2]); err != nil {
+			return
+		}
+	}
+	if d.A < 0 || d.B < 0 || d.Dist == "uniform" && d.B < d.A {
+		return errors.New("invalid latency range")
+	}
+	return nil
+}
+
+func parseFaultDuration(s string) (time.Duration, error) {
+	if s = strings.TrimSpace(s); s == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// FaultInjector decides the faults of requests of clients of WithFaults. Windows of faults are relative to the start
+// of the injector, which is shared by clients. No fault is injected before the injector starts.
+type FaultInjector struct {
+	faults []*Fault
+	seed   int64
+	start  time.Time
+	mu     sync.Mutex
+	counts map[string]uint64
+}
+
+// NewFaultInjector returns the injector of the faults. Each client rolls faults with its own random source from
+// the seed and the id of the client, so the same seed injects the same faults into the same sequence of requests
+// of each client, in the same windows.
+func NewFaultInjector(faults []*Fault, seed int64) *FaultInjector {
+	return &FaultInjector{
+		faults: faults,
+		seed:   seed,
+		counts: make(map[string]uint64),
+	}
+}
+
+// Start starts injecting faults, or restarts the clock of windows.
+func (in *FaultInjector) Start() {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.start = time.Now()
+}
+
+// Counts returns the number of requests affected by each kind of fault, and of unapplied payload faults by
+// FaultUnapplied.
+func (in *FaultInjector) Counts() map[string]uint64 {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	counts := make(map[string]uint64, len(in.counts))
+	for kind, n := range in.counts {
+		counts[kind] = n
+	}
+	return counts
+}
+
+// injection is the faults of a request.
+type injection struct {
+	delay   time.Duration
+	stall   time.Duration
+	stalled bool // Stall until the deadline if stall is 0.
+	err     error
+	payload string // FaultTruncate or FaultCorrupt.
+	rnd     *rand.Rand
+	// injector counts payload faults that are not applied.
+	injector *FaultInjector
+}
+
+// roll rolls faults of a request of the operation with the random source of the client.
+func (in *FaultInjector) roll(op string, rnd *rand.Rand) *injection {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	inj := &injection{}
+	if in.start.IsZero() {
+		return inj
+	}
+	elapsed := time.Since(in.start)
+	for _, fault := range in.faults {
+		if !fault.Active(op, elapsed) || rnd.Float64()*100 >= fault.Rate {
+			continue
+		}
+		switch fault.Kind {
+		case FaultLatency:
+			inj.delay += fault.Latency.Sample(rnd)
+		case FaultStall:
+			inj.stall, inj.stalled = fault.Stall, true
+		case FaultError:
+			if inj.err != nil {
+				continue
+			}
+			inj.err = fmt.Errorf("%w: %s", ErrInjected, fault.Kind)
+		case FaultNotFound:
+			if inj.err != nil || op != "get" {
+				continue
+			}
+			inj.err = infinistore.ErrNotFound
+		case FaultTruncate, FaultCorrupt:
+			if inj.payload != "" {
+				continue
+			}
+			inj.payload = fault.Kind
+		}
+		in.counts[fault.Kind]++
+	}
+	if inj.payload != "" {
+		inj.injector = in
+		inj.rnd = rand.New(rand.NewSource(rnd.Int63()))
+	}
+	return inj
+}
+
+// unapplied counts the payload fault as unapplied.
+func (in *FaultInjector) unapplied(kind string) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.counts[kind]--
+	in.counts[FaultUnapplied]++
+}
+
+// wait delays the request by the injected latency and stall. It returns the error of the context if the context is
+// done before the wait ends.
+func (inj *injection) wait(ctx context.Context) error {
+	wait := inj.delay + inj.stall
+	if inj.stalled && inj.stall == 0 {
+		if _, ok := ctx.Deadline(); ok {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		wait += FaultStallMax
+	}
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// mangle returns the payload truncated or corrupted. The payload is copied, and left intact otherwise.
+func (inj *injection) mangle(payload []byte) []byte {
+	if inj.payload == "" || len(payload) == 0 {
+		return payload
+	}
+	switch inj.payload {
+	case FaultTruncate:
+		return payload[:inj.rnd.Intn(len(payload))]
+	default:
+		mangled := make([]byte, len(payload))
+		copy(mangled, payload)
+		mangled[inj.rnd.Intn(len(mangled))] ^= 0xff
+		return mangled
+	}
+}
+
+// WithFaults returns the client that injects faults of the injector into requests. The id identifies the client
+// among clients of the injector. Injected errors and misses return without sending requests, and truncated or
+// corrupted payloads are sent by SETs or returned by GETs. Batch requests share injected latencies and stalls,
+// and other faults are injected per key.
+func WithFaults(cli Client, injector *FaultInjector, id int) ContextClient {
+	ctxCli := WithContext(cli)
+	fault := &faultClient{ContextClient: ctxCli, injector: injector, rnd: rand.New(rand.NewSource(injector.seed + int64(id)))}
+	if batch, ok := ctxCli.(ContextBatchClient); ok {
+		return &faultBatchClient{faultClient: fault, batch: batch}
+	}
+	return fault
+}
+
+type faultClient struct {
+	ContextClient
+	injector *FaultInjector
+	mu       sync.Mutex
+	rnd      *rand.Rand
+}
+
+func (c *faultClient) roll(op string) *injection {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.injector.roll(op, c.rnd)
+}
+
+func (c *faultClient) EcSet(key string, val []byte, args ...interface{}) (string, error) {
+	opts, err := OptionsFromArgs(args...)
+	if err != nil {
+		return "", err
+	}
+	return c.EcSetContext(context.Background(), key, val, opts...)
+}
+
+func (c *faultClient) EcSetContext(ctx context.Context, key string, val []byte, opts ...RequestOption) (string, error) {
+	inj := c.roll("set")
+	if err := inj.wait(ctx); err != nil {
+		return uuid.New().String(), err
+	} else if inj.err != nil {
+		return uuid.New().String(), inj.err
+	}
+	return c.ContextClient.EcSetContext(ctx, key, inj.mangle(val), opts...)
+}
+
+func (c *faultClient) EcGet(key string, args ...interface{}) (string, infinistore.ReadAllCloser, error) {
+	opts, err := OptionsFromArgs(args...)
+	if err != nil {
+		return "", nil, err
+	}
+	return c.EcGetContext(context.Background(), key, opts...)
+}
+
+func (c *faultClient) EcGetContext(ctx context.Context, key string, opts ...RequestOption) (string, infinistore.ReadAllCloser, error) {
+	inj := c.roll("get")
+	if err := inj.wait(ctx); err != nil {
+		return uuid.New().String(), nil, err
+	} else if inj.err != nil {
+		return uuid.New().String(), nil, inj.err
+	}
+	reqId, reader, err := c.ContextClient.EcGetContext(ctx, key, opts...)
+	reader, err = inj.mangleReader(reader, err)
+	return reqId, reader, err
+}
+
+// mangleReader reads the payload of the reader to truncate or corrupt it. Readers that return no data, e.g. of dummy
+// clients, are returned intact, and the fault is counted as unapplied.
+func (inj *injection) mangleReader(reader infinistore.ReadAllCloser, err error) (infinistore.ReadAllCloser, error) {
+	if inj.payload == "" || reader == nil || err != nil {
+		return reader, err
+	}
+	data, err := reader.ReadAll()
+	if errors.Is(err, ErrNotSupported) {
+		inj.injector.unapplied(inj.payload)
+		return reader, nil
+	}
+	reader.Close()
+	if err != nil {
+		return nil, err
+	}
+	return NewByteReader(inj.mangle(data)), nil
+}
+
+type faultBatchClient struct {
+	*faultClient
+	batch ContextBatchClient
+}
+
+// rollBatch rolls faults of each key and waits for the longest injected latency and stall. It returns the indexes
+// of keys to send.
+func (c *faultBatchClient) rollBatch(ctx context.Context, op string, keys []string) ([]*injection, []int, error) {
+	injs := make([]*injection, len(keys))
+	longest := &injection{}
+	sending := make([]int, 0, len(keys))
+	for i := range keys {
+		injs[i] = c.roll(op)
+		if wait := injs[i].delay + injs[i].stall; wait > longest.delay {
+			longest.delay = wait
+		}
+		if injs[i].stalled && injs[i].stall == 0 {
+			longest.stalled = true
+		}
+		if injs[i].err == nil {
+			sending = append(sending, i)
+		}
+	}
+	return injs, sending, longest.wait(ctx)
+}
+
+func (c *faultBatchClient) EcMSet(keys []string, vals [][]byte) ([]string, []error) {
+	return c.EcMSetContext(context.Background(), keys, vals)
+}
+
+func (c *faultBatchClient) EcMSetContext(ctx context.Context, keys []string, vals [][]byte) ([]string, []error) {
+	reqIds := make([]string, len(keys))
+	errs := make([]error, len(keys))
+	injs, sending, err := c.rollBatch(ctx, "set", keys)
+	for i, inj := range injs {
+		reqIds[i], errs[i] = uuid.New().String(), err
+		if err == nil {
+			errs[i] = inj.err
+		}
+	}
+	if err != nil || len(sending) == 0 {
+		return reqIds, errs
+	}
+
+	subKeys, subVals := make([]string, len(sending)), make([][]byte, len(sending))
+	for j, i := range sending {
+		subKeys[j], subVals[j] = keys[i], injs[i].mangle(vals[i])
+	}
+	subReqIds, subErrs := c.batch.EcMSetContext(ctx, subKeys, subVals)
+	for j, i := range sending {
+		reqIds[i], errs[i] = subReqIds[j], subErrs[j]
+	}
+	return reqIds, errs
+}
+
+func (c *faultBatchClient) EcMGet(keys []string) ([]string, []infinistore.ReadAllCloser, []error) {
+	return c.EcMGetContext(context.Background(), keys)
+}
+
+func (c *faultBatchClient) EcMGetContext(ctx context.Context, keys []string) ([]string, []infinistore.ReadAllCloser, []error) {
+	reqIds := make([]string, len(keys))
+	readers := make([]infinistore.ReadAllCloser, len(keys))
+	errs := make([]error, len(keys))
+	injs, sending, err := c.rollBatch(ctx, "get", keys)
+	for i, inj := range injs {
+		reqIds[i], errs[i] = uuid.New().String(), err
+		if err == nil {
+			errs[i] = inj.err
+		}
+	}
+	if err != nil || len(sending) == 0 {
+		return reqIds, readers, errs
+	}
+
+	subKeys := make([]string, len(sending))
+	for j, i := range sending {
+		subKeys[j] = keys[i]
+	}
+	subReqIds, subReaders, subErrs := c.batch.EcMGetContext(ctx, subKeys)
+	for j, i := range sending {
+		reqIds[i] = subReqIds[j]
+		readers[i], errs[i] = injs[i].mangleReader(subReaders[j], subErrs[j])
+	}
+	return reqIds, readers, errs
+}
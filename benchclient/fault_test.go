@@ -0,0 +1,234 @@
+package benchclient
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	infinistore "github.com/ds2-lab/infinistore/client"
+)
+
+func TestParseFaults(t *testing.T) {
+	faults, err := ParseFaults(" error=30%@5m..10m; get.latency:exp:20ms=100;latency:5ms=1.5; set.stall:10s=1;stall=2@1m..;get.notfound=10;truncate=5;SET.Corrupt=1;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []*Fault{
+		{Kind: FaultError, Rate: 30, From: 5 * time.Minute, To: 10 * time.Minute},
+		{Kind: FaultLatency, Op: "get", Rate: 100, Latency: LatencyDistribution{Dist: "exp", A: 20 * time.Millisecond}},
+		{Kind: FaultLatency, Rate: 1.5, Latency: LatencyDistribution{Dist: "fixed", A: 5 * time.Millisecond}},
+		{Kind: FaultStall, Op: "set", Rate: 1, Stall: 10 * time.Second},
+		{Kind: FaultStall, Rate: 2, From: time.Minute},
+		{Kind: FaultNotFound, Op: "get", Rate: 10},
+		{Kind: FaultTruncate, Rate: 5},
+		{Kind: FaultCorrupt, Op: "set", Rate: 1},
+	}
+	if len(faults) != len(expect) {
+		t.Fatalf("expect %d faults, got %d", len(expect), len(faults))
+	}
+	for i := range expect {
+		if !reflect.DeepEqual(faults[i], expect[i]) {
+			t.Errorf("fault %d: expect %+v, got %+v", i, expect[i], faults[i])
+		}
+	}
+
+	if faults, err := ParseFaults(" ; "); err != nil || len(faults) != 0 {
+		t.Fatalf("expect no fault, got %v, %v", faults, err)
+	}
+
+	for _, spec := range []string{
+		"error",
+		"error=",
+		"error=101",
+		"error=-1%",
+		"error=ten",
+		"error=10@5m",
+		"error=10@10m..5m",
+		"error=10@x..5m",
+		"del.error=10",
+		"crash=10",
+		"error:1ms=10",
+		"corrupt:1=10",
+		"stall:1s:2s=10",
+		"stall:long=10",
+		"latency=10",
+		"latency:gamma:1ms=10",
+		"latency:uniform:5ms=10",
+		"latency:uniform:5ms:1ms=10",
+		"latency:normal:-1ms:1ms=10",
+		"error=10;notfound",
+	} {
+		if _, err := ParseFaults(spec); !errors.Is(err, ErrInvalidFault) {
+			t.Errorf("%s: expect %v, got %v", spec, ErrInvalidFault, err)
+		}
+	}
+}
+
+func TestLatencyDistribution(t *testing.T) {
+	cases := []struct {
+		dist     LatencyDistribution
+		min, max time.Duration
+	}{
+		{LatencyDistribution{Dist: "fixed", A: 10 * time.Millisecond}, 10 * time.Millisecond, 10 * time.Millisecond},
+		{LatencyDistribution{Dist: "uniform", A: 5 * time.Millisecond, B: 50 * time.Millisecond}, 5 * time.Millisecond, 50 * time.Millisecond},
+		{LatencyDistribution{Dist: "exp", A: 20 * time.Millisecond}, 0, time.Duration(1<<63 - 1)},
+		// Negative latencies are 0.
+		{LatencyDistribution{Dist: "normal", A: time.Millisecond, B: 10 * time.Millisecond}, 0, time.Duration(1<<63 - 1)},
+	}
+	for _, c := range cases {
+		rnd := rand.New(rand.NewSource(1))
+		var sum time.Duration
+		for i := 0; i < 10000; i++ {
+			latency := c.dist.Sample(rnd)
+			if latency < c.min || latency > c.max {
+				t.Fatalf("%s: latency %v is not in [%v, %v]", c.dist.Dist, latency, c.min, c.max)
+			}
+			sum += latency
+		}
+		if c.dist.Dist == "exp" {
+			if mean := sum / 10000; mean < 18*time.Millisecond || mean > 22*time.Millisecond {
+				t.Fatalf("exp: mean %v, expect about %v", mean, c.dist.A)
+			}
+		}
+	}
+}
+
+// injectErrors returns the errors of SETs and GETs of the client of the injector.
+func injectErrors(t *testing.T, injector *FaultInjector, id int, n int) []error {
+	t.Helper()
+	cli := WithFaults(NewDummy(0, DummyStore), injector, id)
+	defer cli.Close()
+	errs := make([]error, 0, 2*n)
+	for i := 0; i < n; i++ {
+		_, err := cli.EcSet("key", []byte("value"))
+		errs = append(errs, err)
+		_, reader, err := cli.EcGet("key")
+		if reader != nil {
+			reader.Close()
+		}
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+func TestFaultInjectorSeed(t *testing.T) {
+	faults, err := ParseFaults("error=20;get.notfound=30")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// No fault is injected before the injector starts.
+	injector := NewFaultInjector(faults, 42)
+	for i, err := range injectErrors(t, injector, 0, 100) {
+		if err != nil {
+			t.Fatalf("request %d: %v before the start", i, err)
+		}
+	}
+
+	run := func(seed int64, id int) ([]error, map[string]uint64) {
+		injector := NewFaultInjector(faults, seed)
+		injector.Start()
+		return injectErrors(t, injector, id, 1000), injector.Counts()
+	}
+	errs, counts := run(42, 0)
+	var injected, notFound int
+	for i, err := range errs {
+		switch {
+		case err == nil:
+		case errors.Is(err, ErrInjected):
+			injected++
+		case errors.Is(err, infinistore.ErrNotFound) && i%2 == 1:
+			notFound++
+		default:
+			t.Fatalf("request %d: unexpected error %v", i, err)
+		}
+	}
+	// Misses are counted if rolled, unless the request already fails.
+	if uint64(injected) != counts[FaultError] || uint64(notFound) > counts[FaultNotFound] {
+		t.Fatalf("%d errors and %d misses, counted %v", injected, notFound, counts)
+	} else if injected < 300 || injected > 500 || notFound < 180 || notFound > 360 {
+		t.Fatalf("%d of 2000 requests failed and %d of 1000 GETs missed, expect about 400 and 240", injected, notFound)
+	}
+
+	// The same seed and client inject the same faults.
+	again, againCounts := run(42, 0)
+	if !reflect.DeepEqual(errs, again) || !reflect.DeepEqual(counts, againCounts) {
+		t.Fatal("the same seed injects different faults")
+	}
+	// Other clients and seeds roll apart.
+	if other, _ := run(42, 1); reflect.DeepEqual(errs, other) {
+		t.Fatal("clients inject the same faults")
+	} else if other, _ := run(43, 0); reflect.DeepEqual(errs, other) {
+		t.Fatal("seeds inject the same faults")
+	}
+}
+
+func TestFaultWindow(t *testing.T) {
+	faults, err := ParseFaults("error=100@50ms..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	injector := NewFaultInjector(faults, 1)
+	injector.Start()
+	if errs := injectErrors(t, injector, 0, 1); errs[0] != nil || errs[1] != nil {
+		t.Fatalf("unexpected errors before the window: %v", errs)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if errs := injectErrors(t, injector, 0, 1); !errors.Is(errs[0], ErrInjected) || !errors.Is(errs[1], ErrInjected) {
+		t.Fatalf("expect %v in the window, got %v", ErrInjected, errs)
+	}
+}
+
+func TestFaultPayload(t *testing.T) {
+	val := []byte(strings.Repeat("0123456789", 100))
+	get := func(spec string, cli Client) ([]byte, map[string]uint64) {
+		t.Helper()
+		faults, err := ParseFaults(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		injector := NewFaultInjector(faults, 1)
+		injector.Start()
+		cli = WithFaults(cli, injector, 0)
+		if _, err := cli.EcSet("key", val); err != nil {
+			t.Fatal(err)
+		}
+		_, reader, err := cli.EcGet("key")
+		if err != nil {
+			t.Fatalf("%s: %v", spec, err)
+		}
+		defer reader.Close()
+		data, err := reader.ReadAll()
+		if err != nil && !errors.Is(err, ErrNotSupported) {
+			t.Fatalf("%s: %v", spec, err)
+		}
+		return data, injector.Counts()
+	}
+
+	data, counts := get("get.truncate=100", NewFile("file", t.TempDir()))
+	if len(data) >= len(val) || !bytes.Equal(data, val[:len(data)]) || counts[FaultTruncate] != 1 {
+		t.Fatalf("expect a truncated payload, got %d bytes, %v", len(data), counts)
+	}
+	for _, spec := range []string{"get.corrupt=100", "set.corrupt=100"} {
+		data, counts = get(spec, NewFile("file", t.TempDir()))
+		diff := 0
+		for i := range data {
+			if data[i] != val[i] {
+				diff++
+			}
+		}
+		if len(data) != len(val) || diff != 1 || counts[FaultCorrupt] != 1 {
+			t.Fatalf("%s: expect a corrupted byte, got %d bytes of %d different bytes, %v", spec, len(data), diff, counts)
+		}
+	}
+
+	// GETs of dummy clients return no data to mangle.
+	data, counts = get("get.truncate=100", NewDummy(0, DummyStore))
+	if data != nil || counts[FaultTruncate] != 0 || counts[FaultUnapplied] != 1 {
+		t.Fatalf("expect an unapplied fault, got %d bytes, %v", len(data), counts)
+	}
+}
@@ -1,52 +1,338 @@
 package benchclient
 
 import (
-	"io/ioutil"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
 	"os"
 	"path"
+	"strings"
+	"sync"
+	"unsafe"
 
 	infinistore "github.com/ds2-lab/infinistore/client"
 )
 
+const (
+	// File I/O checks the context between chunks.
+	FileChunkSize = 1048576
+	// FileAlignment is the alignment of offsets and buffers of direct reads.
+	FileAlignment = 4096
+	// FileMaxName is the max length of escaped names. Longer names are cut and suffixed by the hash of the key.
+	FileMaxName = 255
+
+	FileLayoutNested = "nested" // Keys are paths under the base path, e.g. "v2/repo/blobs/sha256" in nested directories.
+	FileLayoutHash   = "hash"   // Escaped keys in directories fanned out by the hash of keys, e.g. "3f/a2/key".
+	FileLayoutEscape = "escape" // Escaped keys in the base path.
+)
+
+var (
+	ErrInvalidKey = errors.New("invalid key")
+)
+
+// FileOptions configures how file clients store objects.
+type FileOptions struct {
+	Layout string // FileLayoutNested, FileLayoutHash, or FileLayoutEscape. FileLayoutNested if empty.
+	Depth  int    // Levels of directories of FileLayoutHash, 256 directories per level. 2 if 0.
+	Fsync  bool   // Sync files to the storage before SETs return.
+	Direct bool   // Read files with O_DIRECT, bypassing the page cache. Linux only.
+	Stream bool   // GETs return readers of files instead of reading objects into memory.
+}
+
+// Validate returns an error if the options are invalid or not supported on the platform.
+func (o *FileOptions) Validate() error {
+	switch o.Layout {
+	case "", FileLayoutNested, FileLayoutHash, FileLayoutEscape:
+	default:
+		return fmt.Errorf("unsupported layout %s, support nested, hash, and escape", o.Layout)
+	}
+	if o.Depth < 0 || o.Depth > sha1.Size {
+		return fmt.Errorf("depth %d is not in [0, %d]", o.Depth, sha1.Size)
+	}
+	if o.Direct && !fileDirectSupported {
+		return fmt.Errorf("direct reads: %w", ErrNotSupported)
+	}
+	return nil
+}
+
 type File struct {
 	*defaultClient
 	basePath string
+	opts     FileOptions
+	dirs     sync.Map // Directories created.
 }
 
+// NewFile returns a new file client of the nested layout.
 func NewFile(provider string, path string) *File {
+	return NewFileWithOptions(provider, path, &FileOptions{})
+}
+
+// NewFileWithOptions returns a new file client. Requests fail if the options are invalid, see FileOptions.Validate.
+func NewFileWithOptions(provider string, path string, opts *FileOptions) *File {
 	client := &File{
 		defaultClient: newDefaultClient(provider + ": "),
 		basePath:      path,
+		opts:          *opts,
 	}
 	client.setter = client.set
 	client.getter = client.get
+	client.deleter = client.del
 	client.abbr = "f"
+	client.getOpts = OptionRange
 	return client
 }
 
-func (c *File) set(key string, val []byte) (err error) {
+// path returns the path of the file of the key.
+func (c *File) path(key string) (string, error) {
+	switch c.opts.Layout {
+	case FileLayoutHash:
+		sum := sha1.Sum([]byte(key))
+		depth := c.opts.Depth
+		if depth == 0 {
+			depth = 2
+		}
+		elems := make([]string, 0, depth+2)
+		elems = append(elems, c.basePath)
+		for i := 0; i < depth; i++ {
+			elems = append(elems, hex.EncodeToString(sum[i:i+1]))
+		}
+		return path.Join(append(elems, escapeName(key))...), nil
+	case FileLayoutEscape:
+		return path.Join(c.basePath, escapeName(key)), nil
+	default:
+		// Keys can not escape the base path.
+		name := path.Clean("/" + key)
+		if name == "/" {
+			return "", fmt.Errorf("%w: %q", ErrInvalidKey, key)
+		}
+		return path.Join(c.basePath, name), nil
+	}
+}
+
+// escapeName escapes the key as a file name.
+func escapeName(key string) string {
+	name := url.PathEscape(key)
+	if strings.HasPrefix(name, ".") {
+		// Avoid "." and "..", and hidden files.
+		name = "%2E" + name[1:]
+	}
+	if len(name) > FileMaxName {
+		sum := sha1.Sum([]byte(key))
+		name = name[:FileMaxName-2*sha1.Size-1] + "~" + hex.EncodeToString(sum[:])
+	}
+	return name
+}
+
+// mkdir creates the directory of the file if not created yet.
+func (c *File) mkdir(name string) error {
+	dir := path.Dir(name)
+	if dir == c.basePath {
+		return nil
+	} else if _, ok := c.dirs.Load(dir); ok {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	c.dirs.Store(dir, struct{}{})
+	return nil
+}
+
+// set writes the object. Files do not expire, so TTLs are not supported.
+func (c *File) set(ctx context.Context, key string, val []byte, opts *RequestOptions) (err error) {
+	if err = c.opts.Validate(); err != nil {
+		return
+	}
+	var name string
+	if name, err = c.path(key); err != nil {
+		return
+	}
+	if err = c.mkdir(name); err != nil {
+		return
+	}
 	var file *os.File
-	file, err = os.OpenFile(path.Join(c.basePath, key), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	file, err = os.OpenFile(name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
 	if err != nil {
 		return
 	}
 	defer file.Close()
 
-	_, err = file.Write(val)
-	return
+	for off := 0; ; off += FileChunkSize {
+		if err = ctx.Err(); err != nil {
+			// Remove the partial object.
+			os.Remove(name)
+			return
+		}
+		end := off + FileChunkSize
+		if end > len(val) {
+			end = len(val)
+		}
+		if _, err = file.Write(val[off:end]); err != nil {
+			return
+		} else if end == len(val) {
+			break
+		}
+	}
+	if c.opts.Fsync {
+		return file.Sync()
+	}
+	return nil
 }
 
-func (c *File) get(key string) (reader infinistore.ReadAllCloser, err error) {
-	var file *os.File
-	if file, err = os.OpenFile(path.Join(c.basePath, key), os.O_RDONLY, 0); err != nil {
-		return
+func (c *File) get(ctx context.Context, key string, opts *RequestOptions) (infinistore.ReadAllCloser, error) {
+	if err := c.opts.Validate(); err != nil {
+		return nil, err
+	}
+	name, err := c.path(key)
+	if err != nil {
+		return nil, err
+	}
+	flag := os.O_RDONLY
+	if c.opts.Direct {
+		flag |= fileDirectFlag
+	}
+	file, err := os.OpenFile(name, flag, 0)
+	if os.IsNotExist(err) {
+		return nil, infinistore.ErrNotFound
+	} else if err != nil {
+		return nil, err
 	}
-	defer file.Close()
 
-	var data []byte
-	if data, err = ioutil.ReadAll(file); err != nil {
-		return
+	reader, err := c.open(file, opts)
+	if err != nil {
+		file.Close()
+		return nil, err
+	} else if c.opts.Stream {
+		// The file is closed by the reader.
+		return reader, nil
+	}
+	defer reader.Close()
+
+	var buf bytes.Buffer
+	buf.Grow(reader.Len())
+	for {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		var n int64
+		if n, err = io.CopyN(&buf, reader, FileChunkSize); err == io.EOF || err == nil && n < FileChunkSize {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return NewByteReader(buf.Bytes()), nil
+}
+
+// open returns the reader of the object, or of the range of the object, in the file.
+func (c *File) open(file *os.File, opts *RequestOptions) (*FileReader, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	var offset, length int64
+	if opts.Has(OptionRange) {
+		offset, length = opts.Offset, opts.Length
+	}
+	size := rangeSize(int(info.Size()), offset, length)
+
+	var src io.Reader
+	if c.opts.Direct {
+		if src, err = newDirectReader(file, offset); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err = file.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		src = file
+	}
+	return &FileReader{Reader: io.LimitReader(src, int64(size)), file: file, size: size}, nil
+}
+
+func (c *File) del(ctx context.Context, key string) error {
+	name, err := c.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); os.IsNotExist(err) {
+		return infinistore.ErrNotFound
+	} else {
+		return err
+	}
+}
+
+// FileReader reads an object from its file, and closes the file on Close.
+type FileReader struct {
+	io.Reader
+	file *os.File
+	size int
+}
+
+func (r *FileReader) Len() int { return r.size }
+
+func (r *FileReader) ReadAll() ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, r.size))
+	_, err := io.Copy(buf, r.Reader)
+	return buf.Bytes(), err
+}
+
+func (r *FileReader) Close() error { return r.file.Close() }
+
+// directReader reads a file opened with O_DIRECT from the offset. The file is read in aligned chunks into an
+// aligned buffer.
+type directReader struct {
+	file *os.File
+	buf  []byte
+	data []byte // Unread data in buf.
+	skip int    // Data to skip before the offset.
+	eof  bool
+}
+
+func newDirectReader(file *os.File, offset int64) (*directReader, error) {
+	aligned := offset &^ (FileAlignment - 1)
+	if _, err := file.Seek(aligned, io.SeekStart); err != nil {
+		return nil, err
 	}
+	return &directReader{file: file, buf: alignedBuffer(FileChunkSize), skip: int(offset - aligned)}, nil
+}
 
-	return NewByteReader(data), nil
+func (r *directReader) Read(p []byte) (int, error) {
+	for len(r.data) == 0 {
+		if r.eof {
+			return 0, io.EOF
+		}
+		n, err := r.file.Read(r.buf)
+		if err == io.EOF || n == 0 {
+			r.eof = true
+		} else if err != nil {
+			return 0, err
+		}
+		r.data = r.buf[:n]
+		if r.skip > 0 {
+			skip := r.skip
+			if skip > len(r.data) {
+				skip = len(r.data)
+			}
+			r.data, r.skip = r.data[skip:], r.skip-skip
+		}
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// alignedBuffer returns a buffer of the size aligned to FileAlignment.
+func alignedBuffer(size int) []byte {
+	buf := make([]byte, size+FileAlignment)
+	off := 0
+	if rem := int(uintptr(unsafe.Pointer(&buf[0])) & (FileAlignment - 1)); rem != 0 {
+		off = FileAlignment - rem
+	}
+	return buf[off : off+size]
 }
@@ -0,0 +1,8 @@
+package benchclient
+
+import "syscall"
+
+const (
+	fileDirectSupported = true
+	fileDirectFlag      = syscall.O_DIRECT
+)
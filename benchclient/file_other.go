@@ -0,0 +1,8 @@
+//go:build !linux
+
+package benchclient
+
+const (
+	fileDirectSupported = false
+	fileDirectFlag      = 0
+)
@@ -0,0 +1,245 @@
+package benchclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+	"unsafe"
+
+	infinistore "github.com/ds2-lab/infinistore/client"
+)
+
+func TestFileOptionsValidate(t *testing.T) {
+	for _, opts := range []*FileOptions{{}, {Layout: FileLayoutHash, Depth: sha1.Size}, {Layout: FileLayoutEscape}} {
+		if err := opts.Validate(); err != nil {
+			t.Errorf("%+v: %v", opts, err)
+		}
+	}
+	for _, opts := range []*FileOptions{{Layout: "flat"}, {Layout: FileLayoutHash, Depth: -1}, {Depth: sha1.Size + 1}} {
+		if err := opts.Validate(); err == nil {
+			t.Errorf("%+v: expect an error", opts)
+		}
+	}
+	if err := (&FileOptions{Direct: true}).Validate(); !fileDirectSupported && !errors.Is(err, ErrNotSupported) {
+		t.Errorf("expect %v, got %v", ErrNotSupported, err)
+	} else if fileDirectSupported && err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFilePath(t *testing.T) {
+	sum := sha1.Sum([]byte("v2/repo"))
+	hash := hex.EncodeToString(sum[:])
+	for _, c := range []struct {
+		opts   FileOptions
+		key    string
+		expect string
+	}{
+		{FileOptions{}, "key", "/base/key"},
+		{FileOptions{}, "v2/repo/blobs", "/base/v2/repo/blobs"},
+		{FileOptions{}, "../../etc/passwd", "/base/etc/passwd"},
+		{FileOptions{}, "/a//b/./c", "/base/a/b/c"},
+		{FileOptions{Layout: FileLayoutEscape}, "v2/repo", "/base/v2%2Frepo"},
+		{FileOptions{Layout: FileLayoutEscape}, "..", "/base/%2E."},
+		{FileOptions{Layout: FileLayoutHash}, "v2/repo", "/base/" + hash[0:2] + "/" + hash[2:4] + "/v2%2Frepo"},
+		{FileOptions{Layout: FileLayoutHash, Depth: 3}, "v2/repo", "/base/" + hash[0:2] + "/" + hash[2:4] + "/" + hash[4:6] + "/v2%2Frepo"},
+	} {
+		cli := NewFileWithOptions("file", "/base", &c.opts)
+		if name, err := cli.path(c.key); err != nil || name != c.expect {
+			t.Errorf("%s of layout %q: expect %s, got %s, %v", c.key, c.opts.Layout, c.expect, name, err)
+		}
+	}
+
+	cli := NewFile("file", "/base")
+	for _, key := range []string{"", "/", "..", "../.."} {
+		if _, err := cli.path(key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("%q: expect %v, got %v", key, ErrInvalidKey, err)
+		}
+	}
+}
+
+func TestEscapeName(t *testing.T) {
+	for _, c := range []struct{ key, expect string }{
+		{"key", "key"},
+		{"a b/c", "a%20b%2Fc"},
+		{".hidden", "%2Ehidden"},
+		{".", "%2E"},
+	} {
+		if name := escapeName(c.key); name != c.expect {
+			t.Errorf("%q: expect %s, got %s", c.key, c.expect, name)
+		}
+	}
+
+	// Long names are cut and suffixed by the hash, so keys of the same prefix do not collide.
+	long := strings.Repeat("k", 300)
+	a, b := escapeName(long+"a"), escapeName(long+"b")
+	if len(a) != FileMaxName || len(b) != FileMaxName || a == b || !strings.HasPrefix(a, "kkk") || a[FileMaxName-2*sha1.Size-1] != '~' {
+		t.Fatalf("unexpected names %s and %s", a, b)
+	}
+}
+
+func TestFile(t *testing.T) {
+	ctx := context.Background()
+	val := make([]byte, FileChunkSize*2+100)
+	rand.New(rand.NewSource(1)).Read(val)
+	for _, opts := range []FileOptions{
+		{},
+		{Layout: FileLayoutHash, Fsync: true},
+		{Layout: FileLayoutEscape, Stream: true},
+	} {
+		keys := []string{"key", "v2/repo/blobs/sha256", "v2/repo/blobs/sha256:abc", ".hidden"}
+		if opts.Layout != "" {
+			// Escaped names are cut to fit in the limit of file systems.
+			keys = append(keys, strings.Repeat("k", 300))
+		}
+		base := t.TempDir()
+		cli := NewFileWithOptions("file", base, &opts)
+		for _, key := range keys {
+			if _, err := cli.EcSetContext(ctx, key, val); err != nil {
+				t.Fatalf("%s of layout %q: %v", key, opts.Layout, err)
+			}
+			_, reader, err := cli.EcGetContext(ctx, key)
+			if err != nil {
+				t.Fatalf("%s of layout %q: %v", key, opts.Layout, err)
+			}
+			data, err := reader.ReadAll()
+			reader.Close()
+			if err != nil || reader.Len() != len(val) || !bytes.Equal(data, val) {
+				t.Fatalf("%s of layout %q: expect the object of %d bytes, got %d bytes, %v", key, opts.Layout, len(val), len(data), err)
+			}
+		}
+
+		// Files stay under the base path.
+		name, _ := cli.path(keys[1])
+		if _, err := os.Stat(name); err != nil || !strings.HasPrefix(name, base+"/") {
+			t.Fatalf("%s of layout %q: unexpected file %s, %v", keys[1], opts.Layout, name, err)
+		}
+
+		for _, key := range keys {
+			if err := cli.Delete(key); err != nil {
+				t.Fatalf("%s of layout %q: %v", key, opts.Layout, err)
+			}
+		}
+		if _, _, err := cli.EcGetContext(ctx, keys[0]); err != infinistore.ErrNotFound {
+			t.Fatalf("layout %q: expect %v, got %v", opts.Layout, infinistore.ErrNotFound, err)
+		} else if err := cli.Delete(keys[0]); err != infinistore.ErrNotFound {
+			t.Fatalf("layout %q: expect %v, got %v", opts.Layout, infinistore.ErrNotFound, err)
+		}
+	}
+
+	cli := NewFileWithOptions("file", t.TempDir(), &FileOptions{Layout: "flat"})
+	if _, err := cli.EcSetContext(ctx, "key", val); err == nil {
+		t.Fatal("expect an error of the invalid layout")
+	} else if _, err := NewFile("file", t.TempDir()).EcSetContext(ctx, "..", val); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("expect %v, got %v", ErrInvalidKey, err)
+	}
+
+	// A canceled SET leaves no partial object.
+	cli = NewFile("file", t.TempDir())
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := cli.EcSetContext(canceled, "key", val); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect %v, got %v", context.Canceled, err)
+	} else if name, _ := cli.path("key"); !os.IsNotExist(statErr(name)) {
+		t.Fatal("expect the partial object to be removed")
+	}
+}
+
+func statErr(name string) error {
+	_, err := os.Stat(name)
+	return err
+}
+
+func TestFileRange(t *testing.T) {
+	ctx := context.Background()
+	val := make([]byte, FileChunkSize+FileAlignment*2+100)
+	rand.New(rand.NewSource(1)).Read(val)
+	options := []FileOptions{{}, {Stream: true}}
+	if fileDirectSupported {
+		options = append(options, FileOptions{Direct: true}, FileOptions{Direct: true, Stream: true})
+	}
+	for _, opts := range options {
+		cli := NewFileWithOptions("file", t.TempDir(), &opts)
+		if _, err := cli.EcSetContext(ctx, "key", val); err != nil {
+			t.Fatal(err)
+		}
+		if opts.Direct {
+			// File systems like tmpfs do not support O_DIRECT.
+			name, _ := cli.path("key")
+			if file, err := os.OpenFile(name, os.O_RDONLY|fileDirectFlag, 0); err != nil {
+				t.Logf("direct reads are not supported: %v", err)
+				continue
+			} else {
+				file.Close()
+			}
+		}
+
+		for _, c := range []struct{ offset, length int64 }{
+			{0, 0},
+			{100, 0},
+			{FileAlignment + 1, 10},
+			{FileChunkSize - 10, FileAlignment},
+			{int64(len(val)) - 10, 100},
+			{int64(len(val)) + 10, 0},
+		} {
+			_, reader, err := cli.EcGetContext(ctx, "key", WithRange(c.offset, c.length))
+			if err != nil {
+				t.Fatalf("%+v: range %d+%d: %v", opts, c.offset, c.length, err)
+			}
+			expect := val[:0]
+			if c.offset < int64(len(val)) {
+				expect = val[c.offset:]
+				if c.length > 0 && c.length < int64(len(expect)) {
+					expect = expect[:c.length]
+				}
+			}
+			data, err := reader.ReadAll()
+			reader.Close()
+			if err != nil || reader.Len() != len(expect) || !bytes.Equal(data, expect) {
+				t.Fatalf("%+v: range %d+%d: expect %d bytes, got %d of %d bytes, %v",
+					opts, c.offset, c.length, len(expect), len(data), reader.Len(), err)
+			}
+		}
+	}
+}
+
+func TestFileStream(t *testing.T) {
+	ctx := context.Background()
+	cli := NewFileWithOptions("file", t.TempDir(), &FileOptions{Stream: true})
+	if _, err := cli.EcSetContext(ctx, "key", []byte("hello, world")); err != nil {
+		t.Fatal(err)
+	}
+	_, reader, err := cli.EcGetContext(ctx, "key", WithRange(7, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileReader, ok := reader.(*FileReader)
+	if !ok {
+		t.Fatalf("expect a file reader, got %T", reader)
+	}
+	buf := make([]byte, 3)
+	if n, err := fileReader.Read(buf); err != nil || string(buf[:n]) != "wor" {
+		t.Fatalf("expect \"wor\", got %q, %v", buf[:n], err)
+	} else if rest, err := fileReader.ReadAll(); err != nil || string(rest) != "ld" {
+		t.Fatalf("expect \"ld\", got %q, %v", rest, err)
+	} else if err := fileReader.Close(); err != nil {
+		t.Fatal(err)
+	} else if _, err := fileReader.Read(buf); err == nil {
+		t.Fatal("expect reads of the closed file to fail")
+	}
+}
+
+func TestAlignedBuffer(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		buf := alignedBuffer(FileAlignment * (i + 1))
+		if len(buf) != FileAlignment*(i+1) || uintptr(unsafe.Pointer(&buf[0]))%FileAlignment != 0 {
+			t.Fatalf("unexpected buffer of %d bytes at %p", len(buf), &buf[0])
+		}
+	}
+}
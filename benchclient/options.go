@@ -0,0 +1,177 @@
+package benchclient
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	SetModeNormal = "Normal"
+	SetModeReset  = "Reset" // Sets the object again after a miss. Same as SetModeNormal except for InfiniStore.
+)
+
+// Option identifies a request option. Options are combined as a bit mask.
+type Option uint
+
+const (
+	OptionDryRun Option = 1 << iota
+	OptionPlacements
+	OptionSetMode
+	OptionTTL
+	OptionRange
+)
+
+var optionNames = map[Option]string{
+	OptionDryRun:     "dry run",
+	OptionPlacements: "placements",
+	OptionSetMode:    "set mode",
+	OptionTTL:        "ttl",
+	OptionRange:      "range",
+}
+
+func (o Option) String() string {
+	var names []string
+	for opt := OptionDryRun; opt <= OptionRange; opt <<= 1 {
+		if o&opt != 0 {
+			names = append(names, optionNames[opt])
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+var (
+	ErrUnsupportedOption = errors.New("unsupported request option")
+)
+
+// RequestOptions are options of a request, set by RequestOption functions.
+type RequestOptions struct {
+	DryRun     int           // Number of nodes to simulate the request on without sending it, 0 to send the request.
+	Placements []int         // Placements of chunks. Filled by SETs of InfiniStore in dry runs, and reused in the reset mode.
+	SetMode    string        // SetModeNormal or SetModeReset.
+	TTL        time.Duration // Expiration of the object.
+	Offset     int64         // Ranged read from the offset.
+	Length     int64         // Ranged read of the length, 0 to the end of the object.
+
+	set Option
+}
+
+// RequestOption sets an option of a request.
+type RequestOption func(*RequestOptions)
+
+// WithDryRun simulates the request on the number of nodes without sending it.
+func WithDryRun(nodes int) RequestOption {
+	return func(o *RequestOptions) {
+		if nodes > 0 {
+			o.DryRun = nodes
+			o.set |= OptionDryRun
+		}
+	}
+}
+
+// WithPlacements passes the placements of chunks of a SET.
+func WithPlacements(placements []int) RequestOption {
+	return func(o *RequestOptions) {
+		o.Placements = placements
+		o.set |= OptionPlacements
+	}
+}
+
+// WithSetMode sets the mode of a SET, SetModeNormal or SetModeReset.
+func WithSetMode(mode string) RequestOption {
+	return func(o *RequestOptions) {
+		o.SetMode = mode
+		o.set |= OptionSetMode
+	}
+}
+
+// WithTTL expires the object of a SET after the duration.
+func WithTTL(ttl time.Duration) RequestOption {
+	return func(o *RequestOptions) {
+		o.TTL = ttl
+		o.set |= OptionTTL
+	}
+}
+
+// WithRange reads the length of bytes from the offset of the object. A length of 0 reads to the end of the object.
+func WithRange(offset int64, length int64) RequestOption {
+	return func(o *RequestOptions) {
+		o.Offset, o.Length = offset, length
+		o.set |= OptionRange
+	}
+}
+
+// NewRequestOptions applies the options.
+func NewRequestOptions(opts ...RequestOption) *RequestOptions {
+	options := &RequestOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// Has returns if the option is set.
+func (o *RequestOptions) Has(opt Option) bool {
+	return o.set&opt != 0
+}
+
+// Check returns ErrUnsupportedOption if any option set is not supported, or the value of an option is invalid.
+func (o *RequestOptions) Check(supported Option) error {
+	if unsupported := o.set &^ supported; unsupported != 0 {
+		return fmt.Errorf("%w: %s", ErrUnsupportedOption, unsupported)
+	}
+	if o.Has(OptionSetMode) && o.SetMode != SetModeNormal && o.SetMode != SetModeReset {
+		return fmt.Errorf("%w: set mode %q", ErrUnsupportedOption, o.SetMode)
+	}
+	if o.Has(OptionTTL) && o.TTL < 0 {
+		return fmt.Errorf("%w: negative ttl %v", ErrUnsupportedOption, o.TTL)
+	}
+	if o.Has(OptionRange) && (o.Offset < 0 || o.Length < 0) {
+		return fmt.Errorf("%w: negative range %d+%d", ErrUnsupportedOption, o.Offset, o.Length)
+	}
+	return nil
+}
+
+// Args returns the options as positional arguments of Client.EcSet and Client.EcGet: the dry run, the placements,
+// and the set mode, which is the convention of InfiniStore clients.
+func (o *RequestOptions) Args() []interface{} {
+	args := make([]interface{}, 0, 3)
+	if o.Has(OptionPlacements) || o.Has(OptionSetMode) {
+		args = append(args, o.DryRun, o.Placements)
+		if o.Has(OptionSetMode) {
+			args = append(args, o.SetMode)
+		}
+	} else if o.Has(OptionDryRun) {
+		args = append(args, o.DryRun)
+	}
+	return args
+}
+
+// OptionsFromArgs converts positional arguments of Client.EcSet and Client.EcGet to options. See RequestOptions.Args.
+func OptionsFromArgs(args ...interface{}) ([]RequestOption, error) {
+	opts := make([]RequestOption, 0, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case int:
+			if i != 0 {
+				return nil, fmt.Errorf("%w: argument %d of %T", ErrUnsupportedOption, i, arg)
+			}
+			opts = append(opts, WithDryRun(v))
+		case []int:
+			if i != 1 {
+				return nil, fmt.Errorf("%w: argument %d of %T", ErrUnsupportedOption, i, arg)
+			} else if v != nil {
+				opts = append(opts, WithPlacements(v))
+			}
+		case string:
+			if i != 2 {
+				return nil, fmt.Errorf("%w: argument %d of %T", ErrUnsupportedOption, i, arg)
+			}
+			opts = append(opts, WithSetMode(v))
+		default:
+			return nil, fmt.Errorf("%w: argument %d of %T", ErrUnsupportedOption, i, arg)
+		}
+	}
+	return opts, nil
+}
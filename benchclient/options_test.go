@@ -0,0 +1,127 @@
+package benchclient
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOptionString(t *testing.T) {
+	for _, c := range []struct {
+		opt    Option
+		expect string
+	}{
+		{0, ""},
+		{OptionTTL, "ttl"},
+		{OptionDryRun | OptionSetMode | OptionRange, "dry run, set mode, range"},
+	} {
+		if s := c.opt.String(); s != c.expect {
+			t.Errorf("%d: expect %q, got %q", c.opt, c.expect, s)
+		}
+	}
+}
+
+func TestRequestOptions(t *testing.T) {
+	opts := NewRequestOptions(WithDryRun(0), WithTTL(time.Minute), WithRange(10, 20))
+	if opts.Has(OptionDryRun) || !opts.Has(OptionTTL) || !opts.Has(OptionRange) || opts.TTL != time.Minute || opts.Offset != 10 || opts.Length != 20 {
+		t.Fatalf("unexpected options %+v", opts)
+	}
+
+	for _, c := range []struct {
+		opts      []RequestOption
+		supported Option
+		ok        bool
+	}{
+		{nil, 0, true},
+		{[]RequestOption{WithDryRun(2)}, OptionDryRun, true},
+		{[]RequestOption{WithDryRun(2)}, OptionRange, false},
+		{[]RequestOption{WithTTL(time.Second), WithRange(0, 0)}, OptionTTL, false},
+		{[]RequestOption{WithSetMode(SetModeReset)}, OptionSetMode, true},
+		{[]RequestOption{WithSetMode("Bogus")}, OptionSetMode, false},
+		{[]RequestOption{WithTTL(-time.Second)}, OptionTTL, false},
+		{[]RequestOption{WithRange(-1, 0)}, OptionRange, false},
+		{[]RequestOption{WithRange(0, -1)}, OptionRange, false},
+	} {
+		err := NewRequestOptions(c.opts...).Check(c.supported)
+		if c.ok && err != nil {
+			t.Errorf("%+v: unexpected error %v", NewRequestOptions(c.opts...), err)
+		} else if !c.ok && !errors.Is(err, ErrUnsupportedOption) {
+			t.Errorf("%+v: expect %v, got %v", NewRequestOptions(c.opts...), ErrUnsupportedOption, err)
+		}
+	}
+}
+
+func TestArgs(t *testing.T) {
+	placements := []int{1, 2}
+	for _, c := range []struct {
+		opts   []RequestOption
+		expect []interface{}
+	}{
+		{nil, []interface{}{}},
+		{[]RequestOption{WithTTL(time.Second)}, []interface{}{}},
+		{[]RequestOption{WithDryRun(3)}, []interface{}{3}},
+		{[]RequestOption{WithPlacements(placements)}, []interface{}{0, placements}},
+		{[]RequestOption{WithDryRun(3), WithSetMode(SetModeReset)}, []interface{}{3, []int(nil), SetModeReset}},
+	} {
+		args := NewRequestOptions(c.opts...).Args()
+		if !reflect.DeepEqual(args, c.expect) {
+			t.Errorf("expect arguments %v, got %v", c.expect, args)
+			continue
+		}
+
+		// Arguments convert back to the options.
+		opts, err := OptionsFromArgs(args...)
+		if err != nil {
+			t.Fatal(err)
+		} else if again := NewRequestOptions(opts...).Args(); !reflect.DeepEqual(again, args) {
+			t.Errorf("expect arguments %v, got %v", args, again)
+		}
+	}
+
+	for _, args := range [][]interface{}{{"Normal"}, {0, 1}, {[]int{1}}, {0, nil, 1}, {0, nil, SetModeNormal, 1}, {int64(1)}} {
+		if _, err := OptionsFromArgs(args...); !errors.Is(err, ErrUnsupportedOption) {
+			t.Errorf("%v: expect %v, got %v", args, ErrUnsupportedOption, err)
+		}
+	}
+}
+
+func TestDummyOptions(t *testing.T) {
+	cli := NewDummyWithStorage(NewDummyStorage(0, nil), &DummyOptions{Type: DummyStore})
+	if set, get := cli.SupportedOptions(); set != OptionDryRun|OptionSetMode || get != OptionDryRun|OptionRange {
+		t.Fatalf("unexpected supported options %s and %s", set, get)
+	}
+
+	ctx := context.Background()
+	if _, err := cli.EcSetContext(ctx, "key", make([]byte, 100), WithTTL(time.Second)); !errors.Is(err, ErrUnsupportedOption) {
+		t.Fatalf("expect %v, got %v", ErrUnsupportedOption, err)
+	} else if _, err := cli.EcSet("key", make([]byte, 100), 1); err != nil || cli.Storage().Stats().Objects != 0 {
+		t.Fatalf("expect the dry run to set nothing, got %v", err)
+	} else if _, err := cli.EcSet("key", make([]byte, 100), 0, []int(nil), "Bogus"); !errors.Is(err, ErrUnsupportedOption) {
+		t.Fatalf("expect %v, got %v", ErrUnsupportedOption, err)
+	} else if _, err := cli.EcSet("key", make([]byte, 100), 0, []int(nil), SetModeNormal); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		offset, length int64
+		expect         int
+	}{
+		{0, 0, 100},
+		{10, 0, 90},
+		{10, 20, 20},
+		{90, 20, 10},
+		{200, 0, 0},
+	} {
+		_, reader, err := cli.EcGetContext(ctx, "key", WithRange(c.offset, c.length))
+		if err != nil {
+			t.Fatal(err)
+		} else if reader.Len() != c.expect {
+			t.Errorf("range %d+%d: expect %d bytes, got %d", c.offset, c.length, c.expect, reader.Len())
+		}
+	}
+	if _, reader, err := cli.EcGetContext(ctx, "key", WithDryRun(1)); err != nil || reader != nil {
+		t.Fatalf("expect the dry run to read nothing, got %v, %v", reader, err)
+	}
+}
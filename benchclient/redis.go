@@ -71,7 +71,12 @@ func NewRedisWithBackend(backend redis.UniversalClient) *Redis {
 	}
 	client.setter = client.set
 	client.getter = client.get
+	client.msetter = client.mset
+	client.mgetter = client.mget
+	client.deleter = client.del
 	client.abbr = "ec"
+	client.setOpts = OptionTTL
+	client.getOpts = OptionRange
 	return client
 }
 
@@ -80,6 +85,8 @@ func NewRedis(addr string) *Redis {
 		Addr:     addr,
 		Password: "", // no password set
 		PoolSize: PoolSize,
+		// Builtin retries are hidden from results, see WithRetry.
+		MaxRetries: -1,
 	})
 	return NewRedisWithBackend(backend)
 }
@@ -89,6 +96,7 @@ func NewRedisClusterByAddresses(addrs []string, numSlots int) *Redis {
 		ClusterSlots:  GenRedisClusterSlotsProviderByAddresses(addrs, numSlots),
 		RouteRandomly: true,
 		PoolSize:      PoolSize,
+		MaxRetries:    -1,
 	})
 	return NewRedisWithBackend(backend)
 }
@@ -98,16 +106,21 @@ func NewElasticCache(addrPattern string, nodes int, numSlots int) *Redis {
 		ClusterSlots:  GenElasticCacheClusterSlotsProvider(addrPattern, nodes, numSlots),
 		RouteRandomly: true,
 		PoolSize:      PoolSize,
+		MaxRetries:    -1,
 	})
 	return NewRedisWithBackend(backend)
 }
 
-func (r *Redis) set(key string, val []byte) (err error) {
-	return r.backend.Set(context.Background(), key, val, 0).Err()
+func (r *Redis) set(ctx context.Context, key string, val []byte, opts *RequestOptions) (err error) {
+	return r.backend.Set(ctx, key, val, opts.TTL).Err()
 }
 
-func (r *Redis) get(key string) (infinistore.ReadAllCloser, error) {
-	val, err := r.backend.Get(context.Background(), key).Bytes()
+func (r *Redis) get(ctx context.Context, key string, opts *RequestOptions) (infinistore.ReadAllCloser, error) {
+	if opts.Has(OptionRange) {
+		return r.getRange(ctx, key, opts.Offset, opts.Length)
+	}
+
+	val, err := r.backend.Get(ctx, key).Bytes()
 	if err == redis.Nil {
 		return nil, infinistore.ErrNotFound
 	} else if err != nil {
@@ -117,6 +130,72 @@ func (r *Redis) get(key string) (infinistore.ReadAllCloser, error) {
 	}
 }
 
+// getRange gets the range of the key. GETRANGE returns an empty string for missing keys, so the existence is
+// checked in the same pipeline.
+func (r *Redis) getRange(ctx context.Context, key string, offset int64, length int64) (infinistore.ReadAllCloser, error) {
+	end := int64(-1)
+	if length > 0 {
+		end = offset + length - 1
+	}
+	pipe := r.backend.Pipeline()
+	exists := pipe.Exists(ctx, key)
+	val := pipe.GetRange(ctx, key, offset, end)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	} else if exists.Val() == 0 {
+		return nil, infinistore.ErrNotFound
+	}
+	return NewByteReader([]byte(val.Val())), nil
+}
+
+// mset sets keys in one pipeline.
+func (r *Redis) mset(ctx context.Context, keys []string, vals [][]byte) []error {
+	pipe := r.backend.Pipeline()
+	cmds := make([]*redis.StatusCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.Set(ctx, key, vals[i], 0)
+	}
+	pipe.Exec(ctx) // Errors are checked per command.
+
+	errs := make([]error, len(keys))
+	for i, cmd := range cmds {
+		errs[i] = cmd.Err()
+	}
+	return errs
+}
+
+// mget gets keys in one pipeline.
+func (r *Redis) mget(ctx context.Context, keys []string) ([]infinistore.ReadAllCloser, []error) {
+	pipe := r.backend.Pipeline()
+	cmds := make([]*redis.StringCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.Get(ctx, key)
+	}
+	pipe.Exec(ctx) // Errors are checked per command.
+
+	readers := make([]infinistore.ReadAllCloser, len(keys))
+	errs := make([]error, len(keys))
+	for i, cmd := range cmds {
+		val, err := cmd.Bytes()
+		if err == redis.Nil {
+			errs[i] = infinistore.ErrNotFound
+		} else if err != nil {
+			errs[i] = err
+		} else {
+			readers[i] = NewByteReader(val)
+		}
+	}
+	return readers, errs
+}
+
+func (r *Redis) del(ctx context.Context, key string) error {
+	n, err := r.backend.Del(ctx, key).Result()
+	if err == nil && n == 0 {
+		return infinistore.ErrNotFound
+	}
+	return err
+}
+
 func (r *Redis) Close() {
 	if r.backend != nil {
 		r.backend.Close()
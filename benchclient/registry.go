@@ -0,0 +1,360 @@
+package benchclient
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	infinistore "github.com/ds2-lab/infinistore/client"
+	"github.com/dustin/go-humanize"
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	ErrInvalidDSN = errors.New("invalid DSN")
+)
+
+// Constructor creates a client of a backend.
+type Constructor func() Client
+
+// Factory parses and validates the DSN of a backend once, and returns the constructor of clients of the backend.
+type Factory func(dsn *url.URL) (Constructor, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+func init() {
+	Register("infinistore", infinistoreFactory)
+	Register("redis", redisFactory)
+	Register("rediscluster", redisClusterFactory)
+	Register("elasticache", redisClusterFactory)
+	Register("s3", s3Factory)
+	Register("file", fileFactory)
+	Register("efs", fileFactory)
+	Register("fsx", fileFactory)
+	Register("dummy", dummyFactory)
+}
+
+// Register makes a backend available by the scheme of DSNs. Schemes are case-insensitive.
+// It panics if the scheme is registered twice or the factory is nil.
+func Register(scheme string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	scheme = strings.ToLower(scheme)
+	if factory == nil {
+		panic("benchclient: Register factory is nil")
+	} else if _, dup := registry[scheme]; dup {
+		panic("benchclient: Register called twice for scheme " + scheme)
+	}
+	registry[scheme] = factory
+}
+
+// Schemes returns registered schemes in sorted order.
+func Schemes() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	schemes := make([]string, 0, len(registry))
+	for scheme := range registry {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// NewConstructor returns the constructor of clients of the backend specified by the DSN. Builtin backends are:
+//
+//	infinistore://host:6378,host:6378?d=10&p=2&g=32   Set dial=false to skip dialing, e.g. in dry runs.
+//	redis://[:password@]host:6379[/db]?pool=4           Set retries=3 to enable builtin retries of go-redis.
+//	rediscluster://host:6379,host:6379?slots=16384&pool=4&retries=3
+//	rediscluster://node-%25d.example.com:6379?nodes=12   Hosts from the pattern, numbered from 1.
+//	elasticache://...                                    Alias of rediscluster.
+//	s3://bucket?region=us-east-1&endpoint=http://localhost:9000
+//	file:///mnt/efs, efs:///mnt/efs, or fsx:///mnt/fsx   Relative paths are written as file://dir.
+//	file:///mnt/efs?layout=hash&depth=2&fsync=true     Layout "nested", "hash", or "escape". Also direct=true and stream=true.
+//	dummy://?bw=100MiB&type=ds                           Bandwidth per second, 0 for unlimited. Type "dc" misses like a cache.
+//	dummy://?cap=1GiB&evict=lfu&overhead=1ms&jitter=500us  Capacity with eviction "lru", "lfu", or "fifo", and latency.
+//	dummy://?ns=run1                                     Clients of DSNs of the same ns, cap and evict share objects.
+func NewConstructor(dsn string) (Constructor, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDSN, err)
+	} else if u.Scheme == "" {
+		return nil, fmt.Errorf("%w: no scheme in %s", ErrInvalidDSN, dsn)
+	}
+	registryMu.RLock()
+	factory, ok := registry[strings.ToLower(u.Scheme)]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown scheme %s, registered: %s", ErrInvalidDSN, u.Scheme, strings.Join(Schemes(), ", "))
+	}
+	construct, err := factory(u)
+	if err != nil {
+		if _, ok := u.User.Password(); ok {
+			dsn = u.Redacted()
+		}
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidDSN, dsn, err)
+	}
+	return construct, nil
+}
+
+// Open creates a client of the backend specified by the DSN. See NewConstructor for builtin backends.
+func Open(dsn string) (Client, error) {
+	construct, err := NewConstructor(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return construct(), nil
+}
+
+// dsnParams reads typed query parameters of a DSN. The first error is kept.
+type dsnParams struct {
+	query url.Values
+	err   error
+}
+
+func newDSNParams(u *url.URL) *dsnParams {
+	return &dsnParams{query: u.Query()}
+}
+
+func (p *dsnParams) String(name string, def string) string {
+	if v := p.query.Get(name); v != "" {
+		return v
+	}
+	return def
+}
+
+func (p *dsnParams) Int(name string, def int) int {
+	v := p.query.Get(name)
+	if v == "" {
+		return def
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil && p.err == nil {
+		p.err = fmt.Errorf("%s: %v", name, err)
+	}
+	return i
+}
+
+func (p *dsnParams) Bool(name string, def bool) bool {
+	v := p.query.Get(name)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil && p.err == nil {
+		p.err = fmt.Errorf("%s: %v", name, err)
+	}
+	return b
+}
+
+// Bytes reads a size like "100MiB" or "1048576".
+func (p *dsnParams) Bytes(name string, def uint64) uint64 {
+	v := p.query.Get(name)
+	if v == "" {
+		return def
+	}
+	b, err := humanize.ParseBytes(v)
+	if err != nil && p.err == nil {
+		p.err = fmt.Errorf("%s: %v", name, err)
+	}
+	return b
+}
+
+// Duration reads a duration like "1ms".
+func (p *dsnParams) Duration(name string, def time.Duration) time.Duration {
+	v := p.query.Get(name)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil && p.err == nil {
+		p.err = fmt.Errorf("%s: %v", name, err)
+	}
+	return d
+}
+
+// hosts returns the comma separated hosts of the DSN.
+func hosts(u *url.URL) ([]string, error) {
+	if u.Host == "" {
+		return nil, errors.New("no host")
+	}
+	return strings.Split(u.Host, ","), nil
+}
+
+func infinistoreFactory(u *url.URL) (Constructor, error) {
+	addrs, err := hosts(u)
+	if err != nil {
+		return nil, err
+	}
+	params := newDSNParams(u)
+	d, p, g, dial := params.Int("d", 10), params.Int("p", 2), params.Int("g", 32), params.Bool("dial", true)
+	if params.err != nil {
+		return nil, params.err
+	}
+	return func() Client {
+		cli := infinistore.NewClient(d, p, g)
+		if dial {
+			cli.Dial(addrs)
+		}
+		return cli
+	}, nil
+}
+
+func redisFactory(u *url.URL) (Constructor, error) {
+	if u.Host == "" {
+		return nil, errors.New("no host")
+	}
+	params := newDSNParams(u)
+	opts := &redis.Options{Addr: u.Host, PoolSize: params.Int("pool", PoolSize), MaxRetries: redisRetries(params)}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		var err error
+		if opts.DB, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("db: %v", err)
+		}
+	}
+	if u.User != nil {
+		opts.Username = u.User.Username()
+		opts.Password, _ = u.User.Password()
+	}
+	if params.err != nil {
+		return nil, params.err
+	}
+	return func() Client {
+		options := *opts
+		return NewRedisWithBackend(redis.NewClient(&options))
+	}, nil
+}
+
+// redisRetries returns MaxRetries of go-redis. Builtin retries are disabled by default, which are hidden from
+// results, and 0 retries of go-redis means 3. Use WithRetry to measure retries.
+func redisRetries(params *dsnParams) int {
+	if retries := params.Int("retries", 0); retries > 0 {
+		return retries
+	}
+	return -1
+}
+
+func redisClusterFactory(u *url.URL) (Constructor, error) {
+	addrs, err := hosts(u)
+	if err != nil {
+		return nil, err
+	}
+	params := newDSNParams(u)
+	slots, nodes, pool := params.Int("slots", 0), params.Int("nodes", 0), params.Int("pool", PoolSize)
+	retries := redisRetries(params)
+	if params.err != nil {
+		return nil, params.err
+	}
+	provider := GenRedisClusterSlotsProviderByAddresses
+	if nodes > 0 {
+		if len(addrs) != 1 || !strings.Contains(addrs[0], "%d") {
+			return nil, errors.New("nodes requires one host pattern with %d")
+		}
+		provider = func(_ []string, numSlots int) RedisClusterSlotsProvider {
+			return GenElasticCacheClusterSlotsProvider(u.Host, nodes, numSlots)
+		}
+	}
+	return func() Client {
+		return NewRedisWithBackend(redis.NewClusterClient(&redis.ClusterOptions{
+			ClusterSlots:  provider(addrs, slots),
+			RouteRandomly: true,
+			PoolSize:      pool,
+			MaxRetries:    retries,
+		}))
+	}, nil
+}
+
+var (
+	s3SessionsMu sync.Mutex
+	s3Sessions   = make(map[string]*session.Session)
+)
+
+func s3Factory(u *url.URL) (Constructor, error) {
+	if u.Host == "" {
+		return nil, errors.New("no bucket")
+	}
+	bucket := u.Host
+	params := newDSNParams(u)
+	region, endpoint := params.String("region", ""), params.String("endpoint", "")
+	if region == "" && endpoint == "" {
+		return func() Client { return NewS3(bucket) }, nil
+	}
+
+	// Clients of the same region and endpoint share the session.
+	s3SessionsMu.Lock()
+	defer s3SessionsMu.Unlock()
+	key := region + "|" + endpoint
+	sess, ok := s3Sessions[key]
+	if !ok {
+		config := aws.Config{Region: aws.String(region)}
+		if region == "" {
+			config.Region = AWSSession.Config.Region
+		}
+		if endpoint != "" {
+			// Endpoints like MinIO serve buckets in paths.
+			config.Endpoint = aws.String(endpoint)
+			config.S3ForcePathStyle = aws.Bool(true)
+		}
+		var err error
+		sess, err = session.NewSessionWithOptions(session.Options{SharedConfigState: session.SharedConfigEnable, Config: config})
+		if err != nil {
+			return nil, err
+		}
+		s3Sessions[key] = sess
+	}
+	return func() Client { return NewS3WithSession(bucket, sess) }, nil
+}
+
+func fileFactory(u *url.URL) (Constructor, error) {
+	base := u.Host + u.Path
+	if base == "" {
+		return nil, errors.New("no path")
+	}
+	params := newDSNParams(u)
+	opts := &FileOptions{
+		Layout: strings.ToLower(params.String("layout", FileLayoutNested)),
+		Depth:  params.Int("depth", 0),
+		Fsync:  params.Bool("fsync", false),
+		Direct: params.Bool("direct", false),
+		Stream: params.Bool("stream", false),
+	}
+	if params.err != nil {
+		return nil, params.err
+	} else if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	provider := strings.ToLower(u.Scheme)
+	return func() Client { return NewFileWithOptions(provider, base, opts) }, nil
+}
+
+func dummyFactory(u *url.URL) (Constructor, error) {
+	params := newDSNParams(u)
+	opts := &DummyOptions{
+		Type:      params.String("type", DummyStore),
+		Bandwidth: int64(params.Bytes("bw", 0)),
+		Overhead:  params.Duration("overhead", 0),
+		Jitter:    params.Duration("jitter", 0),
+	}
+	capacity := params.Bytes("cap", 0)
+	if params.err != nil {
+		return nil, params.err
+	} else if opts.Type != DummyStore && opts.Type != DummyCache {
+		return nil, fmt.Errorf("type: unsupported %s", opts.Type)
+	} else if opts.Overhead < 0 || opts.Jitter < 0 {
+		return nil, errors.New("negative overhead or jitter")
+	}
+	storage, err := sharedDummyStorage(params.String("ns", ""), int64(capacity), strings.ToLower(params.String("evict", EvictLRU)))
+	if err != nil {
+		return nil, fmt.Errorf("evict: %v", err)
+	}
+	return func() Client { return NewDummyWithStorage(storage, opts) }, nil
+}
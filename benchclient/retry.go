@@ -0,0 +1,287 @@
+package benchclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+
+	infinistore "github.com/ds2-lab/infinistore/client"
+	"github.com/ds2-lab/infinistore/common/logger"
+)
+
+var (
+	// DefaultRetryOn retries failed and timed out requests. Not-found requests are final.
+	DefaultRetryOn = []int{ResultError, ResultTimeout}
+
+	resultNames = map[string]int{
+		"error":    ResultError,
+		"notfound": ResultNotFound,
+		"timeout":  ResultTimeout,
+	}
+)
+
+// RetryPolicy decides whether and when a request is retried by clients of WithRetry.
+// Clients adapted by WithContext send the next attempt after the abandoned one completes, so their attempts may
+// take longer than AttemptTimeout.
+type RetryPolicy struct {
+	MaxAttempts    int           // Attempts of a request including the first one, 1 or less for no retry.
+	Backoff        time.Duration // Backoff before the first retry.
+	MaxBackoff     time.Duration // Cap of backoffs, 0 for no cap.
+	Multiplier     float64       // Growth of backoffs per retry, 2 if 0.
+	Jitter         float64       // Fraction of each backoff randomized in [0, 1], 1 for full jitter.
+	RetryOn        []int         // Results to retry, DefaultRetryOn if nil.
+	AttemptTimeout time.Duration // Deadline of each attempt, 0 for the deadline of the request only.
+}
+
+// ParseRetryOn parses a comma-separated list of results to retry, support "error", "notfound", and "timeout."
+func ParseRetryOn(spec string) ([]int, error) {
+	var results []int
+	for _, name := range strings.Split(spec, ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name == "" {
+			continue
+		}
+		result, ok := resultNames[strings.ReplaceAll(name, "-", "")]
+		if !ok {
+			return nil, fmt.Errorf("unknown result to retry: %s", name)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// Validate returns an error if the policy is invalid.
+func (p *RetryPolicy) Validate() error {
+	if p.Backoff < 0 || p.MaxBackoff < 0 || p.AttemptTimeout < 0 {
+		return errors.New("negative backoff or attempt timeout")
+	} else if p.Multiplier != 0 && p.Multiplier < 1 {
+		return fmt.Errorf("backoff multiplier %v is less than 1", p.Multiplier)
+	} else if p.Jitter < 0 || p.Jitter > 1 {
+		return fmt.Errorf("jitter %v is not in [0, 1]", p.Jitter)
+	}
+	return nil
+}
+
+// Retries returns if a request that failed with the error is retried. Canceled requests and requests with
+// unsupported options are never retried.
+func (p *RetryPolicy) Retries(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, ErrUnsupportedOption) || errors.Is(err, ErrNotSupported) {
+		return false
+	}
+	retryOn := p.RetryOn
+	if retryOn == nil {
+		retryOn = DefaultRetryOn
+	}
+	result := ResultFromError(err)
+	for _, r := range retryOn {
+		if r == result {
+			return true
+		}
+	}
+	return false
+}
+
+// Delay returns the backoff before the retry, which is 1 for the first retry. Backoffs grow exponentially by the
+// multiplier up to the cap, and the jitter fraction of each backoff is randomized.
+func (p *RetryPolicy) Delay(retry int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier == 0 {
+		multiplier = 2
+	}
+	delay := float64(p.Backoff) * math.Pow(multiplier, float64(retry-1))
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		delay = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		delay -= delay * p.Jitter * rand.Float64()
+	}
+	return time.Duration(delay)
+}
+
+// Attempt describes one attempt of a request, reported to the observer of WithRetry.
+type Attempt struct {
+	Op       string // "set" or "get".
+	Key      string
+	Index    int           // Index of the key in a batch, 0 for single requests.
+	Attempt  int           // 1 for the first attempt.
+	Start    time.Time     // Requests in a batch share the start and duration of the attempt.
+	Duration time.Duration // Excluding the backoff before the attempt.
+	Err      error
+	Retry    bool // Whether the request will be retried.
+}
+
+// WithRetry returns the client that retries requests by the policy. Each attempt is reported to the observer,
+// if set, in the goroutine of the request, so that the cost of retries can be measured. Attempts are logged by
+// the client as separate requests.
+// The context of a request bounds all attempts and backoffs, and the error of the last attempt is returned.
+// Batch requests retry failed keys only.
+func WithRetry(cli Client, policy *RetryPolicy, observer func(*Attempt)) ContextClient {
+	ctxCli := WithContext(cli)
+	retry := &retryClient{
+		ContextClient: ctxCli,
+		policy:        policy,
+		observer:      observer,
+		log: &logger.ColorLogger{
+			Verbose: true,
+			Level:   logger.LOG_LEVEL_ALL,
+			Color:   true,
+			Prefix:  "Retry: ",
+		},
+	}
+	if batch, ok := ctxCli.(ContextBatchClient); ok {
+		return &retryBatchClient{retryClient: retry, batch: batch}
+	}
+	return retry
+}
+
+type retryClient struct {
+	ContextClient
+	policy   *RetryPolicy
+	observer func(*Attempt)
+	log      logger.ILogger
+}
+
+func (c *retryClient) EcSet(key string, val []byte, args ...interface{}) (string, error) {
+	opts, err := OptionsFromArgs(args...)
+	if err != nil {
+		return "", err
+	}
+	return c.EcSetContext(context.Background(), key, val, opts...)
+}
+
+func (c *retryClient) EcSetContext(ctx context.Context, key string, val []byte, opts ...RequestOption) (string, error) {
+	var reqId string
+	errs := make([]error, 1)
+	c.retry(ctx, "set", []string{key}, errs, func(ctx context.Context, _ []int) {
+		reqId, errs[0] = c.ContextClient.EcSetContext(ctx, key, val, opts...)
+	})
+	return reqId, errs[0]
+}
+
+func (c *retryClient) EcGet(key string, args ...interface{}) (string, infinistore.ReadAllCloser, error) {
+	opts, err := OptionsFromArgs(args...)
+	if err != nil {
+		return "", nil, err
+	}
+	return c.EcGetContext(context.Background(), key, opts...)
+}
+
+func (c *retryClient) EcGetContext(ctx context.Context, key string, opts ...RequestOption) (string, infinistore.ReadAllCloser, error) {
+	var reqId string
+	var reader infinistore.ReadAllCloser
+	errs := make([]error, 1)
+	c.retry(ctx, "get", []string{key}, errs, func(ctx context.Context, _ []int) {
+		reqId, reader, errs[0] = c.ContextClient.EcGetContext(ctx, key, opts...)
+	})
+	return reqId, reader, errs[0]
+}
+
+// retry sends attempts of the requests of keys until all requests succeed, or are not to be retried. The attempt
+// sends requests of the pending indexes of keys and sets their errors.
+func (c *retryClient) retry(ctx context.Context, op string, keys []string, errs []error, attempt func(context.Context, []int)) {
+	pending := make([]int, len(keys))
+	for i := range pending {
+		pending[i] = i
+	}
+	for n := 1; ; n++ {
+		actx, cancel := ctx, context.CancelFunc(func() {})
+		if c.policy.AttemptTimeout > 0 {
+			actx, cancel = context.WithTimeout(ctx, c.policy.AttemptTimeout)
+		}
+		start := time.Now()
+		attempt(actx, pending)
+		duration := time.Since(start)
+		cancel()
+
+		retrying := pending[:0]
+		for _, i := range pending {
+			retry := n < c.policy.MaxAttempts && ctx.Err() == nil && c.policy.Retries(errs[i])
+			if c.observer != nil {
+				c.observer(&Attempt{Op: op, Key: keys[i], Index: i, Attempt: n, Start: start, Duration: duration, Err: errs[i], Retry: retry})
+			}
+			if retry {
+				retrying = append(retrying, i)
+			}
+		}
+		if len(retrying) == 0 {
+			return
+		}
+		pending = retrying
+
+		delay := c.policy.Delay(n)
+		c.log.Warn("Retry %d %s request(s) in %v, attempt %d failed: %v", len(pending), op, delay, n, errs[pending[0]])
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			// The request runs out of time during the backoff.
+			timer.Stop()
+			for _, i := range pending {
+				errs[i] = ctx.Err()
+			}
+			return
+		}
+	}
+}
+
+type retryBatchClient struct {
+	*retryClient
+	batch ContextBatchClient
+}
+
+func (c *retryBatchClient) EcMSet(keys []string, vals [][]byte) ([]string, []error) {
+	return c.EcMSetContext(context.Background(), keys, vals)
+}
+
+func (c *retryBatchClient) EcMSetContext(ctx context.Context, keys []string, vals [][]byte) ([]string, []error) {
+	reqIds := make([]string, len(keys))
+	errs := make([]error, len(keys))
+	c.retry(ctx, "set", keys, errs, func(ctx context.Context, pending []int) {
+		if len(pending) == len(keys) {
+			subReqIds, subErrs := c.batch.EcMSetContext(ctx, keys, vals)
+			copy(reqIds, subReqIds)
+			copy(errs, subErrs)
+			return
+		}
+		subKeys, subVals := make([]string, len(pending)), make([][]byte, len(pending))
+		for j, i := range pending {
+			subKeys[j], subVals[j] = keys[i], vals[i]
+		}
+		subReqIds, subErrs := c.batch.EcMSetContext(ctx, subKeys, subVals)
+		for j, i := range pending {
+			reqIds[i], errs[i] = subReqIds[j], subErrs[j]
+		}
+	})
+	return reqIds, errs
+}
+
+func (c *retryBatchClient) EcMGet(keys []string) ([]string, []infinistore.ReadAllCloser, []error) {
+	return c.EcMGetContext(context.Background(), keys)
+}
+
+func (c *retryBatchClient) EcMGetContext(ctx context.Context, keys []string) ([]string, []infinistore.ReadAllCloser, []error) {
+	reqIds := make([]string, len(keys))
+	readers := make([]infinistore.ReadAllCloser, len(keys))
+	errs := make([]error, len(keys))
+	c.retry(ctx, "get", keys, errs, func(ctx context.Context, pending []int) {
+		if len(pending) == len(keys) {
+			subReqIds, subReaders, subErrs := c.batch.EcMGetContext(ctx, keys)
+			copy(reqIds, subReqIds)
+			copy(readers, subReaders)
+			copy(errs, subErrs)
+			return
+		}
+		subKeys := make([]string, len(pending))
+		for j, i := range pending {
+			subKeys[j] = keys[i]
+		}
+		subReqIds, subReaders, subErrs := c.batch.EcMGetContext(ctx, subKeys)
+		for j, i := range pending {
+			reqIds[i], readers[i], errs[i] = subReqIds[j], subReaders[j], subErrs[j]
+		}
+	})
+	return reqIds, readers, errs
+}
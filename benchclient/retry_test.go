@@ -0,0 +1,244 @@
+package benchclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	infinistore "github.com/ds2-lab/infinistore/client"
+)
+
+func TestParseRetryOn(t *testing.T) {
+	if retryOn, err := ParseRetryOn(" Error, not-found,timeout,"); err != nil {
+		t.Fatal(err)
+	} else if expect := []int{ResultError, ResultNotFound, ResultTimeout}; !reflect.DeepEqual(retryOn, expect) {
+		t.Fatalf("expect %v, got %v", expect, retryOn)
+	}
+	if retryOn, err := ParseRetryOn(""); err != nil || retryOn != nil {
+		t.Fatalf("expect nothing to retry, got %v, %v", retryOn, err)
+	}
+	if _, err := ParseRetryOn("error,crash"); err == nil {
+		t.Fatal("expect an error of the unknown result")
+	}
+}
+
+func TestRetryPolicyValidate(t *testing.T) {
+	for _, policy := range []RetryPolicy{
+		{Backoff: -time.Millisecond},
+		{MaxBackoff: -time.Millisecond},
+		{AttemptTimeout: -time.Millisecond},
+		{Multiplier: 0.5},
+		{Jitter: -0.1},
+		{Jitter: 1.1},
+	} {
+		if err := policy.Validate(); err == nil {
+			t.Errorf("%+v: expect an error", policy)
+		}
+	}
+	policy := RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, Multiplier: 1, Jitter: 1}
+	if err := policy.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := &RetryPolicy{Backoff: 10 * time.Millisecond, MaxBackoff: 200 * time.Millisecond, Multiplier: 3}
+	for retry, expect := range []time.Duration{10, 30, 90, 200, 200} {
+		if delay := policy.Delay(retry + 1); delay != expect*time.Millisecond {
+			t.Fatalf("retry %d: expect %v, got %v", retry+1, expect*time.Millisecond, delay)
+		}
+	}
+
+	// Backoffs double by default, without a cap.
+	policy = &RetryPolicy{Backoff: 10 * time.Millisecond}
+	if delay := policy.Delay(11); delay != 10240*time.Millisecond {
+		t.Fatalf("expect %v, got %v", 10240*time.Millisecond, delay)
+	}
+
+	// The jitter fraction of backoffs is randomized.
+	policy = &RetryPolicy{Backoff: 100 * time.Millisecond, Multiplier: 2, Jitter: 0.5}
+	var min, max time.Duration = time.Hour, 0
+	for i := 0; i < 1000; i++ {
+		delay := policy.Delay(2)
+		if delay < 100*time.Millisecond || delay > 200*time.Millisecond {
+			t.Fatalf("delay %v is not in [100ms, 200ms]", delay)
+		}
+		if delay < min {
+			min = delay
+		}
+		if delay > max {
+			max = delay
+		}
+	}
+	if max-min < 50*time.Millisecond {
+		t.Fatalf("delays in [%v, %v] are not randomized", min, max)
+	}
+}
+
+func TestRetryPolicyRetries(t *testing.T) {
+	cases := []struct {
+		err     error
+		retryOn []int
+		expect  bool
+	}{
+		{nil, nil, false},
+		{errors.New("failed"), nil, true},
+		{context.DeadlineExceeded, nil, true},
+		{fmt.Errorf("attempt: %w", context.DeadlineExceeded), nil, true},
+		{infinistore.ErrNotFound, nil, false},
+		{infinistore.ErrNotFound, []int{ResultNotFound}, true},
+		{fmt.Errorf("get: %w", infinistore.ErrNotFound), []int{ResultNotFound}, true},
+		{fmt.Errorf("get: %w", infinistore.ErrNotFound), []int{ResultError}, false},
+		{errors.New("failed"), []int{ResultTimeout}, false},
+		{context.Canceled, []int{ResultError, ResultTimeout}, false},
+		{fmt.Errorf("%w: ttl", ErrUnsupportedOption), nil, false},
+		{ErrNotSupported, nil, false},
+	}
+	for _, c := range cases {
+		policy := &RetryPolicy{MaxAttempts: 3, RetryOn: c.retryOn}
+		if retries := policy.Retries(c.err); retries != c.expect {
+			t.Errorf("%v of %v: expect %v, got %v", c.err, c.retryOn, c.expect, retries)
+		}
+	}
+}
+
+// flakyClient fails requests of keys for the number of times, and records keys of batches sent.
+type flakyClient struct {
+	*Dummy
+	mu      sync.Mutex
+	fails   map[string]int
+	batches [][]string
+}
+
+func newFlakyClient(fails map[string]int) *flakyClient {
+	return &flakyClient{Dummy: NewDummy(0, DummyStore), fails: fails}
+}
+
+func (c *flakyClient) fail(keys []string) []error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.batches = append(c.batches, append([]string(nil), keys...))
+	errs := make([]error, len(keys))
+	for i, key := range keys {
+		if c.fails[key] > 0 {
+			c.fails[key]--
+			errs[i] = fmt.Errorf("%s failed", key)
+		}
+	}
+	return errs
+}
+
+func (c *flakyClient) EcSetContext(ctx context.Context, key string, val []byte, opts ...RequestOption) (string, error) {
+	if err := c.fail([]string{key})[0]; err != nil {
+		return "", err
+	}
+	return c.Dummy.EcSetContext(ctx, key, val, opts...)
+}
+
+func (c *flakyClient) EcMSetContext(ctx context.Context, keys []string, vals [][]byte) ([]string, []error) {
+	errs := c.fail(keys)
+	reqIds, setErrs := c.Dummy.EcMSetContext(ctx, keys, vals)
+	for i := range errs {
+		if errs[i] == nil {
+			errs[i] = setErrs[i]
+		}
+	}
+	return reqIds, errs
+}
+
+func (c *flakyClient) EcMGetContext(ctx context.Context, keys []string) ([]string, []infinistore.ReadAllCloser, []error) {
+	errs := c.fail(keys)
+	reqIds, readers, getErrs := c.Dummy.EcMGetContext(ctx, keys)
+	for i := range errs {
+		if errs[i] == nil {
+			errs[i] = getErrs[i]
+		} else if readers[i] != nil {
+			readers[i].Close()
+			readers[i] = nil
+		}
+	}
+	return reqIds, readers, errs
+}
+
+func TestWithRetry(t *testing.T) {
+	flaky := newFlakyClient(map[string]int{"a": 2, "b": 5})
+	var attempts []*Attempt
+	policy := &RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+	cli := WithRetry(flaky, policy, func(attempt *Attempt) { attempts = append(attempts, attempt) })
+
+	if _, err := cli.EcSetContext(context.Background(), "a", []byte("value")); err != nil {
+		t.Fatalf("expect success on the third attempt, got %v", err)
+	} else if len(attempts) != 3 || !attempts[0].Retry || !attempts[1].Retry || attempts[2].Retry || attempts[2].Attempt != 3 {
+		t.Fatalf("unexpected attempts %+v", attempts)
+	}
+
+	// The error of the last attempt is returned.
+	attempts = nil
+	if _, err := cli.EcSet("b", []byte("value")); err == nil || err.Error() != "b failed" {
+		t.Fatalf("expect the error of the last attempt, got %v", err)
+	} else if len(attempts) != 3 || attempts[2].Retry {
+		t.Fatalf("unexpected attempts %+v", attempts)
+	}
+
+	// The deadline of the request bounds backoffs.
+	policy.Backoff = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := cli.EcSetContext(ctx, "b", []byte("value")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect %v, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestWithRetryBatch(t *testing.T) {
+	flaky := newFlakyClient(map[string]int{"b": 1, "d": 2, "e": 5})
+	var mu sync.Mutex
+	retried := make(map[string]int)
+	policy := &RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+	cli := WithRetry(flaky, policy, func(attempt *Attempt) {
+		mu.Lock()
+		defer mu.Unlock()
+		if attempt.Retry {
+			retried[attempt.Key]++
+		}
+	})
+	batch, ok := cli.(ContextBatchClient)
+	if !ok {
+		t.Fatal("batch clients are not retried in batches")
+	}
+
+	keys := []string{"a", "b", "c", "d", "e"}
+	vals := [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("d"), []byte("e")}
+	_, errs := batch.EcMSetContext(context.Background(), keys, vals)
+	for i, err := range errs {
+		if failed := keys[i] == "e"; (err != nil) != failed {
+			t.Fatalf("%s: unexpected error %v", keys[i], err)
+		}
+	}
+	// Retries send failed keys only.
+	expect := [][]string{keys, {"b", "d", "e"}, {"d", "e"}}
+	if !reflect.DeepEqual(flaky.batches, expect) {
+		t.Fatalf("expect batches %v, got %v", expect, flaky.batches)
+	} else if expect := map[string]int{"b": 1, "d": 2, "e": 2}; !reflect.DeepEqual(retried, expect) {
+		t.Fatalf("expect retries %v, got %v", expect, retried)
+	}
+
+	// Readers of keys are returned at their indexes.
+	flaky.batches = nil
+	flaky.fails["c"] = 1
+	_, readers, errs := batch.EcMGetContext(context.Background(), keys[:4])
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("%s: %v", keys[i], err)
+		} else if readers[i] == nil || readers[i].Len() != 1 {
+			t.Fatalf("%s: unexpected reader %v", keys[i], readers[i])
+		}
+		readers[i].Close()
+	}
+	if expect := [][]string{keys[:4], {"c"}}; !reflect.DeepEqual(flaky.batches, expect) {
+		t.Fatalf("expect batches %v, got %v", expect, flaky.batches)
+	}
+}
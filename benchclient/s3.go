@@ -2,8 +2,11 @@ package benchclient
 
 import (
 	"bytes"
+	"context"
+	"fmt"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
@@ -25,28 +28,38 @@ type S3 struct {
 	bucket     string
 	uploader   *s3manager.Uploader
 	downloader *s3manager.Downloader
+	service    *s3.S3
 }
 
 func NewS3(bk string) *S3 {
+	return NewS3WithSession(bk, AWSSession)
+}
+
+// NewS3WithSession returns a S3 client of the bucket using the session, e.g. of other regions or S3 compatible endpoints.
+func NewS3WithSession(bk string, sess *session.Session) *S3 {
 	client := &S3{
 		defaultClient: newDefaultClient("S3: "),
 		bucket:        bk,
-		uploader: s3manager.NewUploader(AWSSession, func(u *s3manager.Uploader) {
+		uploader: s3manager.NewUploader(sess, func(u *s3manager.Uploader) {
 			u.BufferProvider = uploadBufferProvider
 		}),
-		downloader: s3manager.NewDownloader(AWSSession, func(d *s3manager.Downloader) {
+		downloader: s3manager.NewDownloader(sess, func(d *s3manager.Downloader) {
 			d.BufferProvider = downloadBufferProvider
 		}),
+		service: s3.New(sess),
 	}
 	client.setter = client.set
 	client.getter = client.get
+	client.deleter = client.del
 	client.abbr = "s3"
+	client.getOpts = OptionRange
 	return client
 }
 
-func (c *S3) set(key string, val []byte) error {
+// set uploads the object. S3 expires objects by lifecycle rules of buckets, so TTLs are not supported.
+func (c *S3) set(ctx context.Context, key string, val []byte, opts *RequestOptions) error {
 	// Upload the file to S3.
-	_, err := c.uploader.Upload(&s3manager.UploadInput{
+	_, err := c.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
 		Bucket: aws.String(c.bucket),
 		Key:    aws.String(key),
 		Body:   bytes.NewReader(val),
@@ -54,15 +67,33 @@ func (c *S3) set(key string, val []byte) error {
 	return err
 }
 
-func (c *S3) get(key string) (infinistore.ReadAllCloser, error) {
+func (c *S3) get(ctx context.Context, key string, opts *RequestOptions) (infinistore.ReadAllCloser, error) {
 	buff := new(aws.WriteAtBuffer)
-	_, err := c.downloader.Download(buff, &s3.GetObjectInput{
+	input := &s3.GetObjectInput{
 		Bucket: aws.String(c.bucket),
 		Key:    aws.String(key),
-	})
-	if err != nil {
+	}
+	if opts.Has(OptionRange) {
+		if opts.Length > 0 {
+			input.Range = aws.String(fmt.Sprintf("bytes=%d-%d", opts.Offset, opts.Offset+opts.Length-1))
+		} else {
+			input.Range = aws.String(fmt.Sprintf("bytes=%d-", opts.Offset))
+		}
+	}
+	_, err := c.downloader.DownloadWithContext(ctx, buff, input)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+		return nil, infinistore.ErrNotFound
+	} else if err != nil {
 		return nil, err
 	} else {
 		return NewByteReader(buff.Bytes()), nil
 	}
 }
+
+func (c *S3) del(ctx context.Context, key string) error {
+	_, err := c.service.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(c.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
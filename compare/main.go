@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ds2-lab/infinibench/bench"
+)
+
+const (
+	EXIT_OK        = 0
+	EXIT_REGRESSED = 1
+	EXIT_ERROR     = 2
+)
+
+func main() {
+	var threshold string
+	var alpha float64
+	var format string
+	var jsonFile string
+	flag.StringVar(&threshold, "threshold", "", "Thresholds in the form of \"metric=value;...\" over the defaults, e.g. \"throughput=3;GET p99=5;max=20.\" \"none\" removes the threshold of the metric.")
+	flag.Float64Var(&alpha, "alpha", 0.05, "Significance level of tests on latency histograms. Latency changes that are not significant do not regress. 0 to skip tests.")
+	flag.StringVar(&format, "format", bench.TABLE_MARKDOWN, "Format of the diff table, support \"csv\", \"json\", and \"md.\"")
+	flag.StringVar(&jsonFile, "json", "", "Write the diff, including statistical tests, to the file in JSON format.")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ./compare [options] old.json new.json\n")
+		fmt.Fprintf(os.Stderr, "Compares two results of infinibench -json or playback -json, and exits with 1 if any metric regresses beyond its threshold.\n")
+		fmt.Fprintf(os.Stderr, "Changes of ratios are in percentage points, and changes of other metrics are relative in percent. Default thresholds:\n")
+		fmt.Fprintf(os.Stderr, "  %s\n", formatThresholds(bench.DefaultThresholds))
+		fmt.Fprintf(os.Stderr, "Available options:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(EXIT_ERROR)
+	}
+
+	thresholds, err := bench.ParseThresholds(threshold)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(EXIT_ERROR)
+	}
+	diff, err := bench.DiffFiles(flag.Arg(0), flag.Arg(1), thresholds, alpha)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to compare results: %v\n", err)
+		os.Exit(EXIT_ERROR)
+	}
+
+	if err := diff.WriteTable(os.Stdout, format); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write diff table: %v\n", err)
+		os.Exit(EXIT_ERROR)
+	}
+	if format != bench.TABLE_JSON {
+		printTests(os.Stdout, diff)
+	}
+	if jsonFile != "" {
+		if err := writeFile(jsonFile, diff.WriteJSON); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write JSON diff: %v\n", err)
+		}
+	}
+
+	if len(diff.Regressed) > 0 {
+		fmt.Fprintf(os.Stderr, "%d metrics regressed: %s\n", len(diff.Regressed), strings.Join(diff.Regressed, ", "))
+		os.Exit(EXIT_REGRESSED)
+	}
+}
+
+// printTests prints the statistical tests on latency histograms.
+func printTests(w io.Writer, diff *bench.Diff) {
+	if len(diff.Tests) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\nTests on latency histograms at alpha %g:\n", diff.Alpha)
+	for _, test := range diff.Tests {
+		verdict := "same distribution"
+		if test.KSP < diff.Alpha {
+			verdict = "differ"
+		}
+		fmt.Fprintf(w, "  %s: KS D %.4f p %.4f (%s), Mann-Whitney P(new > old) %.4f p %.4f\n",
+			test.Op, test.KS, test.KSP, verdict, test.Slower, test.MannWhitneyP)
+	}
+}
+
+// formatThresholds formats thresholds in the form of the -threshold option.
+func formatThresholds(thresholds map[string]float64) string {
+	fields := make([]string, 0, len(thresholds))
+	for metric, threshold := range thresholds {
+		fields = append(fields, fmt.Sprintf("%s=%g", metric, threshold))
+	}
+	sort.Strings(fields)
+	return strings.Join(fields, ";")
+}
+
+// writeFile creates the file and writes to it with the write function.
+func writeFile(path string, write func(io.Writer) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return write(file)
+}
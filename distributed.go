@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/ds2-lab/infinibench/bench"
+)
+
+// runCoordinator waits for workers, runs the workload on all workers, and prints the aggregated result.
+func runCoordinator(ctx context.Context, opts *Options) error {
+	listener, err := net.Listen("tcp", opts.Coordinator)
+	if err != nil {
+		fmt.Fprintf(opts.Stderr, "%s\n", err)
+		return err
+	}
+	coordinator := &bench.Coordinator{
+		Listener: listener,
+		Workers:  opts.Workers,
+		Connected: func(worker string) {
+			fmt.Fprintf(opts.Stdout, "Worker %s connected\n", worker)
+		},
+	}
+	fmt.Fprintf(opts.Stdout, "Waiting for %d workers on %s...\n", opts.Workers, listener.Addr())
+
+	benchOpts := opts.Options
+	ret, err := coordinator.Run(ctx, &benchOpts, newProgress(opts, ""))
+	if ret == nil {
+		fmt.Fprintf(opts.Stderr, "%s\n", err)
+		return err
+	}
+
+	fmt.Fprintf(opts.Stdout, "\n")
+	for _, worker := range ret.Workers {
+		if worker.Result != nil {
+			fmt.Fprintf(opts.Stdout, "Worker %s, key_%d ~ key_%d: %.2f requests per second, p99 %.3f milliseconds, %.2f%% failed\n",
+				worker.Worker, worker.Keymin, worker.Keymax, worker.Result.Throughput, worker.Result.Latency().P99, worker.Result.ErrorRate())
+		}
+		if worker.Error != "" {
+			fmt.Fprintf(opts.Stderr, "Worker %s: %s\n", worker.Worker, worker.Error)
+		}
+	}
+	fmt.Fprintf(opts.Stdout, "\n")
+	printSummary(opts, ret.Result)
+
+	if opts.HistFile != "" {
+		if err := writeFile(opts.HistFile, ret.Result.ExportHistograms); err != nil {
+			fmt.Fprintf(opts.Stderr, "Failed to export histograms: %v\n", err)
+		}
+	}
+	if opts.JSONFile != "" {
+		if err := writeFile(opts.JSONFile, ret.WriteJSON); err != nil {
+			fmt.Fprintf(opts.Stderr, "Failed to write JSON result: %v\n", err)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(opts.Stderr, "%s\n", err)
+	}
+	return err
+}
+
+// runWorker runs the workload assigned by the coordinator.
+func runWorker(ctx context.Context, opts *Options) error {
+	fmt.Fprintf(opts.Stdout, "Connecting to the coordinator at %s...\n", opts.Worker)
+	if err := bench.RunWorker(ctx, opts.Worker, opts.WorkerName); err != nil {
+		fmt.Fprintf(opts.Stderr, "%s\n", err)
+		return err
+	}
+	fmt.Fprintf(opts.Stdout, "Done\n")
+	return nil
+}
@@ -15,6 +15,7 @@ require (
 	github.com/google/uuid v1.2.0
 	github.com/mason-leap-lab/go-utils v1.3.2
 	github.com/zhangjyr/hashmap v1.0.2
+	gopkg.in/yaml.v2 v2.4.0
 )
 
 require (
@@ -0,0 +1,249 @@
+// Package histogram implements a mergeable HDR-style histogram for latencies.
+//
+// Values are counted in log-linear buckets: values below 2048 are tracked exactly, and larger values
+// are tracked with 3 significant digits. Counts grow lazily so small latencies cost little memory.
+package histogram
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"strconv"
+)
+
+const (
+	subBucketBits  = 11
+	subBucketCount = 1 << subBucketBits
+	subBucketHalf  = subBucketCount >> 1
+	subBucketMask  = subBucketHalf - 1
+)
+
+// Percentiles are the percentiles reported by default.
+var Percentiles = []float64{50, 90, 99, 99.9, 99.99}
+
+// Histogram counts non-negative values, e.g., latencies in nanoseconds.
+// A histogram is not thread-safe, merge histograms of concurrent recorders instead.
+// In JSON, counts of non-empty buckets only are written as an object of indexes to counts.
+type Histogram struct {
+	Counts []uint64
+	Total  uint64
+	Min    int64
+	Max    int64
+	Sum    float64
+	SumSq  float64
+}
+
+// histogramJSON is the JSON form of histograms.
+type histogramJSON struct {
+	Counts json.RawMessage `json:"counts"` // {"index": count, ...}, or dense counts of older results.
+	Total  uint64          `json:"total"`
+	Min    int64           `json:"min"`
+	Max    int64           `json:"max"`
+	Sum    float64         `json:"sum"`
+	SumSq  float64         `json:"sumsq"`
+}
+
+// New creates an empty histogram.
+func New() *Histogram {
+	return &Histogram{}
+}
+
+func index(v int64) int {
+	bucket := bits.Len64(uint64(v)) - subBucketBits
+	if bucket < 0 {
+		return int(v)
+	}
+	return bucket*subBucketHalf + int(v>>bucket)
+}
+
+// lowest returns the lowest value counted by the index.
+func lowest(idx int) int64 {
+	if idx < subBucketCount {
+		return int64(idx)
+	}
+	bucket := idx>>(subBucketBits-1) - 1
+	return int64(idx&subBucketMask+subBucketHalf) << bucket
+}
+
+// highest returns the highest value counted by the index.
+func highest(idx int) int64 {
+	if idx < subBucketCount {
+		return int64(idx)
+	}
+	bucket := idx>>(subBucketBits-1) - 1
+	return lowest(idx) + int64(1)<<bucket - 1
+}
+
+// Record counts the value. Negative values are counted as 0.
+func (h *Histogram) Record(v int64) {
+	h.RecordN(v, 1)
+}
+
+// RecordN counts the value n times.
+func (h *Histogram) RecordN(v int64, n uint64) {
+	if n == 0 {
+		return
+	} else if v < 0 {
+		v = 0
+	}
+	idx := index(v)
+	if idx >= len(h.Counts) {
+		h.grow(idx + 1)
+	}
+	h.Counts[idx] += n
+	if h.Total == 0 || v < h.Min {
+		h.Min = v
+	}
+	if v > h.Max {
+		h.Max = v
+	}
+	h.Total += n
+	h.Sum += float64(v) * float64(n)
+	h.SumSq += float64(v) * float64(v) * float64(n)
+}
+
+func (h *Histogram) grow(size int) {
+	// Grow by sub-bucket half to avoid frequent reallocations.
+	size = (size + subBucketMask) &^ subBucketMask
+	counts := make([]uint64, size)
+	copy(counts, h.Counts)
+	h.Counts = counts
+}
+
+// Merge adds counts of the other histogram to the histogram.
+func (h *Histogram) Merge(o *Histogram) {
+	if o == nil || o.Total == 0 {
+		return
+	}
+	if len(o.Counts) > len(h.Counts) {
+		h.grow(len(o.Counts))
+	}
+	for i, count := range o.Counts {
+		h.Counts[i] += count
+	}
+	if h.Total == 0 || o.Min < h.Min {
+		h.Min = o.Min
+	}
+	if o.Max > h.Max {
+		h.Max = o.Max
+	}
+	h.Total += o.Total
+	h.Sum += o.Sum
+	h.SumSq += o.SumSq
+}
+
+// Mean returns the mean of values.
+func (h *Histogram) Mean() float64 {
+	if h.Total == 0 {
+		return 0
+	}
+	return h.Sum / float64(h.Total)
+}
+
+// StdDev returns the standard deviation of values.
+func (h *Histogram) StdDev() float64 {
+	if h.Total == 0 {
+		return 0
+	}
+	mean := h.Mean()
+	return math.Sqrt(math.Max(0, h.SumSq/float64(h.Total)-mean*mean))
+}
+
+// Percentile returns the value at the percentile p in [0, 100]. The value returned is
+// the highest value equivalent to the counted value, capped by the max value.
+func (h *Histogram) Percentile(p float64) int64 {
+	if h.Total == 0 {
+		return 0
+	}
+	target := uint64(math.Ceil(p / 100 * float64(h.Total)))
+	if target == 0 {
+		return h.Min
+	}
+	var acc uint64
+	for i, count := range h.Counts {
+		acc += count
+		if acc >= target {
+			if v := highest(i); v < h.Max {
+				return v
+			}
+			return h.Max
+		}
+	}
+	return h.Max
+}
+
+// Buckets calls fn for every non-empty bucket with the lowest value, the highest value and the count of the bucket.
+func (h *Histogram) Buckets(fn func(low int64, high int64, count uint64)) {
+	for i, count := range h.Counts {
+		if count > 0 {
+			fn(lowest(i), highest(i), count)
+		}
+	}
+}
+
+// Export writes non-empty buckets in csv format with the percentile each bucket reaches.
+// The prefix fields, if any, are prepended to each line.
+func (h *Histogram) Export(w io.Writer, prefix ...string) error {
+	writer := csv.NewWriter(w)
+	var acc uint64
+	h.Buckets(func(low int64, high int64, count uint64) {
+		acc += count
+		line := append(prefix[:len(prefix):len(prefix)],
+			strconv.FormatInt(low, 10),
+			strconv.FormatInt(high, 10),
+			strconv.FormatUint(count, 10),
+			strconv.FormatFloat(float64(acc)*100/float64(h.Total), 'f', 4, 64))
+		writer.Write(line)
+	})
+	writer.Flush()
+	return writer.Error()
+}
+
+// MarshalJSON writes counts of non-empty buckets in the order of indexes.
+func (h *Histogram) MarshalJSON() ([]byte, error) {
+	var counts bytes.Buffer
+	counts.WriteByte('{')
+	for i, count := range h.Counts {
+		if count == 0 {
+			continue
+		} else if counts.Len() > 1 {
+			counts.WriteByte(',')
+		}
+		fmt.Fprintf(&counts, "\"%d\":%d", i, count)
+	}
+	counts.WriteByte('}')
+	return json.Marshal(&histogramJSON{Counts: counts.Bytes(), Total: h.Total, Min: h.Min, Max: h.Max, Sum: h.Sum, SumSq: h.SumSq})
+}
+
+// UnmarshalJSON reads sparse counts, or dense counts of older results.
+func (h *Histogram) UnmarshalJSON(data []byte) error {
+	var hj histogramJSON
+	if err := json.Unmarshal(data, &hj); err != nil {
+		return err
+	}
+	*h = Histogram{Total: hj.Total, Min: hj.Min, Max: hj.Max, Sum: hj.Sum, SumSq: hj.SumSq}
+	if counts := bytes.TrimSpace(hj.Counts); len(counts) == 0 || bytes.Equal(counts, []byte("null")) {
+		return nil
+	} else if counts[0] == '[' {
+		return json.Unmarshal(counts, &h.Counts)
+	}
+	var sparse map[string]uint64
+	if err := json.Unmarshal(hj.Counts, &sparse); err != nil {
+		return err
+	}
+	for key, count := range sparse {
+		idx, err := strconv.Atoi(key)
+		if err != nil || idx < 0 {
+			return fmt.Errorf("histogram: invalid bucket index %q", key)
+		}
+		if idx >= len(h.Counts) {
+			h.grow(idx + 1)
+		}
+		h.Counts[idx] += count
+	}
+	return nil
+}
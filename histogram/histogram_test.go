@@ -0,0 +1,197 @@
+package histogram
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	// Values below 2048 are exact.
+	for v := int64(0); v < subBucketCount; v++ {
+		if idx := index(v); lowest(idx) != v || highest(idx) != v {
+			t.Fatalf("value %d: bucket [%d, %d]", v, lowest(idx), highest(idx))
+		}
+	}
+
+	// Buckets are contiguous with 3 significant digits.
+	for idx := 0; idx < 40*subBucketHalf; idx++ {
+		low, high := lowest(idx), highest(idx)
+		if high < low || index(low) != idx || index(high) != idx {
+			t.Fatalf("index %d: bucket [%d, %d] of indexes %d and %d", idx, low, high, index(low), index(high))
+		} else if next := lowest(idx + 1); next != high+1 {
+			t.Fatalf("index %d: bucket [%d, %d] is followed by %d", idx, low, high, next)
+		} else if precision := float64(high-low) / float64(low+1); precision > 1.0/subBucketHalf {
+			t.Fatalf("index %d: bucket [%d, %d] is wider than 3 significant digits", idx, low, high)
+		}
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 100000; i++ {
+		v := rnd.Int63() >> rnd.Intn(63)
+		if idx := index(v); v < lowest(idx) || v > highest(idx) {
+			t.Fatalf("value %d is not in the bucket [%d, %d]", v, lowest(idx), highest(idx))
+		}
+	}
+	if idx := index(math.MaxInt64); highest(idx) != math.MaxInt64 {
+		t.Fatalf("the max value is not in the last bucket [%d, %d]", lowest(idx), highest(idx))
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	h := New()
+	if h.Percentile(99) != 0 || h.Mean() != 0 || h.StdDev() != 0 {
+		t.Fatal("unexpected statistics of the empty histogram")
+	}
+	for v := int64(1); v <= 100000; v++ {
+		h.Record(v)
+	}
+	if h.Total != 100000 || h.Min != 1 || h.Max != 100000 {
+		t.Fatalf("unexpected total %d, min %d and max %d", h.Total, h.Min, h.Max)
+	} else if h.Mean() != 50000.5 {
+		t.Fatalf("expect the mean 50000.5, got %v", h.Mean())
+	} else if stddev := h.StdDev(); math.Abs(stddev-28867.5) > 0.1 {
+		t.Fatalf("expect the standard deviation about 28867.5, got %v", stddev)
+	}
+	for _, p := range []float64{1, 50, 90, 99, 99.9, 99.99} {
+		expect := p / 100 * 100000
+		if v := h.Percentile(p); float64(v) < expect || float64(v) > expect*(1+1.0/subBucketHalf) {
+			t.Fatalf("p%v: expect %v within 3 significant digits, got %d", p, expect, v)
+		}
+	}
+	if h.Percentile(0) != 1 || h.Percentile(100) != 100000 {
+		t.Fatalf("expect p0 1 and p100 100000, got %d and %d", h.Percentile(0), h.Percentile(100))
+	}
+
+	// Negative values are counted as 0, and percentiles are capped by the max value.
+	h = New()
+	h.Record(-5)
+	h.RecordN(1000001, 3)
+	h.RecordN(7, 0)
+	if h.Total != 4 || h.Min != 0 || h.Percentile(25) != 0 || h.Percentile(50) != 1000001 {
+		t.Fatalf("unexpected histogram %+v", h)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	all, a, b := New(), New(), New()
+	for i := 0; i < 10000; i++ {
+		v := int64(rnd.ExpFloat64() * 1e6)
+		all.Record(v)
+		if i%3 == 0 {
+			a.Record(v)
+		} else {
+			b.Record(v)
+		}
+	}
+	merged := New()
+	merged.Merge(a)
+	merged.Merge(nil)
+	merged.Merge(New())
+	merged.Merge(b)
+	if merged.Total != all.Total || merged.Min != all.Min || merged.Max != all.Max {
+		t.Fatalf("expect %d values in [%d, %d], got %d in [%d, %d]", all.Total, all.Min, all.Max, merged.Total, merged.Min, merged.Max)
+	} else if math.Abs(merged.Sum-all.Sum) > 1e-6*all.Sum || math.Abs(merged.SumSq-all.SumSq) > 1e-6*all.SumSq {
+		t.Fatal("sums are not merged")
+	}
+	for _, p := range Percentiles {
+		if merged.Percentile(p) != all.Percentile(p) {
+			t.Fatalf("p%v: expect %d, got %d", p, all.Percentile(p), merged.Percentile(p))
+		}
+	}
+	// Merging into a histogram with smaller values grows counts.
+	small := New()
+	small.Record(1)
+	small.Merge(all)
+	if small.Total != all.Total+1 || small.Min != 1 || small.Max != all.Max {
+		t.Fatalf("unexpected merged histogram of %d values in [%d, %d]", small.Total, small.Min, small.Max)
+	}
+}
+
+func TestExport(t *testing.T) {
+	h := New()
+	h.RecordN(10, 3)
+	h.Record(5000)
+	var buf bytes.Buffer
+	if err := h.Export(&buf, "get"); err != nil {
+		t.Fatal(err)
+	}
+	lines, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := [][]string{
+		{"get", "10", "10", "3", "75.0000"},
+		{"get", "5000", "5003", "1", "100.0000"},
+	}
+	if !reflect.DeepEqual(lines, expect) {
+		t.Fatalf("expect %v, got %v", expect, lines)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	h := New()
+	h.RecordN(3, 2)
+	h.Record(5000)
+	data, err := json.Marshal(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `{"counts":{"3":2,"` + strconv.Itoa(index(5000)) + `":1},"total":3,"min":3,"max":5000,"sum":5006,"sumsq":25000018}`
+	if string(data) != expect {
+		t.Fatalf("expect %s, got %s", expect, data)
+	}
+
+	var decoded Histogram
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(&decoded, h) {
+		t.Fatalf("expect %+v, got %+v", h, &decoded)
+	}
+
+	// Random latencies survive the round trip.
+	rnd := rand.New(rand.NewSource(1))
+	h = New()
+	for i := 0; i < 10000; i++ {
+		h.Record(int64(rnd.ExpFloat64() * 1e6))
+	}
+	data, _ = json.Marshal(h)
+	decoded = Histogram{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(&decoded, h) {
+		t.Fatal("histogram changed in the round trip")
+	}
+
+	// Empty histograms and dense counts of older results.
+	for _, c := range []struct {
+		data   string
+		expect *Histogram
+	}{
+		{`{"counts":{},"total":0,"min":0,"max":0,"sum":0,"sumsq":0}`, &Histogram{}},
+		{`{"counts":null,"total":0}`, &Histogram{}},
+		{`{"counts":[0,0,0,2],"total":2,"min":3,"max":3,"sum":6,"sumsq":18}`, &Histogram{Counts: []uint64{0, 0, 0, 2}, Total: 2, Min: 3, Max: 3, Sum: 6, SumSq: 18}},
+	} {
+		decoded = Histogram{Counts: []uint64{1}}
+		if err := json.Unmarshal([]byte(c.data), &decoded); err != nil {
+			t.Fatalf("%s: %v", c.data, err)
+		} else if !reflect.DeepEqual(&decoded, c.expect) {
+			t.Fatalf("%s: expect %+v, got %+v", c.data, c.expect, &decoded)
+		}
+	}
+	if data, _ := json.Marshal(New()); string(data) != `{"counts":{},"total":0,"min":0,"max":0,"sum":0,"sumsq":0}` {
+		t.Fatalf("unexpected empty histogram %s", data)
+	}
+
+	for _, data := range []string{`{"counts":{"-1":1}}`, `{"counts":{"a":1}}`, `{"counts":{"1":-1}}`} {
+		if err := json.Unmarshal([]byte(data), &decoded); err == nil {
+			t.Errorf("%s: expect an error", data)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package histogram
+
+import (
+	"math"
+)
+
+// Histograms share the bucket layout, so two histograms are compared bucket by bucket. Values in a bucket are
+// treated as ties, which makes tests slightly conservative.
+
+// KolmogorovSmirnov runs the two-sample Kolmogorov-Smirnov test on the histograms. It returns the max distance
+// between the two cumulative distributions, and the asymptotic p-value of the hypothesis that both histograms
+// count values of the same distribution. The p-value is 1 if either histogram is empty.
+func KolmogorovSmirnov(a *Histogram, b *Histogram) (d float64, p float64) {
+	if a.Total == 0 || b.Total == 0 {
+		return 0, 1
+	}
+	var accA, accB uint64
+	for i := 0; i < len(a.Counts) || i < len(b.Counts); i++ {
+		accA += count(a, i)
+		accB += count(b, i)
+		d = math.Max(d, math.Abs(float64(accA)/float64(a.Total)-float64(accB)/float64(b.Total)))
+	}
+
+	n := math.Sqrt(float64(a.Total) * float64(b.Total) / float64(a.Total+b.Total))
+	lambda := (n + 0.12 + 0.11/n) * d
+	return d, ksProb(lambda)
+}
+
+// ksProb returns the probability of the Kolmogorov distribution exceeding lambda.
+func ksProb(lambda float64) float64 {
+	if lambda < 0.2 {
+		return 1
+	}
+	var sum float64
+	sign := 1.0
+	for j := 1; j <= 100; j++ {
+		term := sign * 2 * math.Exp(-2*float64(j*j)*lambda*lambda)
+		sum += term
+		if math.Abs(term) < 1e-10 {
+			break
+		}
+		sign = -sign
+	}
+	return math.Min(1, math.Max(0, sum))
+}
+
+// MannWhitney runs the two-sided Mann-Whitney U test on the histograms with the normal approximation corrected
+// for ties. It returns the probability that a value of b is greater than a value of a, counting ties as half,
+// and the p-value of the hypothesis that neither histogram tends to count greater values. The probability is
+// 0.5 and the p-value is 1 if either histogram is empty.
+func MannWhitney(a *Histogram, b *Histogram) (greater float64, p float64) {
+	if a.Total == 0 || b.Total == 0 {
+		return 0.5, 1
+	}
+	na, nb := float64(a.Total), float64(b.Total)
+	n := na + nb
+	var u, ties, belowA float64
+	for i := 0; i < len(a.Counts) || i < len(b.Counts); i++ {
+		ca, cb := float64(count(a, i)), float64(count(b, i))
+		u += cb * (belowA + ca/2)
+		belowA += ca
+		if t := ca + cb; t > 1 {
+			ties += t*t*t - t
+		}
+	}
+
+	greater = u / (na * nb)
+	sigma := math.Sqrt(na * nb / 12 * ((n + 1) - ties/(n*(n-1))))
+	if sigma == 0 {
+		return greater, 1
+	}
+	z := (u - na*nb/2) / sigma
+	return greater, math.Erfc(math.Abs(z) / math.Sqrt2)
+}
+
+func count(h *Histogram, idx int) uint64 {
+	if idx < len(h.Counts) {
+		return h.Counts[idx]
+	}
+	return 0
+}
@@ -0,0 +1,99 @@
+package histogram
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func newHistogram(values ...int64) *Histogram {
+	h := New()
+	for _, v := range values {
+		h.Record(v)
+	}
+	return h
+}
+
+// rangeHistogram returns the histogram of values in [from, to).
+func rangeHistogram(from int64, to int64) *Histogram {
+	h := New()
+	for v := from; v < to; v++ {
+		h.Record(v)
+	}
+	return h
+}
+
+func TestKSProb(t *testing.T) {
+	// Critical values of the Kolmogorov distribution.
+	for _, c := range []struct{ lambda, p float64 }{
+		{0.1, 1},
+		{1.224, 0.1},
+		{1.358, 0.05},
+		{1.628, 0.01},
+	} {
+		if p := ksProb(c.lambda); math.Abs(p-c.p) > 0.001 {
+			t.Errorf("lambda %g: expect p-value %g, got %g", c.lambda, c.p, p)
+		}
+	}
+}
+
+func TestKolmogorovSmirnov(t *testing.T) {
+	if d, p := KolmogorovSmirnov(New(), rangeHistogram(0, 10)); d != 0 || p != 1 {
+		t.Fatalf("empty histogram: expect d 0 and p-value 1, got %g and %g", d, p)
+	}
+	if d, p := KolmogorovSmirnov(rangeHistogram(0, 1000), rangeHistogram(0, 1000)); d != 0 || p != 1 {
+		t.Fatalf("same histograms: expect d 0 and p-value 1, got %g and %g", d, p)
+	}
+
+	// A shift of 10% of the range.
+	d, p := KolmogorovSmirnov(rangeHistogram(1000, 2000), rangeHistogram(1100, 2100))
+	if math.Abs(d-0.1) > 1e-9 || p > 0.001 {
+		t.Fatalf("shifted histograms: expect d 0.1 and a small p-value, got %g and %g", d, p)
+	}
+	// The same distance of a few samples is not significant.
+	d, p = KolmogorovSmirnov(rangeHistogram(1000, 1010), rangeHistogram(1001, 1011))
+	if math.Abs(d-0.1) > 1e-9 || p < 0.5 {
+		t.Fatalf("small histograms: expect d 0.1 and a large p-value, got %g and %g", d, p)
+	}
+	// Disjoint histograms.
+	if d, _ := KolmogorovSmirnov(newHistogram(100, 200), newHistogram(300)); d != 1 {
+		t.Fatalf("disjoint histograms: expect d 1, got %g", d)
+	}
+
+	// Samples of the same distribution.
+	rnd := rand.New(rand.NewSource(1))
+	a, b := New(), New()
+	for i := 0; i < 10000; i++ {
+		a.Record(int64(rnd.ExpFloat64() * 1e6))
+		b.Record(int64(rnd.ExpFloat64() * 1e6))
+	}
+	if _, p := KolmogorovSmirnov(a, b); p < 0.01 {
+		t.Fatalf("samples of the same distribution: expect a large p-value, got %g", p)
+	}
+}
+
+func TestMannWhitney(t *testing.T) {
+	if greater, p := MannWhitney(rangeHistogram(0, 10), New()); greater != 0.5 || p != 1 {
+		t.Fatalf("empty histogram: expect 0.5 and p-value 1, got %g and %g", greater, p)
+	}
+	if greater, p := MannWhitney(newHistogram(5, 5), newHistogram(5)); greater != 0.5 || p != 1 {
+		t.Fatalf("ties only: expect 0.5 and p-value 1, got %g and %g", greater, p)
+	}
+	if greater, p := MannWhitney(rangeHistogram(0, 1000), rangeHistogram(0, 1000)); greater != 0.5 || p != 1 {
+		t.Fatalf("same histograms: expect 0.5 and p-value 1, got %g and %g", greater, p)
+	}
+
+	// U counts pairs of greater values of b, and ties as half: 1 + 0.5 + 1 + 1 of 4 pairs.
+	if greater, _ := MannWhitney(newHistogram(1, 2), newHistogram(2, 3)); greater != 0.875 {
+		t.Fatalf("expect 0.875, got %g", greater)
+	}
+
+	greater, p := MannWhitney(rangeHistogram(1000, 2000), rangeHistogram(1100, 2100))
+	if math.Abs(greater-0.595) > 1e-9 || p > 0.001 {
+		t.Fatalf("slower histogram: expect 0.595 and a small p-value, got %g and %g", greater, p)
+	}
+	faster, fp := MannWhitney(rangeHistogram(1100, 2100), rangeHistogram(1000, 2000))
+	if math.Abs(faster+greater-1) > 1e-9 || math.Abs(fp-p) > 1e-12 {
+		t.Fatalf("faster histogram: expect %g and p-value %g, got %g and %g", 1-greater, p, faster, fp)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ds2-lab/infinibench/bench"
+)
+
+// runRamp steps up the load until the SLO breaks, and prints the knee.
+func runRamp(ctx context.Context, opts *Options) error {
+	ramp := &bench.Ramp{
+		By:           opts.Ramp,
+		Start:        opts.RampStart,
+		Step:         opts.RampStep,
+		Factor:       opts.RampFactor,
+		Max:          opts.RampMax,
+		SLO:          opts.SLO,
+		Percentile:   opts.SLOPercentile,
+		MaxErrorRate: opts.SLOErrors,
+		Refine:       opts.RampRefine,
+	}
+
+	benchOpts := opts.Options
+	benchOpts.Progress = newProgress(opts, "the key range")
+	ret, err := ramp.Run(ctx, &benchOpts, func(step *bench.RampStep) {
+		verdict := "ok"
+		if !step.OK {
+			verdict = "breaks SLO"
+		}
+		fmt.Fprintf(opts.Stdout, "\r%s=%g: %.2f requests per second, p%g %.3f milliseconds, %.2f%% failed, %s\n",
+			opts.Ramp, step.Load, step.Throughput, opts.SLOPercentile, step.Latency, step.ErrorRate, verdict)
+		if step.Error != "" {
+			fmt.Fprintf(opts.Stderr, "%s=%g: %s\n", opts.Ramp, step.Load, step.Error)
+		}
+	})
+	if ret == nil {
+		fmt.Fprintf(opts.Stderr, "%s\n", err)
+		return err
+	}
+
+	fmt.Fprintf(opts.Stdout, "\n")
+	if ret.Knee == nil {
+		fmt.Fprintf(opts.Stdout, "No load meets p%g <= %v with %.2f%% failed\n", opts.SLOPercentile, opts.SLO, opts.SLOErrors)
+	} else if !ret.Saturated {
+		fmt.Fprintf(opts.Stdout, "Knee not found, the SLO did not break up to %s=%g, raise -ramp-max to sustain more\n",
+			opts.Ramp, ret.Steps[len(ret.Steps)-1].Load)
+		fmt.Fprintf(opts.Stdout, "Max within the SLO: %s=%g, %.2f requests per second at p%g %.3f milliseconds\n",
+			opts.Ramp, ret.Knee.Load, ret.Knee.Throughput, opts.SLOPercentile, ret.Knee.Latency)
+	} else {
+		fmt.Fprintf(opts.Stdout, "Knee: %s=%g, %.2f requests per second at p%g %.3f milliseconds\n",
+			opts.Ramp, ret.Knee.Load, ret.Knee.Throughput, opts.SLOPercentile, ret.Knee.Latency)
+	}
+	if opts.JSONFile != "" {
+		if err := writeFile(opts.JSONFile, ret.WriteJSON); err != nil {
+			fmt.Fprintf(opts.Stderr, "Failed to write JSON result: %v\n", err)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(opts.Stderr, "%s\n", err)
+	}
+	return err
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ds2-lab/infinibench/bench"
+)
+
+// runScenario runs the scenario file with the options as defaults, and prints the result of each phase.
+func runScenario(ctx context.Context, opts *Options) error {
+	benchOpts := opts.Options
+	benchOpts.Progress = newProgress(opts, "the key range")
+	scenario, err := bench.LoadScenario(opts.ScenarioFile, &benchOpts)
+	if err != nil {
+		fmt.Fprintf(opts.Stderr, "%s\n", err)
+		return err
+	}
+
+	ret, err := scenario.Run(ctx, func(phase *bench.PhaseResult) {
+		fmt.Fprintf(opts.Stdout, "\r###### %s ######\n", phase.Name)
+		if phase.Result != nil {
+			printSummary(opts, phase.Result)
+		} else if phase.Type == bench.PHASE_CLEANUP {
+			fmt.Fprintf(opts.Stdout, "  %d keys deleted\n\n", phase.Deleted)
+		}
+	})
+	if opts.JSONFile != "" {
+		if err := writeFile(opts.JSONFile, ret.WriteJSON); err != nil {
+			fmt.Fprintf(opts.Stderr, "Failed to write JSON result: %v\n", err)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(opts.Stderr, "%s\n", err)
+	}
+	return err
+}
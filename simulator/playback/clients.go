@@ -1,10 +1,14 @@
 package main
 
 import (
+	"net/url"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
+	"github.com/ds2-lab/infinibench/bench"
 	"github.com/ds2-lab/infinibench/benchclient"
-	"github.com/ds2-lab/infinistore/client"
 )
 
 const (
@@ -16,58 +20,174 @@ const (
 
 type ClientProvider func() benchclient.Client
 
-func BuildClientProviders(options *Options) map[string]ClientProvider {
-	m := make(map[string]ClientProvider)
+// injector injects faults of -faults, shared by clients so that windows of faults are relative to the start of
+// the replay.
+var injector *benchclient.FaultInjector
+
+// ClientDSNs returns the DSNs of enabled clients by provider. The -s3, -redis, and -dummy options are translated
+// to DSNs, and DSNs of the -dsn option are keyed by the scheme, except that Redis clusters are keyed "redis" and
+// InfiniStore is keyed "default." Without any client enabled, the default client is an InfiniStore client of -addrlist.
+func ClientDSNs(options *Options) map[string]string {
+	m := make(map[string]string)
 	if options.S3 != "" {
-		log.Info("Preparing S3 client for bucket %s...", options.S3)
-		m[ProviderS3] = GenS3ClientProvider(options.S3)
+		m[ProviderS3] = (&url.URL{Scheme: "s3", Host: options.S3}).String()
 	}
 	if options.Redis != "" {
-		log.Info("Preparing Redis client for cluster %s...", options.Redis)
-		m[ProviderRedis] = GenRedisClientProvider(options.Redis, options.RedisCluster)
+		if options.RedisCluster > 1 {
+			m[ProviderRedis] = (&url.URL{Scheme: "rediscluster", Host: options.Redis, RawQuery: "nodes=" + strconv.Itoa(options.RedisCluster)}).String()
+		} else {
+			m[ProviderRedis] = (&url.URL{Scheme: "redis", Host: options.Redis}).String()
+		}
 	}
 	if options.Dummy {
-		log.Info("Preparing Dummy client with bandwidth %d...", options.Bandwidth)
-		m[ProviderDummy] = GenDummyClientProvider(options.Bandwidth, benchclient.DummyStore)
+		m[ProviderDummy] = dummyDSN(options, benchclient.DummyStore)
+	}
+	for _, dsn := range strings.Split(options.DSN, ";") {
+		if dsn = strings.TrimSpace(dsn); dsn != "" {
+			m[providerKey(dsn)] = dsn
+		}
 	}
 	if len(m) == 0 {
-		m[ProviderDefault] = GenDefaultClientProvider(options)
+		m[ProviderDefault] = defaultDSN(options)
 	}
 	return m
 }
 
-func GenS3ClientProvider(bucket string) ClientProvider {
-	return func() benchclient.Client {
-		return benchclient.NewS3(bucket)
+// BuildClientProviders prepares providers of enabled clients. See ClientDSNs for the keys of providers.
+// Faults of -faults are injected into clients other than the failover client.
+func BuildClientProviders(options *Options) (map[string]ClientProvider, error) {
+	faults, err := benchclient.ParseFaults(options.Faults)
+	if err != nil {
+		return nil, err
+	} else if len(faults) > 0 {
+		injector = benchclient.NewFaultInjector(faults, time.Now().UnixNano())
 	}
-}
 
-func GenRedisClientProvider(addr string, cluster int) ClientProvider {
-	if cluster > 1 {
-		return func() benchclient.Client {
-			return benchclient.NewElasticCache(addr, cluster, 0)
+	m := make(map[string]ClientProvider)
+	for key, dsn := range ClientDSNs(options) {
+		var provider ClientProvider
+		if key == strings.ToLower(options.Failover) {
+			provider, err = genClientProvider(options, dsn, nil)
+		} else {
+			provider, err = GenClientProvider(options, dsn)
 		}
-	} else {
-		return func() benchclient.Client {
-			return benchclient.NewRedis(addr)
+		if err != nil {
+			return nil, err
 		}
+		m[key] = provider
 	}
+	return m, nil
 }
 
-func GenDummyClientProvider(bandwidth int64, t string) ClientProvider {
-	return func() benchclient.Client {
-		return benchclient.NewDummy(bandwidth, t)
-	}
+// GenClientProvider returns the provider of clients of the DSN. InfiniStore clients do not dial in dry runs.
+// Clients that can not cancel requests are adapted by benchclient.WithContext, faults of -faults are injected,
+// and requests are retried by the policy of -attempts.
+func GenClientProvider(options *Options, dsn string) (ClientProvider, error) {
+	return genClientProvider(options, dsn, injector)
 }
 
-func GenDefaultClientProvider(options *Options) ClientProvider {
-	addrArr := strings.Split(options.AddrList, ",")
-	log.Info("Preparing InfiniCache client with address %s...", options.AddrList)
+func genClientProvider(options *Options, dsn string, faults *benchclient.FaultInjector) (ClientProvider, error) {
+	policy, err := retryPolicy(options)
+	if err != nil {
+		return nil, err
+	}
+	if u, err := url.Parse(dsn); err == nil && options.Dryrun && strings.EqualFold(u.Scheme, "infinistore") {
+		query := u.Query()
+		query.Set("dial", "false")
+		u.RawQuery = query.Encode()
+		dsn = u.String()
+	}
+	log.Info("Preparing client of %s...", redact(dsn))
+	construct, err := benchclient.NewConstructor(dsn)
+	if err != nil {
+		return nil, err
+	}
+	var clients int32
 	return func() benchclient.Client {
-		cli := client.NewClient(options.Datashard, options.Parityshard, options.ECmaxgoroutine)
-		if !options.Dryrun {
-			cli.Dial(addrArr)
+		// Requests are canceled on their deadlines, see perform.
+		cli := benchclient.WithContext(construct())
+		if faults != nil {
+			// Retries see injected faults.
+			cli = benchclient.WithFaults(cli, faults, int(atomic.AddInt32(&clients, 1)))
+		}
+		if policy != nil {
+			cli = benchclient.WithRetry(cli, policy, countRetries)
 		}
 		return cli
+	}, nil
+}
+
+// retryPolicy returns the retry policy in the options, or nil if requests are not retried. The policy is built
+// as in infinibench.
+func retryPolicy(options *Options) (*benchclient.RetryPolicy, error) {
+	opts := &bench.Options{
+		Attempts:       options.Attempts,
+		Backoff:        options.Backoff,
+		MaxBackoff:     options.MaxBackoff,
+		BackoffFactor:  options.BackoffFactor,
+		Jitter:         options.Jitter,
+		RetryOn:        options.RetryOn,
+		AttemptTimeout: options.AttemptTimeout,
+	}
+	return opts.RetryPolicy()
+}
+
+func countRetries(attempt *benchclient.Attempt) {
+	if attempt.Attempt > 1 {
+		atomic.AddInt32(&retries, 1)
+	}
+}
+
+// setOptions returns the options of SETs. Placements are passed to clients that track them only, e.g. InfiniStore.
+func setOptions(cli benchclient.ContextClient, dryrun int, placements []int, mode string) []benchclient.RequestOption {
+	opts := []benchclient.RequestOption{benchclient.WithDryRun(dryrun), benchclient.WithSetMode(mode)}
+	if set, _ := cli.SupportedOptions(); set&benchclient.OptionPlacements != 0 {
+		opts = append(opts, benchclient.WithPlacements(placements))
+	}
+	return opts
+}
+
+// providerKey returns the key of the provider of the DSN.
+func providerKey(dsn string) string {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return dsn
+	}
+	switch scheme := strings.ToLower(u.Scheme); scheme {
+	case "rediscluster", "elasticache":
+		return ProviderRedis
+	case "infinistore":
+		return ProviderDefault
+	default:
+		return scheme
+	}
+}
+
+// dummyDSN returns the DSN of the dummy client of the type. The capacity of -cap applies to the main dummy client,
+// and the failover dummy store is unbounded.
+func dummyDSN(options *Options, t string) string {
+	query := url.Values{}
+	query.Set("bw", strconv.FormatInt(options.Bandwidth, 10))
+	query.Set("type", t)
+	if options.Capacity > 0 && (t == benchclient.DummyCache || !strings.EqualFold(options.Failover, ProviderDummy)) {
+		query.Set("cap", strconv.FormatUint(options.Capacity*1024*1024, 10))
+		query.Set("evict", options.Eviction)
+	}
+	return "dummy://?" + query.Encode()
+}
+
+func defaultDSN(options *Options) string {
+	query := url.Values{}
+	query.Set("d", strconv.Itoa(options.Datashard))
+	query.Set("p", strconv.Itoa(options.Parityshard))
+	query.Set("g", strconv.Itoa(options.ECmaxgoroutine))
+	return (&url.URL{Scheme: "infinistore", Host: options.AddrList, RawQuery: query.Encode()}).String()
+}
+
+// redact hides the password in the DSN.
+func redact(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil {
+		return u.Redacted()
 	}
+	return dsn
 }
@@ -23,6 +23,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	sysflag "flag"
 	"fmt"
 	"io"
@@ -46,9 +47,9 @@ import (
 	"github.com/ds2-lab/infinistore/proxy/global"
 	"github.com/dustin/go-humanize"
 	"github.com/mason-leap-lab/go-utils/logger"
-	"github.com/mason-leap-lab/go-utils/promise"
 	"github.com/mason-leap-lab/go-utils/sync"
 
+	"github.com/ds2-lab/infinibench/bench"
 	"github.com/ds2-lab/infinibench/simulator/playback/helpers"
 	"github.com/ds2-lab/infinibench/simulator/playback/proxy"
 	"github.com/ds2-lab/infinibench/simulator/readers"
@@ -61,6 +62,7 @@ const (
 	PerformResultSuccess  = 0
 	PerformResultError    = 1
 	PerformResultNotFound = 2
+	PerformResultTimeout  = 3
 )
 
 var (
@@ -73,10 +75,11 @@ var (
 	numClients                int32
 	keySets, keyGets, keyMiss int32
 	sets, gets                int32
+	timeouts                  int32
+	retries                   int32
 )
 
 func init() {
-	promise.InitPool(65535)
 	global.Log = log
 }
 
@@ -106,6 +109,16 @@ type Options struct {
 	RedisCluster     int
 	Dummy            bool
 	Failover         string
+	DSN              string
+	Timeout          time.Duration
+	Attempts         int
+	Backoff          time.Duration
+	MaxBackoff       time.Duration
+	BackoffFactor    float64
+	Jitter           float64
+	RetryOn          string
+	AttemptTimeout   time.Duration
+	Faults           string
 	Balance          bool
 	Concurrency      int
 	Bandwidth        int64
@@ -115,8 +128,10 @@ type Options struct {
 	FunctionCapacity uint64
 	FunctionOverhead uint64
 	Capacity         uint64
+	Eviction         string
 	Speed            float64
 	Checkpoint       string
+	JSONFile         string
 }
 
 type NanoLogProvider func(func(nanolog.Handle, ...interface{}) error)
@@ -158,7 +173,8 @@ func restore(opts *Options, p *proxy.Proxy, obj *proxy.Object, dummyPlacement []
 	}
 }
 
-func perform(opts *Options, cli benchclient.Client, p *proxy.Proxy, obj *proxy.Object) (string, string, int) {
+func perform(ctx context.Context, opts *Options, cli benchclient.Client, p *proxy.Proxy, obj *proxy.Object) (string, string, int) {
+	ctxCli := benchclient.WithContext(cli)
 	dryrun := 0
 	if opts.Dryrun {
 		dryrun = opts.Cluster
@@ -176,7 +192,7 @@ func perform(opts *Options, cli benchclient.Client, p *proxy.Proxy, obj *proxy.O
 			log.Trace("Found placements of %v: %v", obj.Key, placements)
 		}
 
-		reqId, reader, err := cli.EcGet(obj.Key, dryrun)
+		reqId, reader, err := ctxCli.EcGetContext(ctx, obj.Key, benchclient.WithDryRun(dryrun))
 		if opts.Dryrun && opts.Balance {
 			// Validate the result on dryrun.
 			success := placements != nil && p.Validate(obj)
@@ -186,14 +202,14 @@ func perform(opts *Options, cli benchclient.Client, p *proxy.Proxy, obj *proxy.O
 			}
 		}
 
-		if err == client.ErrNotFound {
+		if errors.Is(err, client.ErrNotFound) {
 			atomic.AddInt32(&keyMiss, 1)
 			var val []byte
 			if len(clientPools) > 1 {
 				bakcli, _ := clientPools[1].Get(context.TODO())
 				clientPools[1].Put(bakcli)
 
-				_, reader, _ := bakcli.EcGet(obj.Key, dryrun)
+				_, reader, _ := benchclient.WithContext(bakcli).EcGetContext(ctx, obj.Key, benchclient.WithDryRun(dryrun))
 				if reader != nil {
 					val, _ = reader.ReadAll()
 					reader.Close()
@@ -209,7 +225,7 @@ func perform(opts *Options, cli benchclient.Client, p *proxy.Proxy, obj *proxy.O
 			for i := 0; i < len(placements); i++ {
 				resetPlacements32[i] = int(placements[i])
 			}
-			_, err := cli.EcSet(obj.Key, val, dryrun, resetPlacements32, "Reset")
+			_, err := ctxCli.EcSetContext(ctx, obj.Key, val, setOptions(ctxCli, dryrun, resetPlacements32, benchclient.SetModeReset)...)
 			// Reset is designed for caching system in normal(playback) mode.
 			// Only one of concurrent Reset requests is expected to success.
 			if err == nil {
@@ -261,7 +277,10 @@ func perform(opts *Options, cli benchclient.Client, p *proxy.Proxy, obj *proxy.O
 		} else if reader != nil {
 			reader.Close()
 		}
-		if err != nil {
+		if benchclient.ResultFromError(err) == benchclient.ResultTimeout {
+			atomic.AddInt32(&timeouts, 1)
+			return "get", reqId, PerformResultTimeout
+		} else if err != nil {
 			return "get", reqId, PerformResultError
 		}
 
@@ -300,12 +319,16 @@ func perform(opts *Options, cli benchclient.Client, p *proxy.Proxy, obj *proxy.O
 				defer clientPools[1].Put(cli)
 
 				// Set to failover client
-				cli.EcSet(key, val, dryrun)
+				benchclient.WithContext(cli).EcSetContext(context.Background(), key, val, benchclient.WithDryRun(dryrun))
 			}(obj.Key, val)
 		}
 		atomic.AddInt32(&sets, 1)
-		reqId, err := cli.EcSet(obj.Key, val, dryrun, placements32, "Normal")
-		if err != nil {
+		reqId, err := ctxCli.EcSetContext(ctx, obj.Key, val, setOptions(ctxCli, dryrun, placements32, benchclient.SetModeNormal)...)
+		if benchclient.ResultFromError(err) == benchclient.ResultTimeout {
+			p.ClearPlacements(obj.Key)
+			atomic.AddInt32(&timeouts, 1)
+			return "set", reqId, PerformResultTimeout
+		} else if err != nil {
 			p.ClearPlacements(obj.Key)
 			return "set", reqId, PerformResultError
 		}
@@ -403,7 +426,8 @@ func main() {
 	flag.StringVar(&options.Redis, "redis", "", "Redis address for enable Redis simulation")
 	flag.IntVar(&options.RedisCluster, "redisCluster", 1, "The number of nodes in the redis cluster. Set larger than 1 to enable Redis cluster")
 	flag.BoolVar(&options.Dummy, "dummy", false, "using Dummy client for simulation")
-	flag.StringVar(&options.Failover, "failover", "", "specify the failover service in case the main service failed. The failover service can be s3 and must be enabled in parameters.")
+	flag.StringVar(&options.DSN, "dsn", "", "DSNs of clients separated by \";\", e.g. \"redis://127.0.0.1:6379;s3://bucket?region=us-west-2\". See the README for schemes.")
+	flag.StringVar(&options.Failover, "failover", "", "specify the failover service in case the main service failed. The failover service can be s3, redis, dummy, or the scheme of a DSN, and must be enabled in parameters.")
 	flag.BoolVar(&options.Balance, "balance", false, "enable balancer on dryrun")
 	flag.IntVar(&options.Concurrency, "c", 1000, "max concurrency allowed, minimum 1.")
 	flag.Int64Var(&options.Bandwidth, "w", 0, "unit bandwidth per shard in MiB/s. 0 for unlimited bandwidth")
@@ -412,9 +436,20 @@ func main() {
 	flag.Uint64Var(&options.SampleKey, "sk", 0, "the key of sample")
 	flag.Uint64Var(&options.FunctionCapacity, "fc", 0, "specify the capacity(in MB) of functions")
 	flag.Uint64Var(&options.FunctionOverhead, "fo", 0, "specify the overhead(in MB) of functions")
-	flag.Uint64Var(&options.Capacity, "cap", 0, "specify the capacity(in MB) of storage, useful combined with -redis -dryrun")
+	flag.Uint64Var(&options.Capacity, "cap", 0, "specify the capacity(in MB) of storage, useful combined with -redis -dryrun, or -dummy")
+	flag.StringVar(&options.Eviction, "evict", benchclient.EvictLRU, "eviction policy of the dummy client with -cap: lru, lfu, or fifo")
 	flag.Float64Var(&options.Speed, "speed", 1, "the speed of replaying")
 	flag.StringVar(&options.Checkpoint, "checkpoint", "", "the checkpoint file that enables continue from where stopped.")
+	flag.DurationVar(&options.Timeout, "timeout", 30*time.Second, "the deadline of each request. Requests exceeding the deadline are canceled and counted as timeouts. 0 for no deadline.")
+	flag.IntVar(&options.Attempts, "attempts", 1, "max attempts of each request including retries, 1 for no retry. -timeout covers all attempts and backoffs.")
+	flag.DurationVar(&options.Backoff, "backoff", 10*time.Millisecond, "backoff before the first retry, multiplied by -backoff-factor per retry.")
+	flag.DurationVar(&options.MaxBackoff, "backoff-max", time.Second, "max backoff between retries, 0 for no cap.")
+	flag.Float64Var(&options.BackoffFactor, "backoff-factor", 2, "multiplier of the backoff per retry.")
+	flag.Float64Var(&options.Jitter, "jitter", 0.5, "fraction of each backoff randomized, from 0 for no jitter to 1 for full jitter.")
+	flag.StringVar(&options.RetryOn, "retry-on", "error,timeout", "results to retry, support \"error\", \"timeout\", and \"notfound.\"")
+	flag.DurationVar(&options.AttemptTimeout, "attempt-timeout", 0, "the deadline of each attempt. 0 for no deadline other than -timeout. InfiniStore requests can not be canceled, so the next attempt waits for the abandoned one.")
+	flag.StringVar(&options.Faults, "faults", "", "faults injected into requests of clients other than the failover client, in the same form as infinibench, e.g. \"get.notfound=30%@5m..10m.\"")
+	flag.StringVar(&options.JSONFile, "json", "", "write the summary to the file in JSON format, which can be compared by bin/compare.")
 
 	flag.Parse(os.Args[1:])
 
@@ -475,10 +510,12 @@ func main() {
 	nanologProvider := benchclient.SetLogger
 	addrArr := strings.Split(options.AddrList, ",")
 	proxies, ring := initProxies(len(addrArr), options)
-	if options.Dummy {
-		benchclient.ResetDummySizeRegistry()
+	clientProviders, err := BuildClientProviders(options)
+	if err != nil {
+		log.Error("Failed to prepare clients: %v", err)
+		os.Exit(1)
+		return
 	}
-	clientProviders := BuildClientProviders(options)
 	clientPools = make([]sync.WaitPool[benchclient.Client], 1, 2)
 	// Initiate failover client pool
 	if options.Failover != "" {
@@ -501,12 +538,17 @@ func main() {
 		delete(clientProviders, strings.ToLower(options.Failover))
 
 		if options.Failover == ProviderDummy {
-			clientProviders[ProviderDummy] = GenDummyClientProvider(options.Bandwidth, benchclient.DummyCache)
+			clientProviders[ProviderDummy], err = GenClientProvider(options, dummyDSN(options, benchclient.DummyCache))
 		}
 	}
 	// Ensure main client pool exists.
-	if len(clientProviders) == 0 {
-		clientProviders[ProviderDefault] = GenDefaultClientProvider(options)
+	if err == nil && len(clientProviders) == 0 {
+		clientProviders[ProviderDefault], err = GenClientProvider(options, defaultDSN(options))
+	}
+	if err != nil {
+		log.Error("Failed to prepare clients: %v", err)
+		os.Exit(1)
+		return
 	}
 	// Initiate main client pool
 	for key, provider := range clientProviders {
@@ -575,6 +617,9 @@ func main() {
 
 	// Start replaying.
 	start := time.Now()
+	if injector != nil {
+		injector.Start()
+	}
 	stop := int64(0)
 	if options.Limit > 0 {
 		stop = options.Skip + options.Limit
@@ -761,23 +806,19 @@ func main() {
 				}
 				log.Info("%d/%d(c:%d) Playbacking %v %s (expc %v, schd %v, actc %v)...", frontier, sn, c, obj.Key, humanize.Bytes(obj.Size), expected, scheduled, actural)
 
-				// Safeguard against timeout.
-				performed := promise.NewPromise()
-				performed.SetTimeout(30 * time.Second)
-				go func(performed promise.Promise, cli benchclient.Client, p *proxy.Proxy, obj *proxy.Object) {
-					_, reqId, _ := perform(options, cli, p, obj)
-					performed.Resolve(reqId)
-				}(performed, cli, p, obj)
-
-				// Wait for the request to be performed.
-				var reqId string
-				timeoutErr := performed.Timeout()
-				if timeoutErr != nil {
+				// Safeguard against timeout. Requests are canceled on the deadline.
+				ctx, cancel := context.Background(), context.CancelFunc(func() {})
+				if options.Timeout > 0 {
+					ctx, cancel = context.WithTimeout(ctx, options.Timeout)
+				}
+				_, reqId, performed := perform(ctx, options, cli, p, obj)
+				cancel()
+				if performed == PerformResultTimeout {
+					// Clients that can not cancel requests, e.g. InfiniStore clients, are still busy with the abandoned
+					// request. Release the client, which is closed once the request completes, and the pool creates another.
 					log.Warn("Timeout playbacking %d:%s", sn, obj.Key)
 					clientPools[0].Release(cli)
 				} else {
-					reqId = performed.Value().(string)
-					promise.Recycle(performed)
 					clientPools[0].Put(cli)
 				}
 				if notifier != nil {
@@ -804,11 +845,8 @@ func main() {
 				// Log
 				log.Debug("csv,%s,%s,%d,%d,%d", reqId, obj.Key, expected, actural, obj.Size)
 
-				// Do not recycle the record if timeout, for the program is still running.
-				if timeoutErr == nil {
-					reader.Done(obj.Record)
-					obj.Record = nil
-				}
+				reader.Done(obj.Record)
+				obj.Record = nil
 				// cond.Signal()
 			}(read, cli, proxies[id], obj, time.Duration(obj.Timestamp-firstTs), skippedDuration+now.Sub(start), notifier)
 
@@ -831,11 +869,13 @@ func main() {
 	gotChunks := uint64(0)
 	resetChunks := uint64(0)
 	activated := 0
+	lambdas := 0
 	var balancerCost time.Duration
 	for i := 0; i < len(proxies); i++ {
 		prxy := proxies[i]
 		for j := 0; j < len(prxy.LambdaPool); j++ {
 			lambda := prxy.LambdaPool[j]
+			lambdas++
 			totalMem += float64(lambda.MemUsed)
 			minMem = math.Min(minMem, float64(lambda.MemUsed))
 			maxMem = math.Max(maxMem, float64(lambda.MemUsed))
@@ -864,18 +904,77 @@ func main() {
 	syslog.Printf("Chunks set %d, got %d, reset %d, hit ratio %.2f%%\n", setChunks, gotChunks, resetChunks, float64(gotChunks*100)/float64(gotChunks+resetChunks))
 	syslog.Printf("Puts total %d, succeeded %d\n", sets, keySets)
 	syslog.Printf("Gets total %d, succeeded %d, miss %d, hit ratio %.2f%%\n", gets, keyGets, keyMiss, float64(keyGets*100)/float64(gets))
+	syslog.Printf("Timeouts %d\n", timeouts)
+	syslog.Printf("Retries %d\n", retries)
+	if injector != nil {
+		syslog.Printf("Injected faults %v\n", injector.Counts())
+	}
 	syslog.Printf("Active Minutes %d\n", activated)
 	syslog.Printf("BalancerCost: %s(%s per request)", balancerCost, balancerCost/time.Duration(read-options.Skip))
 	syslog.Printf("Max concurrency: %d, clients initialized: %d\n", maxConcurrency, atomic.LoadInt32(&numClients))
 	for _, msg := range reader.Report() {
 		syslog.Println(msg)
 	}
+	if options.JSONFile != "" {
+		summary := &bench.PlaybackResult{
+			Trace:              options.TraceName,
+			Elapsed:            time.Since(start).Seconds(),
+			Records:            read - options.Skip,
+			Lambdas:            lambdas,
+			TotalMemory:        uint64(totalMem),
+			MinMemoryPerLambda: uint64(minMem),
+			MaxMemoryPerLambda: uint64(maxMem),
+			MinChunksPerLambda: int(minChunks),
+			MaxChunksPerLambda: int(maxChunks),
+			ChunksSet:          setChunks,
+			ChunksGot:          gotChunks,
+			ChunksReset:        resetChunks,
+			Puts:               int(sets),
+			PutsSucceeded:      int(keySets),
+			Gets:               int(gets),
+			GetsSucceeded:      int(keyGets),
+			Misses:             int(keyMiss),
+			Timeouts:           int(timeouts),
+			Retries:            int(retries),
+			ActiveMinutes:      activated,
+			MaxConcurrency:     int(maxConcurrency),
+		}
+		if injector != nil {
+			summary.Faults = injector.Counts()
+		}
+		if lambdas > 0 {
+			summary.MemoryPerLambda = totalMem / float64(lambdas)
+		}
+		if gotChunks+resetChunks > 0 {
+			summary.ChunkHitRatio = float64(gotChunks*100) / float64(gotChunks+resetChunks)
+		}
+		if gets > 0 {
+			summary.HitRatio = float64(keyGets) * 100 / float64(gets)
+		}
+		if summary.Records > 0 {
+			summary.BalancerCost = float64(balancerCost/time.Duration(summary.Records)) / float64(time.Millisecond)
+		}
+		if err := writeSummary(options.JSONFile, summary); err != nil {
+			syslog.Printf("Failed to write summary: %v\n", err)
+		}
+	}
 
 	for _, p := range clientPools {
 		p.Close()
 	}
 }
 
+// writeSummary writes the summary to the file in JSON format.
+func writeSummary(path string, summary *bench.PlaybackResult) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return summary.WriteJSON(file)
+}
+
 func initPool(concurrency int, provider ClientProvider, closer func(benchclient.Client)) sync.WaitPool[benchclient.Client] {
 	if concurrency == 0 {
 		return &sync.NilPool[benchclient.Client]{New: provider, Closer: closer}
@@ -0,0 +1,125 @@
+package readers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"strconv"
+)
+
+var (
+	ErrEmptySizeHistogram = errors.New("empty size histogram")
+)
+
+// SizeHistogram counts object sizes in buckets. Bucket i counts sizes in (Bounds[i-1], Bounds[i]].
+// The histogram file is in csv format with one "bound,count" pair per line.
+type SizeHistogram struct {
+	Bounds []uint64
+	Counts []uint64
+}
+
+// NewSizeHistogram creates a size histogram with power of 2 buckets.
+func NewSizeHistogram() *SizeHistogram {
+	hist := &SizeHistogram{
+		Bounds: make([]uint64, 64),
+		Counts: make([]uint64, 64),
+	}
+	for i := range hist.Bounds {
+		hist.Bounds[i] = 1 << i
+	}
+	return hist
+}
+
+// Add counts the size into its power of 2 bucket.
+func (h *SizeHistogram) Add(size uint64) {
+	if size == 0 {
+		return
+	}
+	h.Counts[bits.Len64(size-1)]++
+}
+
+// Total returns the number of sizes counted.
+func (h *SizeHistogram) Total() (total uint64) {
+	for _, count := range h.Counts {
+		total += count
+	}
+	return
+}
+
+// Write writes non-empty buckets in the histogram file format.
+func (h *SizeHistogram) Write(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"#bound", "count"})
+	for i, count := range h.Counts {
+		if count == 0 {
+			continue
+		}
+		writer.Write([]string{strconv.FormatUint(h.Bounds[i], 10), strconv.FormatUint(count, 10)})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// ReadSizeHistogram reads a histogram file. Lines start with "#" are ignored.
+func ReadSizeHistogram(rd io.Reader) (*SizeHistogram, error) {
+	reader := csv.NewReader(bufio.NewReader(rd))
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 2
+	hist := &SizeHistogram{}
+	for {
+		line, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		bound, err := strconv.ParseUint(line[0], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		count, err := strconv.ParseUint(line[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if len(hist.Bounds) > 0 && bound <= hist.Bounds[len(hist.Bounds)-1] {
+			return nil, fmt.Errorf("bounds in size histogram must be increasing: %d", bound)
+		}
+		hist.Bounds = append(hist.Bounds, bound)
+		hist.Counts = append(hist.Counts, count)
+	}
+	if hist.Total() == 0 {
+		return nil, ErrEmptySizeHistogram
+	}
+	return hist, nil
+}
+
+// BuildSizeHistogram reads records from the reader and counts their sizes.
+// If unique is true, each key will be counted once. Limit 0 reads all records.
+func BuildSizeHistogram(reader RecordReader, unique bool, limit int64) (*SizeHistogram, error) {
+	hist := NewSizeHistogram()
+	var seen map[string]bool
+	if unique {
+		seen = make(map[string]bool)
+	}
+	for read := int64(0); limit == 0 || read < limit; read++ {
+		rec, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		if rec.Error == nil && rec.Size > 0 && (seen == nil || !seen[rec.Key]) {
+			hist.Add(rec.Size)
+			if seen != nil {
+				seen[rec.Key] = true
+			}
+		}
+		reader.Done(rec)
+	}
+	return hist, nil
+}
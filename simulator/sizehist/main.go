@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ds2-lab/infinibench/simulator/readers"
+)
+
+func main() {
+	var traceName string
+	var output string
+	var unique bool
+	var limit int64
+	flag.StringVar(&traceName, "trace", "IBMDockerRegistry", "type of trace: IBMDockerRegistry, IBMObjectStore, AzureFunctions")
+	flag.StringVar(&output, "o", "", "output histogram file, print to stdout if not specified")
+	flag.BoolVar(&unique, "unique", false, "count each object once instead of each request")
+	flag.Int64Var(&limit, "limit", 0, "limit to read N records only")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ./sizehist [options] tracefile\n")
+		fmt.Fprintf(os.Stderr, "Extracts the object size histogram from the trace for the benchmark option -szhist.\n")
+		fmt.Fprintf(os.Stderr, "Available options:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(0)
+	}
+
+	traceFile, err := os.Open(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open trace file: %v\n", err)
+		os.Exit(1)
+	}
+	defer traceFile.Close()
+
+	var reader readers.RecordReader
+	switch strings.ToLower(traceName) {
+	case "ibmobjectstore":
+		reader = readers.NewIBMObjectStoreReader(traceFile)
+	case "azurefunctions":
+		reader = readers.NewAzureFunctionsReader(traceFile)
+	default:
+		reader = readers.NewIBMDockerRegistryReader(traceFile)
+	}
+
+	hist, err := readers.BuildSizeHistogram(reader, unique, limit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read trace: %v\n", err)
+		os.Exit(1)
+	}
+
+	out := os.Stdout
+	if output != "" {
+		out, err = os.Create(output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create file: %v\n", err)
+			os.Exit(1)
+		}
+		defer out.Close()
+	}
+	if err := hist.Write(out); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write histogram: %v\n", err)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ds2-lab/infinibench/bench"
+)
+
+// flagOptions maps flags to the fields of bench.Options that are named differently.
+var flagOptions = map[string]string{
+	"n":        "Requests",
+	"c":        "Clients",
+	"sz":       "Objsz",
+	"szdist":   "SizeDist",
+	"szmin":    "SizeMin",
+	"szmax":    "SizeMax",
+	"szsigma":  "SizeSigma",
+	"szhist":   "SizeHist",
+	"zipf":     "ZipfTheta",
+	"d":        "Datashard",
+	"p":        "Parityshard",
+	"g":        "ECmaxgoroutine",
+	"read":     "ReadPercent",
+	"maxerr":   "MaxErrors",
+	"i":        "Interval",
+	"cli":      "ClientLib",
+	"cli-base": "ClientBase",
+	"dsn":      "DSN",
+}
+
+// runSweep runs the benchmark at every point of the sweep, and prints the table of all points.
+func runSweep(ctx context.Context, opts *Options) error {
+	params, err := bench.ParseSweep(opts.Sweep)
+	if err != nil {
+		fmt.Fprintf(opts.Stderr, "%s\n", err)
+		return err
+	}
+	for _, param := range params {
+		if name, ok := flagOptions[param.Name]; ok {
+			param.Name = name
+		}
+	}
+	sweep := &bench.Sweep{Params: params, Mode: opts.SweepMode}
+
+	benchOpts := opts.Options
+	benchOpts.Progress = newProgress(opts, "the key range")
+	ret, err := sweep.Run(ctx, &benchOpts, func(point *bench.SweepPoint) {
+		values := make([]string, len(params))
+		for i, param := range params {
+			values[i] = param.Name + "=" + point.Values[i]
+		}
+		if point.Result != nil {
+			fmt.Fprintf(opts.Stdout, "\r%s: %.2f requests per second, p99 %.3f milliseconds\n", strings.Join(values, " "), point.Result.Throughput, point.Result.Latency().P99)
+		}
+		if point.Error != "" {
+			fmt.Fprintf(opts.Stderr, "%s: %s\n", strings.Join(values, " "), point.Error)
+		}
+	})
+	if ret == nil {
+		fmt.Fprintf(opts.Stderr, "%s\n", err)
+		return err
+	}
+
+	fmt.Fprintf(opts.Stdout, "\n")
+	if opts.TableFile != "" {
+		err := writeFile(opts.TableFile, func(w io.Writer) error { return ret.WriteTable(w, opts.TableFormat) })
+		if err != nil {
+			fmt.Fprintf(opts.Stderr, "Failed to write sweep table: %v\n", err)
+		}
+	} else if err := ret.WriteTable(opts.Stdout, opts.TableFormat); err != nil {
+		fmt.Fprintf(opts.Stderr, "Failed to write sweep table: %v\n", err)
+	}
+	if opts.JSONFile != "" {
+		if err := writeFile(opts.JSONFile, ret.WriteJSON); err != nil {
+			fmt.Fprintf(opts.Stderr, "Failed to write JSON result: %v\n", err)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(opts.Stderr, "%s\n", err)
+	}
+	return err
+}